@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// What to do with a digest that was neither
+// approved nor rejected in time.
+const (
+	approvalTimeoutPost = "post"
+	approvalTimeoutSkip = "skip"
+)
+
+const approvalPollInterval = time.Minute
+
+// pendingApproval is a digest awaiting the operator's decision.
+type pendingApproval struct {
+	Code      string
+	Preview   string
+	CreatedAt time.Time
+
+	decision chan bool
+	once     sync.Once
+}
+
+// decide records the decision, only the first one counts.
+func (pa *pendingApproval) decide(approved bool) {
+	pa.once.Do(func() {
+		pa.decision <- approved
+	})
+}
+
+var (
+	approvalsMu sync.Mutex
+	approvals   = map[string]*pendingApproval{}
+)
+
+// resolveApproval applies the operator's decision to the pending
+// digest with the code, reporting whether there was such a digest.
+func resolveApproval(code string, approved bool) bool {
+	approvalsMu.Lock()
+	pa, ok := approvals[code]
+	approvalsMu.Unlock()
+
+	if ok {
+		pa.decide(approved)
+	}
+	return ok
+}
+
+func previewDigest(code string, tweets []*tweet) (string, error) {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "Digest %s of %d videos awaits approval. Reply \"approve %s\" or \"reject %s\".\n",
+		code, len(tweets), code, code)
+	for _, tw := range tweets {
+		text, err := composeTweet(tw)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(buf, "\n%s", text)
+	}
+	return buf.String(), nil
+}
+
+// awaitApproval sends a preview of the digest to the operator and blocks
+// until it is approved or rejected, or until the approval timeout when the
+// timeout action decides. It reports whether the digest may be posted.
+func awaitApproval(cycleStart time.Time, tweets []*tweet) (bool, error) {
+	code := cycleKey(cycleStart)
+	preview, err := previewDigest(code, tweets)
+	if err != nil {
+		return false, err
+	}
+	// The posting loop waits on the operator, which is progress as
+	// far as the watchdog is concerned.
+	heartbeat(cfg.ApprovalTimeout)
+	defer heartbeat(0)
+	return awaitDecision("digest", code, preview)
+}
+
+// awaitDecision sends the preview to the operator and blocks until
+// what, which replies refer to by code, is approved or rejected, or
+// until the approval timeout, reporting whether it may be posted.
+func awaitDecision(what, code, preview string) (bool, error) {
+	pa := &pendingApproval{
+		Code:      code,
+		Preview:   preview,
+		CreatedAt: time.Now(),
+		decision:  make(chan bool, 1),
+	}
+
+	approvalsMu.Lock()
+	approvals[code] = pa
+	approvalsMu.Unlock()
+
+	defer func() {
+		approvalsMu.Lock()
+		delete(approvals, code)
+		approvalsMu.Unlock()
+	}()
+
+	// What the operator never saw can't be approved, whatever the
+	// timeout action. While Twitter is disabled no preview is sent,
+	// although no error is reported either.
+	sent, err := postDMToScreenName(preview, cfg.Operator)
+	if err != nil {
+		return false, fmt.Errorf("sending %s %s for approval: %v", what, code, err)
+	}
+	if sent.Id == 0 && !cfg.DryRun {
+		return false, fmt.Errorf("sending %s %s for approval: the preview wasn't sent, Twitter is disabled", what, code)
+	}
+
+	stopPolling := make(chan bool)
+	defer close(stopPolling)
+	go pollApprovalDMs(sent.Id, stopPolling)
+
+	select {
+	case approved := <-pa.decision:
+		return approved, nil
+	case <-time.After(cfg.ApprovalTimeout):
+		log.Printf("%s %s timed out awaiting approval, will %s it\n", what, code, cfg.ApprovalTimeoutAction)
+		return cfg.ApprovalTimeoutAction == approvalTimeoutPost, nil
+	}
+}
+
+// pollApprovalDMs watches direct messages from the operator for
+// "approve <code>" and "reject <code>" replies until stopped.
+func pollApprovalDMs(sinceId int64, stop chan bool) {
+	ticker := time.NewTicker(approvalPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		params := url.Values{}
+		if sinceId > 0 {
+			params.Set("since_id", strconv.FormatInt(sinceId, 10))
+		}
+		dms, err := twitterAPI.GetDirectMessages(params)
+		if err != nil {
+			log.Printf("polling approval direct messages: %v\n", err)
+			continue
+		}
+
+		for _, dm := range dms {
+			if dm.Id > sinceId {
+				sinceId = dm.Id
+			}
+			if !strings.EqualFold(dm.SenderScreenName, cfg.Operator) {
+				continue
+			}
+			fields := strings.Fields(dm.Text)
+			if len(fields) != 2 {
+				continue
+			}
+			switch strings.ToLower(fields[0]) {
+			case "approve":
+				resolveApproval(fields[1], true)
+			case "reject":
+				resolveApproval(fields[1], false)
+			}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/odeke-em/youtube-popular-bot/youtube"
+)
+
+// archivedVideo is the mirrored metadata of a posted video, kept so
+// that titles and thumbnails remain available after a video is removed.
+type archivedVideo struct {
+	Id       string         `json:"id"`
+	PostedAt time.Time      `json:"posted_at"`
+	Video    *youtube.Video `json:"video,omitempty"`
+}
+
+func videoArchivePath(dir, videoId string) string {
+	return filepath.Join(dir, "videos", videoId+".json")
+}
+
+// archiveVideo writes the video's metadata and statistics to the
+// archive directory, replacing any earlier copy for the same video.
+func archiveVideo(dir string, video *youtube.Video, postedAt time.Time) error {
+	if video == nil {
+		return nil
+	}
+
+	av := &archivedVideo{
+		Id:       video.Id,
+		PostedAt: postedAt,
+		Video:    video,
+	}
+	blob, err := json.MarshalIndent(av, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := videoArchivePath(dir, video.Id)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, blob, 0644)
+}
+
+// cycleKeyLayout is the layout of cycle keys, in UTC.
+const cycleKeyLayout = "20060102T150405Z"
+
+// cycleKey formats the start of a cycle into the
+// key under which that cycle's artifacts are stored.
+func cycleKey(cycleStart time.Time) string {
+	return cycleStart.UTC().Format(cycleKeyLayout)
+}
+
+func thumbnailArchivePath(dir string, cycleStart time.Time, videoId string) string {
+	return filepath.Join(dir, "thumbnails", cycleKey(cycleStart), videoId+".jpg")
+}
+
+// archiveThumbnail permanently saves the video's thumbnail
+// keyed by both the cycle in which it was posted and its id.
+func archiveThumbnail(dir string, cycleStart time.Time, video *youtube.Video) error {
+	if video == nil {
+		return nil
+	}
+
+	path := thumbnailArchivePath(dir, cycleStart, video.Id)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	blob, err := fetchThumbnail(chooseThumbnail(video, cfg.ThumbnailQuality))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, blob, 0644)
+}
+
+// loadArchivedVideo reads back the mirrored metadata for videoId.
+// Videos archived before the youtube client had its own video type
+// are in the API's layout, and are converted as they are read.
+func loadArchivedVideo(dir, videoId string) (*archivedVideo, error) {
+	blob, err := ioutil.ReadFile(videoArchivePath(dir, videoId))
+	if err != nil {
+		return nil, err
+	}
+	var raw struct {
+		archivedVideo
+		Video json.RawMessage `json:"video,omitempty"`
+	}
+	if err := json.Unmarshal(blob, &raw); err != nil {
+		return nil, err
+	}
+	av := &raw.archivedVideo
+	if len(raw.Video) == 0 || string(raw.Video) == "null" {
+		return av, nil
+	}
+
+	var layout struct {
+		Snippet    json.RawMessage `json:"snippet"`
+		Statistics json.RawMessage `json:"statistics"`
+	}
+	if err := json.Unmarshal(raw.Video, &layout); err != nil {
+		return nil, err
+	}
+	if layout.Snippet == nil && layout.Statistics == nil {
+		av.Video = new(youtube.Video)
+		return av, json.Unmarshal(raw.Video, av.Video)
+	}
+	video, err := youtube.NewVideoFromJSON(raw.Video)
+	if err != nil {
+		return nil, err
+	}
+	av.Video = video
+	return av, nil
+}
+
+// writeFileAtomic writes to a temporary file in the same
+// directory and then renames it over path so that readers
+// never observe a partially written file. The file gets perm,
+// as temporary files are only readable by their owner.
+func writeFileAtomic(path string, blob []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if _, err := f.Write(blob); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// role is what a caller of the admin surface is allowed to do,
+// each role being allowed everything that lesser roles are.
+type role int
+
+const (
+	roleNone role = iota
+	roleViewer
+	roleAdmin
+)
+
+// requestToken extracts the token from either a bearer Authorization
+// header, as used by scripts, or the password of basic authentication
+// which browsers can prompt for.
+func requestToken(req *http.Request) string {
+	if _, password, ok := req.BasicAuth(); ok {
+		return password
+	}
+	auth := req.Header.Get("Authorization")
+	if strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return ""
+}
+
+func tokenIn(token string, tokens []string) bool {
+	found := false
+	for _, candidate := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+			found = true
+		}
+	}
+	return found
+}
+
+func roleOf(token string) role {
+	switch {
+	case token == "":
+		return roleNone
+	case tokenIn(token, cfg.AdminTokens):
+		return roleAdmin
+	case tokenIn(token, cfg.ViewerTokens):
+		return roleViewer
+	default:
+		return roleNone
+	}
+}
+
+// requireRole only lets requests through whose token grants at least want.
+func requireRole(want role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		got := roleOf(requestToken(req))
+		if got == roleNone {
+			w.Header().Set("WWW-Authenticate", `Basic realm="youtube-popular-bot"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if got < want {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, req)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+)
+
+// checkAvailable returns an error if the video has been deleted,
+// made private or otherwise can no longer be watched publicly.
+func checkAvailable(videoId string) error {
+	pages, err := youtubeClient.StatusById(videoId)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	var status string
+	for page := range pages {
+		if page.Err != nil {
+			err = page.Err
+			continue
+		}
+		for _, video := range page.Items {
+			if video.Id != videoId {
+				continue
+			}
+			found = true
+			status = video.PrivacyStatus
+			if upload := video.UploadStatus; upload == "deleted" || upload == "rejected" {
+				status = upload
+			}
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("video is no longer available")
+	}
+	if status != "" && status != "public" && status != "unlisted" {
+		return fmt.Errorf("video is now %q", status)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Top level directories of a backup archive.
+const (
+	backupStateDir   = "state"
+	backupArchiveDir = "archive"
+	backupConfigFile = "config.env"
+)
+
+// backupCommand writes the state directory, the index of archived
+// videos and the configuration into a single gzipped tarball, which
+// only its owner can read. The configuration's credentials are left
+// out unless asked for with -with-secrets.
+func backupCommand(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	withSecrets := fs.Bool("with-secrets", false, "include the credentials in the backed up configuration")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: backup [-with-secrets] <file.tar.gz>")
+	}
+	out := fs.Arg(0)
+
+	f, err := os.OpenFile(out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// An existing file keeps its mode when truncated.
+	if err := f.Chmod(0600); err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	if cfg.StateDir != "" {
+		if err := addBackupDir(tw, cfg.StateDir, backupStateDir); err != nil {
+			return err
+		}
+	}
+	if cfg.ArchiveDir != "" {
+		// Thumbnails can be fetched again, only the index of videos is kept.
+		videosDir := filepath.Join(cfg.ArchiveDir, "videos")
+		if err := addBackupDir(tw, videosDir, path.Join(backupArchiveDir, "videos")); err != nil {
+			return err
+		}
+	}
+
+	config := []byte(strings.Join(envLines(&cfg, envPrefix(), *withSecrets), "\n") + "\n")
+	if err := addBackupFile(tw, backupConfigFile, config, 0600, time.Now()); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Printf("backed up to %q", out)
+	return nil
+}
+
+func addBackupDir(tw *tar.Writer, dir, prefix string) error {
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		blob, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return addBackupFile(tw, path.Join(prefix, filepath.ToSlash(rel)), blob, info.Mode().Perm(), info.ModTime())
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func addBackupFile(tw *tar.Writer, name string, blob []byte, mode os.FileMode, modTime time.Time) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(mode),
+		Size:     int64(len(blob)),
+		ModTime:  modTime,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(blob)
+	return err
+}
+
+// restoreCommand unpacks a backup into the configured state and
+// archive directories. The backed up configuration is written to
+// config.env in the state directory for the operator to review,
+// rather than replacing the running configuration.
+func restoreCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: restore <file.tar.gz>")
+	}
+	if cfg.StateDir == "" {
+		return fmt.Errorf("restoring requires a state directory")
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		// Backups only hold regular files, anything else, e.g. a link
+		// pointing out of the directories, isn't the bot's to restore.
+		if hdr.Typeflag != tar.TypeReg {
+			log.Printf("restore: skipping %q, which isn't a regular file\n", hdr.Name)
+			continue
+		}
+		dest, err := restorePath(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if dest == "" {
+			log.Printf("restore: skipping %q\n", hdr.Name)
+			continue
+		}
+
+		blob, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(dest, blob, os.FileMode(hdr.Mode).Perm()); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("restored %q, review %q before starting the bot", args[0], filepath.Join(cfg.StateDir, backupConfigFile))
+	return migrateState()
+}
+
+// restorePath maps the name of a file in a backup to where it is
+// restored to, or "" if it has nowhere to go. Names that would
+// escape their directory are rejected.
+func restorePath(name string) (string, error) {
+	clean := path.Clean(name)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("restore: refusing unsafe path %q", name)
+	}
+
+	switch {
+	case clean == backupConfigFile:
+		return filepath.Join(cfg.StateDir, backupConfigFile), nil
+	case strings.HasPrefix(clean, backupStateDir+"/"):
+		return filepath.Join(cfg.StateDir, filepath.FromSlash(strings.TrimPrefix(clean, backupStateDir+"/"))), nil
+	case strings.HasPrefix(clean, backupArchiveDir+"/") && cfg.ArchiveDir != "":
+		return filepath.Join(cfg.ArchiveDir, filepath.FromSlash(strings.TrimPrefix(clean, backupArchiveDir+"/"))), nil
+	}
+	return "", nil
+}
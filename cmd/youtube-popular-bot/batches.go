@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// batchDueTimes splits n posts, in the order they are posted, into
+// batches of size and spreads the batches evenly over the period from
+// start, returning when each post's batch is due.
+func batchDueTimes(n, size int, start time.Time, period time.Duration) []time.Time {
+	if n == 0 || size < 1 {
+		return nil
+	}
+	batches := (n + size - 1) / size
+	gap := period / time.Duration(batches)
+	due := make([]time.Time, n)
+	for i := range due {
+		due[i] = start.Add(time.Duration(i/size) * gap)
+	}
+	return due
+}
+
+// resumeMaxAge is how old a cycle may be for the batches left of its
+// digest to be resumed: a period, or the digest TTL if that is shorter.
+func resumeMaxAge() time.Duration {
+	if cfg.DigestTTL > 0 && cfg.DigestTTL < cfg.Period {
+		return cfg.DigestTTL
+	}
+	return cfg.Period
+}
+
+// resumeBatches finishes the digest that the restored queue was split
+// into batches of, if the bot was stopped before its last batch went
+// out: the posts still queued are fetched afresh, screened again and
+// posted as their batches come due, followed by the digest's intro.
+// Digests older than resumeMaxAge are dropped instead, and resuming
+// stops if cycles are paused. It runs in the posting loop's goroutine,
+// before the loop's first cycle.
+func resumeBatches(throttle time.Duration) []error {
+	cycle, posts := queue.list()
+	var pending []queuedPost
+	for _, qp := range posts {
+		if qp.Batch > 0 && (qp.State == postQueued || qp.State == postEdited) {
+			pending = append(pending, qp)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	cycleStart, err := time.Parse(cycleKeyLayout, cycle)
+	if err != nil {
+		return []error{fmt.Errorf("resuming the batches of cycle %q: %v", cycle, err)}
+	}
+	if age := time.Since(cycleStart); age > resumeMaxAge() {
+		log.Printf("dropping the %d posts left of the batches of %s, which is %s old\n",
+			len(pending), cycle, age.Round(time.Minute))
+		for _, qp := range pending {
+			queue.drop(qp.VideoId)
+		}
+		return nil
+	}
+	// Digests are posted last to first.
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Rank > pending[j].Rank })
+	log.Printf("resuming the %d posts left of the batches of %s\n", len(pending), cycle)
+
+	var errs []error
+	ids := make([]string, 0, len(pending))
+	for _, qp := range pending {
+		ids = append(ids, qp.VideoId)
+	}
+	videos, err := videosById(ids)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("fetching the posts left of %s: %v", cycle, err))
+	}
+
+	for i, qp := range pending {
+		video, ok := videos[qp.VideoId]
+		if !ok {
+			errs = append(errs, fmt.Errorf("skipping %q of %s, which couldn't be fetched", qp.VideoId, cycle))
+			queue.markDone(qp.VideoId, false)
+			continue
+		}
+		wait := time.Until(qp.Due)
+		if i > 0 && wait < throttle {
+			wait = throttle
+		}
+		realClock{}.Sleep(wait)
+		waitOutQuietHours(realClock{})
+		if paused() {
+			log.Printf("cycles are paused, leaving the %d posts left of the batches of %s\n", len(pending)-i, cycle)
+			return errs
+		}
+
+		tw := newTweet(video)
+		tw.Rank = qp.Rank
+		screened, screenErrs := screenCandidates([]*tweet{tw})
+		errs = append(errs, screenErrs...)
+		if len(screened) == 0 {
+			queue.drop(tw.YouTubeId)
+			continue
+		}
+		if !queue.claim(tw) {
+			continue
+		}
+		text, err := composeTweet(tw)
+		if err != nil {
+			errs = append(errs, err)
+			queue.markDone(tw.YouTubeId, false)
+			continue
+		}
+		result, err := postTweet(text, nil)
+		queue.markDone(tw.YouTubeId, err == nil)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !cfg.DryRun {
+			if err := store.MarkPosted(tw.YouTubeId, time.Now()); err != nil {
+				errs = append(errs, err)
+			}
+			event := newPostEvent("video", result, text)
+			event.Rank = tw.Rank
+			event.VideoId = tw.YouTubeId
+			event.Title = tw.Title
+			event.URL = tw.URL
+			errs = append(errs, runPostHooks(event)...)
+		}
+	}
+
+	introTweet, err := composeIntro(&introData{Count: len(posts), Period: cfg.Period, Since: cycleStart.Add(-cfg.Period)})
+	if err != nil {
+		return append(errs, err)
+	}
+	realClock{}.Sleep(throttle)
+	waitOutQuietHours(realClock{})
+	if paused() {
+		log.Printf("cycles are paused, leaving the intro of %s\n", cycle)
+		return errs
+	}
+	if _, err := postTweet(introTweet, nil); err != nil {
+		return append(errs, err)
+	}
+	if !cfg.DryRun {
+		run := &lastRun{At: cycleStart}
+		_, posts = queue.list()
+		for _, qp := range posts {
+			if qp.State == postPosted {
+				run.VideoIds = append(run.VideoIds, qp.VideoId)
+			}
+		}
+		if err := store.SaveLastRun(run); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
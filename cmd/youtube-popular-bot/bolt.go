@@ -0,0 +1,218 @@
+//go:build bolt
+// +build bolt
+
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/odeke-em/youtube-popular-bot/youtube"
+)
+
+// Building with -tags bolt registers the Bolt store.
+func init() {
+	storeBackends[storeBolt] = func(dsn string) (Store, error) {
+		return openBoltStore(dsn)
+	}
+}
+
+// Buckets of the Bolt store: the state kept as JSON by name, when
+// each posted video was posted.
+var (
+	boltStateBucket  = []byte("state")
+	boltPostedBucket = []byte("posted")
+)
+
+// boltStore keeps state in a Bolt file, for a single node
+// that wants a database without a server.
+type boltStore struct {
+	db *bolt.DB
+	mu sync.Mutex
+}
+
+func openBoltStore(path string) (*boltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltStateBucket, boltPostedBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+// load decodes the named state into v, leaving v untouched if there is none.
+func (s *boltStore) load(name string, v interface{}) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		blob := tx.Bucket(boltStateBucket).Get([]byte(name))
+		if blob == nil {
+			return nil
+		}
+		return json.Unmarshal(blob, v)
+	})
+}
+
+func (s *boltStore) save(name string, v interface{}) error {
+	blob, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltStateBucket).Put([]byte(name), blob)
+	})
+}
+
+func (s *boltStore) LoadSnapshot() ([]*youtube.Video, error) {
+	var videos []*youtube.Video
+	err := s.load(snapshotStateName, &videos)
+	return videos, err
+}
+
+func (s *boltStore) SaveSnapshot(videos []*youtube.Video) error {
+	return s.save(snapshotStateName, videos)
+}
+
+func (s *boltStore) MarkPosted(videoId string, at time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltPostedBucket)
+		blob, err := at.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(videoId), blob); err != nil {
+			return err
+		}
+
+		var stale [][]byte
+		oldest := at.Add(-maxPostedAge)
+		err = b.ForEach(func(id, blob []byte) error {
+			var postedAt time.Time
+			if err := postedAt.UnmarshalBinary(blob); err != nil {
+				return err
+			}
+			if postedAt.Before(oldest) {
+				stale = append(stale, append([]byte(nil), id...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range stale {
+			if err := b.Delete(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) PostedSince(t time.Time) (map[string]time.Time, error) {
+	posted := make(map[string]time.Time)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltPostedBucket).ForEach(func(id, blob []byte) error {
+			var at time.Time
+			if err := at.UnmarshalBinary(blob); err != nil {
+				return err
+			}
+			if !at.Before(t) {
+				posted[string(id)] = at
+			}
+			return nil
+		})
+	})
+	return posted, err
+}
+
+func (s *boltStore) LoadQueue() (string, []queuedPost, error) {
+	var state queueState
+	err := s.load(queueStateName, &state)
+	return state.Cycle, state.Posts, err
+}
+
+func (s *boltStore) SaveQueue(cycle string, posts []queuedPost) error {
+	return s.save(queueStateName, &queueState{Cycle: cycle, Posts: posts})
+}
+
+func (s *boltStore) AppendCost(cost *cycleCost) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var costs []*cycleCost
+	if err := s.load(costsStateName, &costs); err != nil {
+		return err
+	}
+	return s.save(costsStateName, trimCosts(append(costs, cost)))
+}
+
+func (s *boltStore) Costs() ([]*cycleCost, error) {
+	var costs []*cycleCost
+	err := s.load(costsStateName, &costs)
+	return costs, err
+}
+
+func (s *boltStore) LoadLastRun() (*lastRun, error) {
+	var run *lastRun
+	err := s.load(lastRunStateName, &run)
+	return run, err
+}
+
+func (s *boltStore) SaveLastRun(run *lastRun) error {
+	return s.save(lastRunStateName, run)
+}
+
+func (s *boltStore) Forget(videoIds map[string]bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	videos, err := s.LoadSnapshot()
+	if err != nil {
+		return err
+	}
+	if err := s.SaveSnapshot(forgetVideos(videos, videoIds)); err != nil {
+		return err
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltPostedBucket)
+		for id := range videoIds {
+			if err := b.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	cycle, posts, err := s.LoadQueue()
+	if err != nil {
+		return err
+	}
+	if err := s.SaveQueue(cycle, forgetQueued(posts, videoIds)); err != nil {
+		return err
+	}
+
+	run, err := s.LoadLastRun()
+	if err != nil || run == nil {
+		return err
+	}
+	return s.SaveLastRun(forgetRun(run, videoIds))
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
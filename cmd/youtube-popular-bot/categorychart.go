@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// categoryNames are the names of YouTube's video categories.
+var categoryNames = map[string]string{
+	"1":  "Film & Animation",
+	"2":  "Autos & Vehicles",
+	"10": "Music",
+	"15": "Pets & Animals",
+	"17": "Sports",
+	"19": "Travel & Events",
+	"20": "Gaming",
+	"22": "People & Blogs",
+	"23": "Comedy",
+	"24": "Entertainment",
+	"25": "News & Politics",
+	"26": "Howto & Style",
+	"27": "Education",
+	"28": "Science & Technology",
+	"29": "Nonprofits & Activism",
+}
+
+func categoryName(id string) string {
+	if name, ok := categoryNames[id]; ok {
+		return name
+	}
+	return "Category " + id
+}
+
+// The chart is sized for the large images of link previews, like the
+// collages, with a bar for every day of the month.
+const (
+	chartWidth  = 1200
+	chartHeight = 630
+	chartMargin = 40
+	chartGap    = 2
+)
+
+// chartColors are those of the leading categories, in order, which the
+// commentary refers to by the emoji of the same colors, the rest of the
+// categories sharing the last color as "Other".
+var chartColors = []struct {
+	color color.RGBA
+	emoji string
+}{
+	{color.RGBA{0xe0, 0x3c, 0x31, 0xff}, "🟥"},
+	{color.RGBA{0xf5, 0x8f, 0x1f, 0xff}, "🟧"},
+	{color.RGBA{0xf2, 0xc9, 0x1a, 0xff}, "🟨"},
+	{color.RGBA{0x3a, 0xa6, 0x55, 0xff}, "🟩"},
+	{color.RGBA{0x2f, 0x6f, 0xd6, 0xff}, "🟦"},
+	{color.RGBA{0xb0, 0xb0, 0xb0, 0xff}, "⬜"},
+}
+
+// categoryMonth is how many videos of each category were in each
+// day's digests of a month, a video counting once per digest.
+type categoryMonth struct {
+	month  time.Time
+	days   []map[string]int
+	totals map[string]int
+	total  int
+}
+
+// buildCategoryMonth tallies the categories of the videos in the
+// digests archived in dir that were posted in the month of t.
+func buildCategoryMonth(dir string, t time.Time, loc *time.Location) (*categoryMonth, error) {
+	t = t.In(loc)
+	start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	cm := &categoryMonth{
+		month:  start,
+		days:   make([]map[string]int, start.AddDate(0, 1, -1).Day()),
+		totals: map[string]int{},
+	}
+	for i := range cm.days {
+		cm.days[i] = map[string]int{}
+	}
+	categories := map[string]string{}
+	err := forEachDigest(dir, func(dr *digestRecord) error {
+		at := dr.PostedAt.In(loc)
+		if at.Year() != start.Year() || at.Month() != start.Month() {
+			return nil
+		}
+		for _, dv := range dr.Videos {
+			category := dv.CategoryId
+			if category == "" {
+				// Older digests lack the categories, which
+				// the archived videos might have.
+				var ok bool
+				if category, ok = categories[dv.VideoId]; !ok {
+					if av, err := loadArchivedVideo(dir, dv.VideoId); err == nil && av.Video != nil {
+						category = av.Video.CategoryId
+					}
+					categories[dv.VideoId] = category
+				}
+			}
+			if category == "" {
+				continue
+			}
+			cm.days[at.Day()-1][category]++
+			cm.totals[category]++
+			cm.total++
+		}
+		return nil
+	})
+	return cm, err
+}
+
+// leading returns the categories with the biggest shares of the
+// month, as many as there are colors for besides "Other".
+func (cm *categoryMonth) leading() []string {
+	categories := make([]string, 0, len(cm.totals))
+	for category := range cm.totals {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		a, b := categories[i], categories[j]
+		if cm.totals[a] != cm.totals[b] {
+			return cm.totals[a] > cm.totals[b]
+		}
+		return a < b
+	})
+	if n := len(chartColors) - 1; len(categories) > n {
+		categories = categories[:n]
+	}
+	return categories
+}
+
+func (cm *categoryMonth) share(category string) float64 {
+	if cm.total == 0 {
+		return 0
+	}
+	return float64(cm.totals[category]) / float64(cm.total)
+}
+
+// render draws the month as a bar a day, stacked with the shares of the
+// leading categories from the bottom up and those of the others on top.
+func (cm *categoryMonth) render(leading []string) ([]byte, error) {
+	canvas := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	// The baseline shows the days without digests.
+	baseline := image.Rect(chartMargin, chartHeight-chartMargin, chartWidth-chartMargin, chartHeight-chartMargin+chartGap)
+	draw.Draw(canvas, baseline, image.NewUniform(color.Gray{0xd0}), image.Point{}, draw.Src)
+
+	barWidth := (chartWidth - 2*chartMargin) / len(cm.days)
+	plotHeight := chartHeight - 2*chartMargin
+	for i, day := range cm.days {
+		total := 0
+		for _, n := range day {
+			total += n
+		}
+		if total == 0 {
+			continue
+		}
+
+		counts := make([]int, len(chartColors))
+		others := total
+		for j, category := range leading {
+			counts[j] = day[category]
+			others -= day[category]
+		}
+		counts[len(counts)-1] = others
+
+		x := chartMargin + i*barWidth
+		bottom, sum := chartHeight-chartMargin, 0
+		for j, n := range counts {
+			sum += n
+			top := chartHeight - chartMargin - sum*plotHeight/total
+			rect := image.Rect(x+chartGap/2, top, x+barWidth-chartGap/2, bottom)
+			draw.Draw(canvas, rect, image.NewUniform(chartColors[j].color), image.Point{}, draw.Src)
+			bottom = top
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, canvas); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// commentary describes the month's shares, keyed by the colors of the
+// chart, and how the leading category fared against the month before.
+func (cm *categoryMonth) commentary(leading []string, prev *categoryMonth) string {
+	parts := []string{}
+	rest := 1.0
+	for i, category := range leading {
+		share := cm.share(category)
+		rest -= share
+		parts = append(parts, fmt.Sprintf("%s %s %.0f%%", chartColors[i].emoji, categoryName(category), 100*share))
+	}
+	if len(cm.totals) > len(leading) {
+		parts = append(parts, fmt.Sprintf("%s Other %.0f%%", chartColors[len(chartColors)-1].emoji, 100*rest))
+	}
+	text := fmt.Sprintf("Trending YouTube videos by category in %s, day by day: %s.",
+		cm.month.Format("January 2006"), strings.Join(parts, ", "))
+
+	if prev == nil || prev.total == 0 || len(leading) == 0 {
+		return text
+	}
+	top := leading[0]
+	change := 100 * (cm.share(top) - prev.share(top))
+	var trend string
+	switch {
+	case change >= 0.5:
+		trend = fmt.Sprintf("up %.0f points on %s", change, prev.month.Format("January"))
+	case change <= -0.5:
+		trend = fmt.Sprintf("down %.0f points on %s", -change, prev.month.Format("January"))
+	default:
+		trend = fmt.Sprintf("level with %s", prev.month.Format("January"))
+	}
+	more := fmt.Sprintf(" %s led, %s.", categoryName(top), trend)
+	if tweetLength(text+more) <= maxTweetLength {
+		text += more
+	}
+	return text
+}
+
+// postCategoryChart tweets the chart of the month of t with its
+// commentary, doing nothing if no digest of the month has categories.
+// Months are reckoned in loc.
+func postCategoryChart(t time.Time, loc *time.Location) error {
+	cm, err := buildCategoryMonth(cfg.ArchiveDir, t, loc)
+	if err != nil {
+		return err
+	}
+	if cm.total == 0 {
+		return nil
+	}
+	prev, err := buildCategoryMonth(cfg.ArchiveDir, cm.month.AddDate(0, -1, 0), loc)
+	if err != nil {
+		return err
+	}
+
+	leading := cm.leading()
+	blob, err := cm.render(leading)
+	if err != nil {
+		return err
+	}
+	media, err := uploadMedia(base64.StdEncoding.EncodeToString(blob))
+	if err != nil {
+		return fmt.Errorf("uploading the category chart: %v", err)
+	}
+	params := url.Values{}
+	if media.MediaIDString != "" {
+		params.Set("media_ids", media.MediaIDString)
+	}
+	_, err = postTweet(cm.commentary(leading, prev), params)
+	return err
+}
+
+// periodicCategoryCharts posts the category chart of the month at the
+// times of its schedule. One due on the 1st of a month is of the month
+// that just ended.
+func periodicCategoryCharts(s *schedule) chan error {
+	_, loc := pacing()
+	return runOnSchedule(s, func(at time.Time) error {
+		return postCategoryChart(at.AddDate(0, 0, -1), loc)
+	})
+}
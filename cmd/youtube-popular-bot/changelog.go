@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// configChangesFile is the state file of the configuration's changes.
+const configChangesFile = "config_changes.json"
+
+// maxConfigChanges is how many of the latest changes are kept.
+const maxConfigChanges = 500
+
+// configChange is a setting that a reload changed.
+type configChange struct {
+	Time    time.Time `json:"time"`
+	Setting string    `json:"setting"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+}
+
+// announcedSettings are those whose changes change what the bot covers,
+// which are announced if the operator asked for it.
+var announcedSettings = map[string]bool{
+	"PERIOD": true, "SCHEDULE": true, "REGION_CODE": true, "CATEGORY_SHARDS": true,
+}
+
+// diffSettings returns the named fields that differ between
+// from and to, each setting named by its environment variable.
+func diffSettings(from, to *config, fields []string) []*configChange {
+	fromV, toV := reflect.ValueOf(from).Elem(), reflect.ValueOf(to).Elem()
+	now := time.Now()
+	var changes []*configChange
+	for _, name := range fields {
+		field, _ := fromV.Type().FieldByName(name)
+		before := fmt.Sprint(fromV.FieldByName(name).Interface())
+		after := fmt.Sprint(toV.FieldByName(name).Interface())
+		if before == after {
+			continue
+		}
+		changes = append(changes, &configChange{
+			Time:    now,
+			Setting: field.Tag.Get("env"),
+			From:    before,
+			To:      after,
+		})
+	}
+	return changes
+}
+
+// recordConfigChanges logs the changes, appends them to the state
+// directory's record and, if they change what is covered and that is
+// to be announced, posts a note of what the bot now covers.
+func recordConfigChanges(old *config, changes []*configChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	announce := false
+	for _, c := range changes {
+		log.Printf("configuration: %s changed from %q to %q\n", c.Setting, c.From, c.To)
+		announce = announce || announcedSettings[c.Setting]
+	}
+
+	var record []*configChange
+	if err := loadStateFile(configChangesFile, &record); err != nil {
+		return err
+	}
+	record = append(record, changes...)
+	if len(record) > maxConfigChanges {
+		record = record[len(record)-maxConfigChanges:]
+	}
+	if err := saveStateFile(configChangesFile, record); err != nil {
+		return err
+	}
+
+	if !announce || !cfg.AnnounceConfigChanges {
+		return nil
+	}
+	text, err := composeChangelog(&cfg)
+	if err != nil {
+		return err
+	}
+	if _, err := postTweet(text, nil); err != nil {
+		return fmt.Errorf("announcing the configuration's changes: %v", err)
+	}
+	return nil
+}
+
+// changelogData is what the "changelog" template is rendered from.
+type changelogData struct {
+	Region     string
+	Categories string
+	Every      string
+	Schedule   string
+}
+
+func composeChangelog(c *config) (string, error) {
+	data := &changelogData{
+		Region:     "Worldwide",
+		Categories: strings.Join(c.CategoryShards, ", "),
+		Every:      every(c.Period),
+		Schedule:   c.Schedule,
+	}
+	if c.RegionCode != "" {
+		data.Region = c.RegionCode
+		if name, ok := countryNames[c.RegionCode]; ok {
+			data.Region = name
+		}
+	}
+	buf := new(bytes.Buffer)
+	if err := templates.ExecuteTemplate(buf, "changelog", data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// every writes the period as it is read after "every",
+// e.g. "hour", "4 hours" or "90 minutes".
+func every(period time.Duration) string {
+	switch {
+	case period == time.Hour:
+		return "hour"
+	case period%time.Hour == 0:
+		return fmt.Sprintf("%d hours", period/time.Hour)
+	case period == time.Minute:
+		return "minute"
+	case period%time.Minute == 0:
+		return fmt.Sprintf("%d minutes", period/time.Minute)
+	}
+	return period.String()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var errChaosDropped = errors.New("chaos: request dropped")
+
+// chaosTransport fails a fraction of requests, either as though the
+// network dropped them or as though the API rate limited them, to
+// exercise retries and error handling end to end in staging.
+type chaosTransport struct {
+	base         http.RoundTripper
+	dropRate     float64
+	throttleRate float64
+
+	mu  *sync.Mutex
+	rng *rand.Rand
+}
+
+// newChaosTransport returns nil if no failures are to be injected.
+func newChaosTransport(dropRate, throttleRate float64) *chaosTransport {
+	if dropRate <= 0 && throttleRate <= 0 {
+		return nil
+	}
+	return &chaosTransport{
+		dropRate:     dropRate,
+		throttleRate: throttleRate,
+		mu:           new(sync.Mutex),
+		rng:          rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (t *chaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	r := t.rng.Float64()
+	t.mu.Unlock()
+
+	switch {
+	case r < t.dropRate:
+		return nil, errChaosDropped
+	case r < t.dropRate+t.throttleRate:
+		return throttledResponse(req), nil
+	}
+
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// throttledResponse fabricates the 429 that both YouTube and Twitter
+// respond with when rate limiting, with a reset a minute from now.
+func throttledResponse(req *http.Request) *http.Response {
+	body := `{"error":{"code":429,"message":"chaos: rate limited","errors":[{"reason":"rateLimitExceeded"}]},"errors":[{"code":88,"message":"chaos: rate limited"}]}`
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Retry-After", "60")
+	header.Set("X-Rate-Limit-Reset", strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10))
+
+	return &http.Response{
+		Status:        "429 Too Many Requests",
+		StatusCode:    http.StatusTooManyRequests,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewBufferString(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
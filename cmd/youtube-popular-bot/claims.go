@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// botClaims are the videos that a bot sharing a store claims, which
+// the other bots sharing it leave out of their digests, e.g. a music
+// bot claiming the Music category from a general one.
+type botClaims struct {
+	Categories []string  `json:"categories,omitempty"`
+	Channels   []string  `json:"channels,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (c *botClaims) claims(tw *tweet) bool {
+	if tw.video == nil {
+		return false
+	}
+	return anyEqualFold(c.Categories, tw.video.CategoryId) || anyEqualFold(c.Channels, tw.video.ChannelId)
+}
+
+// stale reports whether the claims were last refreshed longer than
+// cfg.ClaimsTTL ago, by a bot that has presumably stopped since.
+func (c *botClaims) stale(now time.Time) bool {
+	return now.Sub(c.UpdatedAt) > cfg.ClaimsTTL
+}
+
+// saveClaims records what this bot claims, replacing its earlier claims.
+func saveClaims() error {
+	return store.(claimsStore).SaveClaims(cfg.BotName, &botClaims{
+		Categories: cfg.ClaimCategories,
+		Channels:   cfg.ClaimChannels,
+		UpdatedAt:  time.Now(),
+	})
+}
+
+// refreshClaims saves the bot's claims every third of cfg.ClaimsTTL,
+// so that the other bots keep honoring them for as long as it runs.
+func refreshClaims() chan error {
+	return runOnTicks(time.Tick(cfg.ClaimsTTL/3), func(time.Time) error {
+		return saveClaims()
+	})
+}
+
+// dropClaimed leaves out the videos that other bots sharing the store
+// claim, unless this bot claims them too, in which case both post them.
+// The claims of bots that stopped refreshing them are ignored.
+func dropClaimed(tweets []*tweet) ([]*tweet, error) {
+	claims, err := store.(claimsStore).Claims()
+	if err != nil {
+		return tweets, err
+	}
+	delete(claims, cfg.BotName)
+	now := time.Now()
+	for bot, c := range claims {
+		if c.stale(now) {
+			delete(claims, bot)
+		}
+	}
+	if len(claims) == 0 {
+		return tweets, nil
+	}
+	own := &botClaims{Categories: cfg.ClaimCategories, Channels: cfg.ClaimChannels}
+
+	var kept []*tweet
+	for _, tw := range tweets {
+		claimant := ""
+		if !own.claims(tw) {
+			for bot, c := range claims {
+				if c.claims(tw) {
+					claimant = bot
+					break
+				}
+			}
+		}
+		if claimant != "" {
+			log.Printf("skipping %q: claimed by the bot %q\n", tw.YouTubeId, claimant)
+			continue
+		}
+		kept = append(kept, tw)
+	}
+	return kept, nil
+}
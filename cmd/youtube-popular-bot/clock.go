@@ -0,0 +1,99 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// clock is what the posting loop paces itself by, so that dry runs
+// can go through the same waits without actually waiting.
+type clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// Sleep beats the heartbeat of the posting loop, for which sleeping
+// is making progress.
+func (realClock) Sleep(d time.Duration) {
+	heartbeat(d)
+	time.Sleep(d)
+	heartbeat(0)
+}
+
+// simClock fast-forwards through sleeps, starting from the time it
+// was created at.
+type simClock struct {
+	now time.Time
+}
+
+func (c *simClock) Now() time.Time { return c.now }
+
+func (c *simClock) Sleep(d time.Duration) {
+	if d > 0 {
+		c.now = c.now.Add(d)
+	}
+}
+
+// Twitter caps how many tweets an account posts, counting those
+// of every app, at tweetLimit within any tweetLimitWindow.
+const (
+	tweetLimit       = 300
+	tweetLimitWindow = 3 * time.Hour
+)
+
+// rateWindow holds off sending more than max within any per.
+type rateWindow struct {
+	max int
+	per time.Duration
+
+	mu    sync.Mutex
+	times []time.Time
+}
+
+// tweetWindow counts what the bot tweeted, in every job.
+var tweetWindow = &rateWindow{max: tweetLimit, per: tweetLimitWindow}
+
+func (w *rateWindow) add(t time.Time) {
+	w.mu.Lock()
+	w.times = append(w.times, t)
+	w.mu.Unlock()
+}
+
+// wait blocks, on clk, until one more can be sent.
+func (w *rateWindow) wait(clk clock) {
+	w.mu.Lock()
+	now := clk.Now()
+	for len(w.times) > 0 && !w.times[0].Add(w.per).After(now) {
+		w.times = w.times[1:]
+	}
+	var until time.Time
+	if len(w.times) >= w.max {
+		until = w.times[len(w.times)-w.max].Add(w.per)
+	}
+	w.mu.Unlock()
+
+	if !until.IsZero() {
+		log.Printf("at the limit of %d tweets in %s, holding off until %s\n", w.max, w.per, until.Format("15:04 MST"))
+		clk.Sleep(until.Sub(now))
+	}
+}
+
+// plannedPost is a post of a dry run's timeline.
+type plannedPost struct {
+	At   time.Time
+	What string
+}
+
+// logTimeline prints when each of a dry run's posts would have gone
+// out, had the throttle, the quiet hours and the limits been waited for.
+func logTimeline(cycle string, start time.Time, timeline []plannedPost) {
+	log.Printf("dry run: planned timeline of cycle %s\n", cycle)
+	for _, p := range timeline {
+		log.Printf("dry run: %s (+%s) %s\n", p.At.Format("2006-01-02 15:04:05 MST"), p.At.Sub(start).Round(time.Second), p.What)
+	}
+}
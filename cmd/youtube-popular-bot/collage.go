@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// The collage is a 2 by 2 grid of the top videos' thumbnails
+// sized for the large images of link previews.
+const (
+	collageWidth   = 1200
+	collageHeight  = 630
+	collageColumns = 2
+	collageRows    = 2
+)
+
+func collagePath(dir, cycle string) string {
+	return filepath.Join(dir, "digests", cycle+".jpg")
+}
+
+// digestCollage returns the JPEG collage of the digest's top videos,
+// rendering and caching it beside the digest on first use.
+func digestCollage(dir string, dr *digestRecord) ([]byte, error) {
+	path := collagePath(dir, dr.Cycle)
+	if blob, err := ioutil.ReadFile(path); err == nil {
+		return blob, nil
+	}
+
+	var urls []string
+	for _, dv := range dr.Videos {
+		if dv.ThumbnailURL != "" {
+			urls = append(urls, dv.ThumbnailURL)
+		}
+	}
+	blob, cells, err := renderCollage(urls)
+	if err != nil {
+		return nil, err
+	}
+	if cells == 0 {
+		// Don't keep a blank collage, the thumbnails may load later.
+		return blob, nil
+	}
+	if err := writeFileAtomic(path, blob, 0644); err != nil {
+		return nil, err
+	}
+	return blob, nil
+}
+
+// renderCollage returns the JPEG collage of the first thumbnails
+// that load, and into how many of its cells they went.
+func renderCollage(thumbnailURLs []string) ([]byte, int, error) {
+	canvas := image.NewRGBA(image.Rect(0, 0, collageWidth, collageHeight))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+	cellWidth, cellHeight := collageWidth/collageColumns, collageHeight/collageRows
+	cell := 0
+	for _, u := range thumbnailURLs {
+		if cell == collageColumns*collageRows {
+			break
+		}
+		blob, err := fetchThumbnail(&thumbnail{URL: u})
+		if err != nil {
+			continue
+		}
+		thumb, _, err := image.Decode(bytes.NewReader(blob))
+		if err != nil {
+			continue
+		}
+
+		x, y := (cell%collageColumns)*cellWidth, (cell/collageColumns)*cellHeight
+		scaleInto(canvas, image.Rect(x, y, x+cellWidth, y+cellHeight), thumb)
+		cell++
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, canvas, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), cell, nil
+}
+
+// scaleInto draws src over dst's rect, scaling it with the nearest
+// neighbour which is good enough for a preview.
+func scaleInto(dst draw.Image, rect image.Rectangle, src image.Image) {
+	sb := src.Bounds()
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		sy := sb.Min.Y + (y-rect.Min.Y)*sb.Dy()/rect.Dy()
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			sx := sb.Min.X + (x-rect.Min.X)*sb.Dx()/rect.Dx()
+			dst.Set(x, y, src.At(sx, sy))
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ChimeraCoder/anaconda"
+)
+
+// compareTitleLength is how many characters of each title a row of a
+// comparison keeps, leaving room for both titles and links in a tweet.
+const compareTitleLength = 80
+
+// composeComparison returns the tweets of a thread comparing the top
+// videos of regions a and b, one tweet per rank, noting where videos
+// trending in one region rank in the other.
+func composeComparison(a, b string, topA, topB []*tweet) []string {
+	rankIn := func(tweets []*tweet) map[string]int {
+		ranks := make(map[string]int, len(tweets))
+		for i, tw := range tweets {
+			ranks[tw.YouTubeId] = i + 1
+		}
+		return ranks
+	}
+	ranksA, ranksB := rankIn(topA), rankIn(topB)
+
+	var onlyA, onlyB []string
+	both := 0
+	for i, tw := range topA {
+		if _, ok := ranksB[tw.YouTubeId]; ok {
+			both++
+		} else {
+			onlyA = append(onlyA, fmt.Sprintf("#%d", i+1))
+		}
+	}
+	for i, tw := range topB {
+		if _, ok := ranksA[tw.YouTubeId]; !ok {
+			onlyB = append(onlyB, fmt.Sprintf("#%d", i+1))
+		}
+	}
+
+	n := len(topA)
+	if len(topB) > n {
+		n = len(topB)
+	}
+	texts := []string{fmt.Sprintf("Top %d YouTube videos, %s vs %s: %d trending in both", n, countryNames[a], countryNames[b], both)}
+
+	row := func(code string, tw *tweet, otherCode string, otherRanks map[string]int) string {
+		line := fmt.Sprintf("%s: %s %s", code, truncate(tw.Title, compareTitleLength), tw.URL)
+		if rank, ok := otherRanks[tw.YouTubeId]; ok {
+			line += fmt.Sprintf(" (#%d in %s)", rank, otherCode)
+		}
+		return line
+	}
+	for i := 0; i < n; i++ {
+		lines := []string{fmt.Sprintf("#%d", i+1)}
+		if i < len(topA) {
+			lines = append(lines, row(a, topA[i], b, ranksB))
+		}
+		if i < len(topB) {
+			lines = append(lines, row(b, topB[i], a, ranksA))
+		}
+		texts = append(texts, strings.Join(lines, "\n"))
+	}
+
+	var exclusive []string
+	if len(onlyA) > 0 {
+		exclusive = append(exclusive, fmt.Sprintf("Only in %s: %s", countryNames[a], strings.Join(onlyA, ", ")))
+	}
+	if len(onlyB) > 0 {
+		exclusive = append(exclusive, fmt.Sprintf("Only in %s: %s", countryNames[b], strings.Join(onlyB, ", ")))
+	}
+	if len(exclusive) > 0 {
+		texts = append(texts, strings.Join(exclusive, "\n"))
+	}
+	return texts
+}
+
+// postThread posts the texts in order, each in reply to the one
+// before it, stopping at the first that fails to be posted.
+func postThread(texts []string, throttle time.Duration) error {
+	return postThreadWith(postTweet, texts, nil, func(int) { time.Sleep(throttle) })
+}
+
+// postThreadWith posts the texts with post as postThread does, the
+// first with the parameters first, e.g. of its media, and calling wait
+// with the index of every text after the first before posting it.
+func postThreadWith(post func(string, url.Values) (anaconda.Tweet, error), texts []string, first url.Values, wait func(i int)) error {
+	var replyTo string
+	for i, text := range texts {
+		params := url.Values{}
+		if i == 0 && first != nil {
+			params = first
+		} else if i > 0 {
+			wait(i)
+		}
+
+		if replyTo != "" {
+			params.Set("in_reply_to_status_id", replyTo)
+		}
+		result, err := post(text, params)
+		if err != nil {
+			return err
+		}
+		replyTo = result.IdStr
+	}
+	return nil
+}
+
+// periodicComparisons posts a comparison thread of the two regions'
+// most popular videos every period, skipping it while cycles are paused.
+func periodicComparisons(period time.Duration, regions []string, top int) chan error {
+	throttle, _ := pacing()
+	tick := time.Tick(period)
+	errsChan := make(chan error)
+	go func() {
+		defer close(errsChan)
+
+		for {
+			<-tick
+
+			a, b := regions[0], regions[1]
+			if paused() {
+				log.Printf("cycles are paused, skipping the comparison of %s and %s\n", a, b)
+				continue
+			}
+			topA, err := fetchRegionTop(a, top)
+			if err != nil {
+				errsChan <- fmt.Errorf("fetching %s: %v", a, err)
+				continue
+			}
+			topB, err := fetchRegionTop(b, top)
+			if err != nil {
+				errsChan <- fmt.Errorf("fetching %s: %v", b, err)
+				continue
+			}
+
+			texts := composeComparison(a, b, topA, topB)
+			log.Printf("comparing %s and %s in %d tweets\n", a, b, len(texts))
+			if err := postThread(texts, throttle); err != nil {
+				errsChan <- err
+			}
+		}
+	}()
+
+	return errsChan
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"sync"
+)
+
+// Twitter counts every link as maxTweetURLLength characters,
+// whatever its length, towards the limit of maxTweetLength.
+const (
+	maxTweetLength    = 280
+	maxTweetURLLength = 23
+)
+
+var tweetURLPattern = regexp.MustCompile(`https?://\S+`)
+
+// tweetLength counts the text as Twitter does: links count as
+// maxTweetURLLength, and characters outside of the Latin and
+// general punctuation ranges, such as CJK and emoji, count twice.
+func tweetLength(text string) int {
+	n := 0
+	for _, r := range tweetURLPattern.ReplaceAllString(text, "") {
+		switch {
+		case r <= 0x10FF, r >= 0x2000 && r <= 0x200D, r >= 0x2010 && r <= 0x201F, r >= 0x2032 && r <= 0x2037:
+			n++
+		default:
+			n += 2
+		}
+	}
+	return n + maxTweetURLLength*len(tweetURLPattern.FindAllStringIndex(text, -1))
+}
+
+// composeTweets renders every tweet of the digest concurrently ahead of
+// posting, so that the posting loop only has to reuse the renderings.
+// The tweets keep their order, and their errors are returned in it.
+func composeTweets(tweets []*tweet) []error {
+	errs := make([]error, len(tweets))
+
+	var wg sync.WaitGroup
+	sem := make(chan bool, runtime.NumCPU())
+	for i, tw := range tweets {
+		wg.Add(1)
+		sem <- true
+		go func(i int, tw *tweet) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if _, err := composeTweet(tw); err != nil {
+				errs[i] = fmt.Errorf("composing #%d %q: %v", tw.Rank, tw.YouTubeId, err)
+			}
+		}(i, tw)
+	}
+	wg.Wait()
+
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/odeke-em/youtube-popular-bot/youtube"
+)
+
+func benchmarkVideo(i int) *youtube.Video {
+	return &youtube.Video{
+		Id:           fmt.Sprintf("video%06d", i),
+		Title:        fmt.Sprintf("The trending video number %d of the chart", i),
+		Description:  "A description long enough to be truncated in the tweet, as those of most videos are.",
+		CategoryId:   "10",
+		ChannelId:    "UC_x5XG1OV2P6uZZ5FSM9Ttw",
+		ChannelTitle: "A channel",
+		ViewCount:    uint64(1234567 * (i + 1)),
+	}
+}
+
+func benchmarkTweets(n int) []*tweet {
+	tweets := make([]*tweet, n)
+	for i := range tweets {
+		tweets[i] = newTweet(benchmarkVideo(i))
+		tweets[i].Rank = uint64(i + 1)
+	}
+	return tweets
+}
+
+func BenchmarkComposeTweet(b *testing.B) {
+	tw := benchmarkTweets(1)[0]
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		// A changed view count forces the tweet to be rendered again.
+		tw.ViewCount++
+		if _, err := composeTweet(tw); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkComposeTweetUnchanged(b *testing.B) {
+	tw := benchmarkTweets(1)[0]
+	if _, err := composeTweet(tw); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := composeTweet(tw); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkComposeTweets(b *testing.B) {
+	tweets := benchmarkTweets(50)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, tw := range tweets {
+			tw.ViewCount++
+		}
+		if errs := composeTweets(tweets); len(errs) > 0 {
+			b.Fatal(errs[0])
+		}
+	}
+}
+
+func BenchmarkComposeIntro(b *testing.B) {
+	data := &introData{Count: 10}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := composeIntro(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
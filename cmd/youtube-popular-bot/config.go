@@ -0,0 +1,936 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultEnvPrefix namespaces the environment variables
+// that the bot is configured with. It can be changed by
+// setting envPrefixKey which is itself never prefixed.
+const (
+	defaultEnvPrefix = "YOUTUBE_TWITTER_BOT_"
+	envPrefixKey     = "YOUTUBE_TWITTER_BOT_ENV_PREFIX"
+)
+
+// maxAPIResultsPerPage is the most items
+// the API returns for a single page.
+const maxAPIResultsPerPage = 50
+
+// config holds every setting of the bot. Each field is read from the
+// environment variable named by its env tag, after the env prefix,
+// falling back to its default tag. Fields tagged required must be set,
+// and those tagged secret are credentials that backups leave out.
+type config struct {
+	ConsumerKey    string `env:"CONSUMER_KEY" required:"true" secret:"true"`
+	ConsumerSecret string `env:"CONSUMER_SECRET" required:"true" secret:"true"`
+	AccessToken    string `env:"ACCESS_TOKEN" required:"true" secret:"true"`
+	AccessSecret   string `env:"ACCESS_SECRET" required:"true" secret:"true"`
+
+	// YouTubeAPIKey if unset falls back to YOUTUBE_API_KEY.
+	YouTubeAPIKey string `env:"API_KEY" secret:"true"`
+
+	// Period is how often a digest is fetched and posted.
+	Period time.Duration `env:"PERIOD" default:"6h"`
+
+	// Schedule if set is a cron expression, e.g. "0 */6 * * *", of
+	// the times at which cycles run instead of every Period, which
+	// then remains the window that each digest covers.
+	Schedule string `env:"SCHEDULE"`
+
+	// ScheduleTimezone is the zone the schedule and the quiet hours
+	// are in, e.g. "America/New_York", by default the local zone.
+	ScheduleTimezone string `env:"SCHEDULE_TIMEZONE"`
+
+	// RunAtStart when set runs a cycle as soon as the bot starts,
+	// rather than at the first scheduled time. Without a schedule
+	// the first cycle always runs at start.
+	RunAtStart bool `env:"RUN_AT_START"`
+
+	// QuietHours are daily windows, e.g. "00:00-07:00", during which
+	// nothing is posted, cycles due in them running once they end.
+	QuietHours []string `env:"QUIET_HOURS"`
+
+	// AnnounceConfigChanges when set posts a note of what the bot now
+	// covers after a reload changes the region, categories, period or
+	// schedule, e.g. "Now covering: Japan, every 4 hours".
+	AnnounceConfigChanges bool `env:"ANNOUNCE_CONFIG_CHANGES"`
+
+	// Jitter if set is the most that each cycle's start is randomly
+	// delayed by, so that instances don't all call the APIs at once.
+	Jitter time.Duration `env:"JITTER"`
+
+	// WatchdogStall is how long the posting loop may go without making
+	// progress before a systemd watchdog is no longer fed.
+	WatchdogStall time.Duration `env:"WATCHDOG_STALL" default:"15m"`
+
+	// Throttle is the pause between consecutive tweets.
+	Throttle time.Duration `env:"THROTTLE" default:"15s"`
+
+	// MaxPages and MaxResultsPerPage control how many videos
+	// are fetched, of which at most MaxPosts are tweeted.
+	// A MaxPosts of 0 tweets every fetched video.
+	MaxPages          int `env:"MAX_PAGES" default:"2"`
+	MaxResultsPerPage int `env:"MAX_RESULTS_PER_PAGE" default:"10"`
+	MaxPosts          int `env:"MAX_POSTS" default:"0"`
+
+	// Spotlight when set posts, after every digest, a hidden gem: one of
+	// the fastest gaining videos of those fetched beyond MaxPosts.
+	Spotlight bool `env:"SPOTLIGHT"`
+
+	// BatchSize if non-zero splits digests of more videos into batches
+	// of that many, spread evenly over the period.
+	BatchSize int `env:"BATCH_SIZE"`
+
+	// MinDuration if non-zero drops the fetched videos that are shorter,
+	// e.g. Shorts.
+	MinDuration time.Duration `env:"MIN_DURATION"`
+
+	// MinViews if non-zero drops the fetched videos with fewer views.
+	MinViews int `env:"MIN_VIEWS"`
+
+	// Optional UTM parameters appended to every video link so
+	// that traffic from the bot can be attributed in analytics.
+	UTMSource   string `env:"UTM_SOURCE"`
+	UTMMedium   string `env:"UTM_MEDIUM"`
+	UTMCampaign string `env:"UTM_CAMPAIGN"`
+
+	// CheckLinks when set verifies that every video
+	// link resolves before its tweet is posted.
+	CheckLinks bool `env:"CHECK_LINKS"`
+
+	// RecheckAvailability when set re-queries each video's status
+	// right before posting and skips those that have since been
+	// deleted or made private.
+	RecheckAvailability bool `env:"RECHECK_AVAILABILITY"`
+
+	// ArchiveDir if set is where the metadata of every
+	// posted video is mirrored, surviving takedowns.
+	ArchiveDir string `env:"ARCHIVE_DIR"`
+
+	// SnapshotDir if set is where every fetched chart is kept, whether
+	// or not it is posted, as a dataset of what trended over time.
+	SnapshotDir string `env:"SNAPSHOT_DIR"`
+
+	// ArchiveThumbnails when set also permanently saves the
+	// thumbnail of every posted video into ArchiveDir.
+	ArchiveThumbnails bool `env:"ARCHIVE_THUMBNAILS"`
+
+	// AttachThumbnails when set uploads each video's thumbnail
+	// and attaches it to that video's tweet. Uploads are done
+	// ahead of posting by at most MediaConcurrency workers.
+	AttachThumbnails bool `env:"ATTACH_THUMBNAILS"`
+	MediaConcurrency int  `env:"MEDIA_CONCURRENCY" default:"4"`
+
+	// ThumbnailQuality is the preferred quality of thumbnails, one of
+	// "maxres", "standard", "high", "medium" or "default". Videos
+	// without it fall back to their next smaller thumbnail.
+	ThumbnailQuality string `env:"THUMBNAIL_QUALITY" default:"maxres"`
+
+	// RankChanges when set marks every video with how it moved on the
+	// chart since the last cycle's fetch: "▲3", "▼1" or "NEW".
+	RankChanges bool `env:"RANK_CHANGES"`
+
+	// NewEntrantsOnly when set only posts the videos that weren't on
+	// the chart that the last cycle fetched, skipping digests that
+	// would have none.
+	NewEntrantsOnly bool `env:"NEW_ENTRANTS_ONLY"`
+
+	// RankByVelocity when set orders videos by the views they gained per
+	// hour since the last cycle's fetch, or since they were published if
+	// they weren't on its chart, rather than by their place on the chart.
+	RankByVelocity bool `env:"RANK_BY_VELOCITY"`
+
+	// RichRanks if non-zero is how many of the top ranks get media and
+	// full stats, lower ranks being posted as compact text only.
+	RichRanks int `env:"RICH_RANKS"`
+
+	// EngagementWeighting when set re-ranks videos by weights, learnt
+	// from the favorites and retweets of earlier tweets, of how well
+	// each category does with the account's followers.
+	EngagementWeighting bool `env:"ENGAGEMENT_WEIGHTING"`
+
+	// StateDir if set is where the bot persists
+	// state that must survive restarts.
+	StateDir string `env:"STATE_DIR"`
+
+	// HistoryDB if set is the path of the SQLite database in which
+	// every tweet posted about a video is recorded, for builds with
+	// the sqlite tag. DedupTTL also goes by it, and monthly recaps
+	// and custom posts are drawn from it.
+	HistoryDB string `env:"HISTORY_DB"`
+
+	// DryRun when set fetches and composes every tweet but only logs
+	// what would be posted, without recording any video as posted.
+	DryRun bool `env:"DRY_RUN"`
+
+	// Once when set runs a single cycle and exits, with a non-zero
+	// status if anything failed, for cron and other schedulers.
+	Once bool `env:"ONCE"`
+
+	// Store is where snapshots, posted videos, the queue, costs and
+	// the last run are kept: "file" for the state directory, "memory",
+	// or the databases "sqlite", "postgres", "bolt" and "redis" of builds
+	// with their tags. By default it is "file" if there is a state directory.
+	Store string `env:"STORE"`
+
+	// StoreDSN is the database of the store, e.g. a Postgres or Redis URL. The
+	// SQLite and Bolt stores default to a file in the state directory.
+	StoreDSN string `env:"STORE_DSN" secret:"true"`
+
+	// BotName if set names the bot among the bots that share a store,
+	// which keep their state apart by name. Videos of ClaimCategories
+	// and ClaimChannels are claimed by the bot, and the other bots that
+	// share the store leave them out of their digests until the bot
+	// hasn't refreshed its claims for ClaimsTTL.
+	BotName         string        `env:"BOT_NAME"`
+	ClaimCategories []string      `env:"CLAIM_CATEGORIES"`
+	ClaimChannels   []string      `env:"CLAIM_CHANNELS"`
+	ClaimsTTL       time.Duration `env:"CLAIMS_TTL" default:"24h"`
+
+	// SeedPosted when set marks the videos on the chart as posted
+	// the first time the bot runs with a state directory, so that
+	// it doesn't repost what followers of a stateless bot just saw.
+	SeedPosted bool `env:"SEED_POSTED" default:"true"`
+
+	// PinIntro when set pins every cycle's intro tweet
+	// to the profile, unpinning the previous cycle's.
+	PinIntro bool `env:"PIN_INTRO"`
+
+	// ReportPeriod if non-zero is how often a performance report
+	// of the bot's account is direct messaged to Operator.
+	ReportPeriod time.Duration `env:"REPORT_PERIOD"`
+	Operator     string        `env:"OPERATOR"`
+
+	// MonitorAccessToken and MonitorAccessSecret if set are those of a
+	// private account, authorized for the bot's consumer key, that a
+	// heartbeat of how every cycle ended is tweeted to, or else the
+	// heartbeat is direct messaged to MonitorScreenName if set.
+	MonitorAccessToken  string `env:"MONITOR_ACCESS_TOKEN" secret:"true"`
+	MonitorAccessSecret string `env:"MONITOR_ACCESS_SECRET" secret:"true"`
+	MonitorScreenName   string `env:"MONITOR_SCREEN_NAME"`
+
+	// RecapSchedule if set is a cron expression, e.g. "0 18 31 12 *",
+	// of when to post a recap thread of the year's standout videos out
+	// of the archived digests, once the Operator approves its preview.
+	RecapSchedule string `env:"RECAP_SCHEDULE"`
+
+	// LeaderboardSchedule if set is a cron expression, e.g. "0 12 1 * *",
+	// of when to post the channels with the most videos in the month's
+	// archived digests.
+	LeaderboardSchedule string `env:"LEADERBOARD_SCHEDULE"`
+
+	// MonthlyRecapSchedule if set is a cron expression, e.g.
+	// "0 12 1 * *", of when to post a thread of the month's top videos
+	// out of the history database, with a collage of their thumbnails
+	// from the archive if MonthlyRecapImage is set.
+	MonthlyRecapSchedule string `env:"MONTHLY_RECAP_SCHEDULE"`
+	MonthlyRecapImage    bool   `env:"MONTHLY_RECAP_IMAGE"`
+
+	// WeeklyDigestSchedule if set is a cron expression, e.g.
+	// "0 18 * * 0", of when to post a thread of the top videos of the
+	// week's snapshots, up to then.
+	WeeklyDigestSchedule string `env:"WEEKLY_DIGEST_SCHEDULE"`
+
+	// CategoryChartSchedule if set is a cron expression, e.g.
+	// "0 12 1 * *", of when to post a chart of the categories' daily
+	// shares of the month's archived digests.
+	CategoryChartSchedule string `env:"CATEGORY_CHART_SCHEDULE"`
+
+	// CustomPostsFile if set is a JSON list of custom posts, each with
+	// a name, a cron schedule, a SELECT query over the history database
+	// and a template that is rendered from the query's rows and posted.
+	CustomPostsFile string `env:"CUSTOM_POSTS_FILE"`
+
+	// DigestTTL if non-zero is how old fetched data may get before
+	// the not yet posted tweets are refreshed from the API, so that
+	// delayed posts don't carry stale view counts.
+	DigestTTL time.Duration `env:"DIGEST_TTL"`
+
+	// RefreshBeforeCompose when set re-fetches the statistics of the
+	// selected videos right before posting starts, so that posted view
+	// counts are not as old as the pagination and media uploads.
+	RefreshBeforeCompose bool `env:"REFRESH_BEFORE_COMPOSE"`
+
+	// CategoryShards if set are the category ids whose most popular
+	// charts are fetched and merged into one candidate pool instead
+	// of using the single mixed chart.
+	CategoryShards []string `env:"CATEGORY_SHARDS"`
+
+	// PicksFile if set names a JSON or CSV list of videos that editors
+	// picked, re-read every cycle and merged into the fetched videos.
+	PicksFile string `env:"PICKS_FILE"`
+
+	// RegionAccountsFile if set is a JSON list of regions, each with the
+	// credentials of an account to which the region's trending videos
+	// are posted on a schedule of its own.
+	RegionAccountsFile string `env:"REGION_ACCOUNTS_FILE"`
+
+	// IncludeCategories if set are the only category ids whose videos
+	// are posted, and videos of ExcludeCategories are never posted.
+	IncludeCategories []string `env:"INCLUDE_CATEGORIES"`
+	ExcludeCategories []string `env:"EXCLUDE_CATEGORIES"`
+
+	// AllowedChannels if set are the ids of the only channels whose
+	// videos are posted, and videos of BlockedChannels are never posted.
+	AllowedChannels []string `env:"ALLOWED_CHANNELS"`
+	BlockedChannels []string `env:"BLOCKED_CHANNELS"`
+
+	// BlockedKeywords and BlockedPatterns, regular expressions, drop the
+	// videos whose title or description mentions or matches any of them.
+	BlockedKeywords []string `env:"BLOCKED_KEYWORDS"`
+	BlockedPatterns []string `env:"BLOCKED_PATTERNS"`
+
+	// Languages if set are the language codes of the only videos posted,
+	// judged by their default audio language or else that of their metadata.
+	Languages []string `env:"LANGUAGES"`
+
+	// RegionCode if set restricts fetched videos to that country. If
+	// the country has no most popular chart, its most viewed videos
+	// are searched for instead.
+	RegionCode string `env:"REGION_CODE"`
+
+	// DedupTTL if non-zero is how long after posting a video it is
+	// left out of digests, e.g. 48h, for videos that stay trending.
+	DedupTTL time.Duration `env:"DEDUP_TTL"`
+
+	// MinPartialResults is the fewest videos a fetch that failed part
+	// way through pagination must have produced for the cycle to go
+	// ahead with them rather than falling back to another source.
+	MinPartialResults int `env:"MIN_PARTIAL_RESULTS" default:"1"`
+
+	// PostHookURLs and PostHookCommands are notified, with a
+	// JSON description, of every post that was published.
+	PostHookURLs     []string `env:"POST_HOOK_URLS"`
+	PostHookCommands []string `env:"POST_HOOK_COMMANDS"`
+
+	// PublisherOptionsFile if set is a JSON object of the options, by
+	// hook, of the platform that each hook mirrors posts to, such as
+	// the visibility of Mastodon statuses or Bluesky labels.
+	PublisherOptionsFile string `env:"PUBLISHER_OPTIONS_FILE"`
+
+	// Crosslink when set gives hooks that mirror posts
+	// elsewhere the text to post linking back to Twitter.
+	Crosslink bool `env:"CROSSLINK"`
+
+	// RequireApproval when set sends every composed digest to the
+	// Operator and only posts it once approved. Digests that are
+	// neither approved nor rejected within ApprovalTimeout are
+	// posted or skipped according to ApprovalTimeoutAction.
+	RequireApproval       bool          `env:"REQUIRE_APPROVAL"`
+	ApprovalTimeout       time.Duration `env:"APPROVAL_TIMEOUT" default:"1h"`
+	ApprovalTimeoutAction string        `env:"APPROVAL_TIMEOUT_ACTION" default:"skip"`
+
+	// AdminAddr if set is the address, e.g. "localhost:8080", on
+	// which the operator's web dashboard is served.
+	AdminAddr string `env:"ADMIN_ADDR"`
+
+	// SiteAddr if set is the address on which the permalink page of
+	// every digest, archived in ArchiveDir, is publicly served. If
+	// SiteURL, the address at which followers reach the site, is set
+	// the intro of every digest links to its page.
+	SiteAddr string `env:"SITE_ADDR"`
+	SiteURL  string `env:"SITE_URL"`
+
+	// LinkInBioFile and LinkInBioPushURL if set are where every cycle
+	// writes and PUTs a page of its videos, for the link in the bio of
+	// the bot's accounts, which the site also serves at /links.
+	LinkInBioFile    string `env:"LINK_IN_BIO_FILE"`
+	LinkInBioPushURL string `env:"LINK_IN_BIO_PUSH_URL"`
+
+	// AdminTokens may view and change everything served on AdminAddr
+	// while ViewerTokens may only view it.
+	AdminTokens  []string `env:"ADMIN_TOKENS" secret:"true"`
+	ViewerTokens []string `env:"VIEWER_TOKENS" secret:"true"`
+
+	// WebhookSecret if set lets external systems POST to /webhook on
+	// AdminAddr, signing the body with it, to run a cycle or to post a
+	// digest of the WebhookTop videos of a region or of a search.
+	WebhookSecret string `env:"WEBHOOK_SECRET" secret:"true"`
+	WebhookTop    int    `env:"WEBHOOK_TOP" default:"5"`
+
+	// TwitterProxy and TwitterLocalAddr route traffic to Twitter
+	// through that proxy and from that local address, instead of
+	// the process wide HTTP_PROXY settings and default route.
+	TwitterProxy     string `env:"TWITTER_PROXY" secret:"true"`
+	TwitterLocalAddr string `env:"TWITTER_LOCAL_ADDR"`
+
+	// AnswerMentions when set checks for mentions of the bot every
+	// MentionsInterval and acts on the commands that they carry,
+	// keeping the last mention answered under StateDir.
+	AnswerMentions   bool          `env:"ANSWER_MENTIONS"`
+	MentionsInterval time.Duration `env:"MENTIONS_INTERVAL" default:"2m"`
+
+	// RegionCacheTTL is how long the videos trending in a region
+	// are reused when answering "what's trending in <country>?".
+	RegionCacheTTL time.Duration `env:"REGION_CACHE_TTL" default:"30m"`
+
+	// SubscriberDMs when set direct messages every digest to the
+	// users that subscribed by mentioning the bot with "subscribe",
+	// sending one message every DMInterval.
+	SubscriberDMs bool          `env:"SUBSCRIBER_DMS"`
+	DMInterval    time.Duration `env:"DM_INTERVAL" default:"5s"`
+
+	// TemplatesFile if set is a file of text/template definitions
+	// that override the default templates of the posted texts.
+	TemplatesFile string `env:"TEMPLATES_FILE"`
+
+	// Locale is the language whose plurals and ordinals
+	// the templates' plural and ordinal helpers use.
+	Locale string `env:"LOCALE" default:"en"`
+
+	// PolicyFile if set is a JSON content policy whose rules decide
+	// which videos may be posted and label them. Every decision is
+	// appended to PolicyLog if that is set.
+	PolicyFile string `env:"POLICY_FILE"`
+	PolicyLog  string `env:"POLICY_LOG"`
+
+	// SafeMode when set starts the bot in safe mode, which the operator
+	// can also switch on and off from the dashboard, for sensitive
+	// events. In safe mode videos of SafeModeCategories, News &
+	// Politics by default, are only posted from SafeModeChannels.
+	SafeMode           bool     `env:"SAFE_MODE"`
+	SafeModeCategories []string `env:"SAFE_MODE_CATEGORIES" default:"25"`
+	SafeModeChannels   []string `env:"SAFE_MODE_CHANNELS"`
+
+	// ShadowPolicyFile if set is a content policy that is evaluated
+	// alongside the live one, logging how its decisions would have
+	// differed without affecting what gets posted.
+	ShadowPolicyFile string `env:"SHADOW_POLICY_FILE"`
+
+	// ChaosDropRate and ChaosThrottleRate are the fractions, between 0
+	// and 1, of calls to YouTube and Twitter that fail with a synthetic
+	// network error and a synthetic 429 respectively. Only for staging.
+	ChaosDropRate     float64 `env:"CHAOS_DROP_RATE"`
+	ChaosThrottleRate float64 `env:"CHAOS_THROTTLE_RATE"`
+
+	// EventBroker if set is "kafka" or "nats", for builds with those
+	// tags, to whose EventTopic every cycle's snapshot, posts and
+	// errors are published as JSON. EventBrokerURL is where the broker
+	// is, e.g. the comma separated brokers of Kafka.
+	EventBroker    string `env:"EVENT_BROKER"`
+	EventBrokerURL string `env:"EVENT_BROKER_URL" secret:"true"`
+	EventTopic     string `env:"EVENT_TOPIC" default:"youtube-popular-bot"`
+
+	// WatchChannels if set are the ids of channels whose uploads are
+	// posted as soon as YouTube pushes them, through subscriptions to
+	// its WebSub hub. The hub calls back WebSubURL, the public URL at
+	// which the callback that is served on WebSubAddr is reached.
+	WatchChannels []string `env:"WATCH_CHANNELS"`
+	WebSubAddr    string   `env:"WEBSUB_ADDR"`
+	WebSubURL     string   `env:"WEBSUB_URL"`
+
+	// ComparePeriod if non-zero is how often a thread comparing
+	// the CompareTop most popular videos of the two CompareRegions
+	// is posted, highlighting the videos trending in both.
+	ComparePeriod  time.Duration `env:"COMPARE_PERIOD"`
+	CompareRegions []string      `env:"COMPARE_REGIONS"`
+	CompareTop     int           `env:"COMPARE_TOP" default:"5"`
+
+	// The schedules above, parsed by validate.
+	schedule, recapSchedule, leaderboardSchedule, categoryChartSchedule,
+	monthlyRecapSchedule, weeklyDigestSchedule *schedule
+	// BlockedPatterns, compiled by validate.
+	blockedPatterns []*regexp.Regexp
+}
+
+var cfg config
+
+// envPrefix returns the prefix of the bot's environment variables.
+func envPrefix() string {
+	if prefix, ok := os.LookupEnv(envPrefixKey); ok {
+		return prefix
+	}
+	return defaultEnvPrefix
+}
+
+// loadConfig populates c from the environment variables named by its
+// fields' env tags, falling back to the values from the config file,
+// keyed by env tag, and then to the defaults. Every value that could
+// not be parsed and every required value that is missing is appended
+// to errMsgs.
+func loadConfig(c *config, prefix string, fileValues map[string]string) (errMsgs []string) {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		key := prefix + name
+
+		value, set := os.LookupEnv(key)
+		value = strings.TrimSpace(value)
+		if !set || value == "" {
+			value, set = fileValues[name]
+		}
+		if !set || value == "" {
+			if field.Tag.Get("required") == "true" {
+				errMsgs = append(errMsgs, fmt.Sprintf("%q is not defined", key))
+				continue
+			}
+			value = field.Tag.Get("default")
+		}
+
+		if err := setField(v.Field(i), value); err != nil {
+			errMsgs = append(errMsgs, fmt.Sprintf("%q: %v", key, err))
+		}
+	}
+
+	c.RegionCode = strings.ToUpper(c.RegionCode)
+	for i, code := range c.CompareRegions {
+		c.CompareRegions[i] = strings.ToUpper(code)
+	}
+
+	return errMsgs
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setField parses value into the field according to its type.
+func setField(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		if value == "" {
+			field.SetInt(0)
+			return nil
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		if value == "" {
+			field.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		if value == "" {
+			field.SetInt(0)
+			return nil
+		}
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	case reflect.Float64:
+		if value == "" {
+			field.SetFloat(0)
+			return nil
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported field type %s", field.Type())
+		}
+		field.Set(reflect.ValueOf(splitList(value)))
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+// splitList splits a comma separated value into its
+// non-empty, whitespace trimmed elements.
+func splitList(value string) []string {
+	var list []string
+	for _, elem := range strings.Split(value, ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			list = append(list, elem)
+		}
+	}
+	return list
+}
+
+// validate checks the settings against each other and
+// returns every problem found, rather than just the first one.
+func (c *config) validate() []string {
+	var problems []string
+	problemf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Period <= 0 {
+		problemf("period must be positive, got %s", c.Period)
+	}
+	if c.Throttle < 0 {
+		problemf("throttle must not be negative, got %s", c.Throttle)
+	}
+	if c.Throttle >= c.Period {
+		problemf("throttle (%s) must be shorter than the period (%s)", c.Throttle, c.Period)
+	}
+
+	var err error
+	if c.Schedule != "" {
+		if c.schedule, err = parseSchedule(c.Schedule, c.ScheduleTimezone); err != nil {
+			problemf("%v", err)
+		}
+	} else if c.ScheduleTimezone != "" && len(c.QuietHours) == 0 &&
+		c.RecapSchedule == "" && c.LeaderboardSchedule == "" && c.CategoryChartSchedule == "" &&
+		c.WeeklyDigestSchedule == "" && c.MonthlyRecapSchedule == "" && c.CustomPostsFile == "" && c.RegionAccountsFile == "" {
+		problemf("a schedule timezone requires a schedule, quiet hours, custom posts, region accounts or a recap, leaderboard, category chart, weekly digest or monthly recap schedule")
+	}
+	if _, err := parseQuietHours(c.QuietHours, c.ScheduleTimezone); err != nil {
+		problemf("%v", err)
+	}
+
+	if c.HistoryDB != "" && !historyAvailable() {
+		problemf("a history database needs a build with the sqlite tag, e.g. go build -tags sqlite")
+	}
+
+	if c.DedupTTL < 0 || c.DedupTTL > maxPostedAge {
+		problemf("dedup TTL must be between 0 and %s, got %s", maxPostedAge, c.DedupTTL)
+	}
+
+	if (c.MonitorAccessToken == "") != (c.MonitorAccessSecret == "") {
+		problemf("the monitoring account needs both its access token and secret")
+	}
+	if c.MonitorAccessToken != "" && c.MonitorScreenName != "" {
+		problemf("heartbeats go either to the monitoring account or to a screen name, not both")
+	}
+	if c.WatchdogStall <= 0 {
+		problemf("watchdog stall must be positive, got %s", c.WatchdogStall)
+	}
+	if c.Jitter < 0 || c.Jitter >= c.Period {
+		problemf("jitter must be between 0 and the period (%s), got %s", c.Period, c.Jitter)
+	}
+
+	if c.MaxPages < 1 {
+		problemf("max pages must be at least 1, got %d", c.MaxPages)
+	}
+	if c.MaxResultsPerPage < 1 || c.MaxResultsPerPage > maxAPIResultsPerPage {
+		problemf("max results per page must be between 1 and %d, got %d", maxAPIResultsPerPage, c.MaxResultsPerPage)
+	}
+
+	capacity := c.MaxPages * c.MaxResultsPerPage
+	if c.MaxPosts < 0 {
+		problemf("max posts must not be negative, got %d", c.MaxPosts)
+	}
+	if c.Spotlight && (c.MaxPosts == 0 || c.MaxPosts >= capacity) {
+		problemf("a spotlight needs max posts below the %d videos fetched, to pick from those beyond", capacity)
+	}
+	if c.MinDuration < 0 {
+		problemf("min duration must not be negative, got %s", c.MinDuration)
+	}
+	if c.MinViews < 0 {
+		problemf("min views must not be negative, got %d", c.MinViews)
+	}
+	if c.MaxPosts > capacity {
+		problemf("max posts (%d) exceeds the %d videos that %d pages of %d results can hold",
+			c.MaxPosts, capacity, c.MaxPages, c.MaxResultsPerPage)
+	}
+
+	posts := capacity
+	if c.MaxPosts > 0 {
+		posts = c.MaxPosts
+	}
+	if postingTime := time.Duration(posts) * c.Throttle; c.Period > 0 && postingTime >= c.Period {
+		problemf("posting %d tweets %s apart takes %s which doesn't fit in the period (%s)",
+			posts, c.Throttle, postingTime, c.Period)
+	}
+	if c.BatchSize < 0 {
+		problemf("batch size must not be negative, got %d", c.BatchSize)
+	}
+	if c.BatchSize > 0 && posts > c.BatchSize && c.Period > 0 {
+		batches := (posts + c.BatchSize - 1) / c.BatchSize
+		if gap, postingTime := c.Period/time.Duration(batches), time.Duration(c.BatchSize)*c.Throttle; postingTime >= gap {
+			problemf("posting batches of %d tweets %s apart takes %s which doesn't fit in the %s between the %d batches",
+				c.BatchSize, c.Throttle, postingTime, gap, batches)
+		}
+	}
+
+	if c.MinPartialResults < 0 || c.MinPartialResults > capacity {
+		problemf("min partial results must be between 0 and %d, got %d", capacity, c.MinPartialResults)
+	}
+	if c.AttachThumbnails && c.MediaConcurrency < 1 {
+		problemf("media concurrency must be at least 1 when attaching thumbnails, got %d", c.MediaConcurrency)
+	}
+	if !validLocale(c.Locale) {
+		problemf("locale must be one of %s, got %q", strings.Join(locales, ", "), c.Locale)
+	}
+	if !validThumbnailQuality(c.ThumbnailQuality) {
+		problemf("thumbnail quality must be one of %s, got %q",
+			strings.Join(thumbnailQualities, ", "), c.ThumbnailQuality)
+	}
+	if c.EngagementWeighting && c.StateDir == "" {
+		problemf("engagement weighting requires a state directory")
+	}
+	if c.RichRanks < 0 {
+		problemf("rich ranks must not be negative, got %d", c.RichRanks)
+	}
+	if c.ArchiveThumbnails && c.ArchiveDir == "" {
+		problemf("archiving thumbnails requires an archive directory")
+	}
+	switch c.Store {
+	case "", storeMemory:
+	case storeFile:
+		if c.StateDir == "" {
+			problemf("the %q store requires a state directory", c.Store)
+		}
+	case storeSQLite, storePostgres, storeBolt, storeRedis:
+		if _, ok := storeBackends[c.Store]; !ok {
+			tag := storeBuildTags[c.Store]
+			problemf("the %q store needs a build with the %s tag, e.g. go build -tags %s", c.Store, tag, tag)
+		}
+		if c.StoreDSN == "" && (c.Store == storePostgres || c.Store == storeRedis || c.StateDir == "") {
+			problemf("the %q store requires a DSN", c.Store)
+		}
+	default:
+		problemf("store must be %q, %q, %q, %q, %q or %q, got %q",
+			storeMemory, storeFile, storeSQLite, storePostgres, storeBolt, storeRedis, c.Store)
+	}
+	for _, category := range c.ExcludeCategories {
+		if anyEqualFold(c.IncludeCategories, category) {
+			problemf("category %q is both included and excluded", category)
+		}
+	}
+	if c.blockedPatterns, err = compilePatterns(c.BlockedPatterns); err != nil {
+		problemf("invalid blocked pattern: %v", err)
+	}
+	for _, channel := range c.BlockedChannels {
+		if anyEqualFold(c.AllowedChannels, channel) {
+			problemf("channel %q is both allowed and blocked", channel)
+		}
+	}
+	if (len(c.ClaimCategories) > 0 || len(c.ClaimChannels) > 0) && c.BotName == "" {
+		problemf("claiming videos requires a bot name for the other bots to know the claims by")
+	}
+	if c.BotName != "" && c.Store != storeSQLite && c.Store != storePostgres && c.Store != storeRedis {
+		problemf("a bot name is for bots that share a store, which must be %q, %q or %q, got %q", storeSQLite, storePostgres, storeRedis, c.Store)
+	}
+	if c.BotName != "" && c.ClaimsTTL < 3*time.Minute {
+		problemf("claims TTL must be at least 3m, got %s", c.ClaimsTTL)
+	}
+
+	if c.DigestTTL < 0 {
+		problemf("digest TTL must not be negative, got %s", c.DigestTTL)
+	}
+	if c.ReportPeriod < 0 {
+		problemf("report period must not be negative, got %s", c.ReportPeriod)
+	}
+
+	if c.RequireApproval {
+		if c.Operator == "" {
+			problemf("requiring approval needs an operator to approve digests")
+		}
+		if c.ApprovalTimeout >= c.Period {
+			problemf("approval timeout (%s) must be shorter than the period (%s)", c.ApprovalTimeout, c.Period)
+		}
+	}
+	if c.RecapSchedule != "" {
+		if c.recapSchedule, err = parseSchedule(c.RecapSchedule, c.ScheduleTimezone); err != nil {
+			problemf("recap %v", err)
+		}
+		if c.ArchiveDir == "" {
+			problemf("recaps need an archive directory to mine the digests of")
+		}
+		if c.Operator == "" {
+			problemf("recaps need an operator to approve them")
+		}
+	}
+	if c.LeaderboardSchedule != "" {
+		if c.leaderboardSchedule, err = parseSchedule(c.LeaderboardSchedule, c.ScheduleTimezone); err != nil {
+			problemf("leaderboard %v", err)
+		}
+		if c.ArchiveDir == "" {
+			problemf("leaderboards need an archive directory to mine the digests of")
+		}
+	}
+	if c.CategoryChartSchedule != "" {
+		if c.categoryChartSchedule, err = parseSchedule(c.CategoryChartSchedule, c.ScheduleTimezone); err != nil {
+			problemf("category chart %v", err)
+		}
+		if c.ArchiveDir == "" {
+			problemf("category charts need an archive directory to mine the digests of")
+		}
+	}
+	if c.MonthlyRecapSchedule != "" {
+		if c.monthlyRecapSchedule, err = parseSchedule(c.MonthlyRecapSchedule, c.ScheduleTimezone); err != nil {
+			problemf("monthly recap %v", err)
+		}
+		if c.HistoryDB == "" {
+			problemf("monthly recaps need a history database to rank the month's videos")
+		}
+	}
+	if c.MonthlyRecapImage && c.ArchiveDir == "" {
+		problemf("monthly recap images need an archive directory for the videos' thumbnails")
+	}
+	if c.WeeklyDigestSchedule != "" {
+		if c.weeklyDigestSchedule, err = parseSchedule(c.WeeklyDigestSchedule, c.ScheduleTimezone); err != nil {
+			problemf("weekly digest %v", err)
+		}
+		if c.SnapshotDir == "" {
+			problemf("weekly digests need a snapshot directory to mine the charts of")
+		}
+	}
+	if c.CustomPostsFile != "" && c.HistoryDB == "" {
+		problemf("custom posts need a history database to query")
+	}
+	if c.RequireApproval || c.RecapSchedule != "" {
+		if c.ApprovalTimeout <= 0 {
+			problemf("approval timeout must be positive, got %s", c.ApprovalTimeout)
+		}
+		if a := c.ApprovalTimeoutAction; a != approvalTimeoutPost && a != approvalTimeoutSkip {
+			problemf("approval timeout action must be %q or %q, got %q", approvalTimeoutPost, approvalTimeoutSkip, a)
+		}
+	}
+
+	if c.AnswerMentions && c.MentionsInterval < time.Minute {
+		problemf("mentions interval must be at least 1m to stay within rate limits, got %s", c.MentionsInterval)
+	}
+	if c.AnswerMentions && c.StateDir == "" {
+		problemf("answering mentions requires a state directory, which keeps the last mention answered and the subscribers")
+	}
+	if c.SubscriberDMs && !c.AnswerMentions {
+		problemf("direct messaging subscribers requires answering mentions, which is how users subscribe")
+	}
+	if c.DMInterval < 0 {
+		problemf("direct message interval must not be negative, got %s", c.DMInterval)
+	}
+
+	if c.AdminAddr != "" && len(c.AdminTokens) == 0 {
+		problemf("serving the dashboard requires at least one admin token")
+	}
+	if c.WebhookSecret != "" {
+		if c.AdminAddr == "" {
+			problemf("the webhook is served on the admin address, which is unset")
+		}
+		if c.WebhookTop < 1 || c.WebhookTop > maxAPIResultsPerPage {
+			problemf("webhook top must be between 1 and %d, got %d", maxAPIResultsPerPage, c.WebhookTop)
+		}
+	}
+	if (c.SiteAddr != "" || c.SiteURL != "") && c.ArchiveDir == "" {
+		problemf("digest permalink pages require an archive directory")
+	}
+	if c.SiteURL != "" {
+		if u, err := url.Parse(c.SiteURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problemf("site URL must be an absolute http(s) URL, got %q", c.SiteURL)
+		}
+	}
+	if c.LinkInBioPushURL != "" {
+		if u, err := url.Parse(c.LinkInBioPushURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problemf("link in bio push URL must be an absolute http(s) URL, got %q", c.LinkInBioPushURL)
+		}
+	}
+
+	if _, err := newEgressClient(c.TwitterProxy, c.TwitterLocalAddr); err != nil {
+		problemf("twitter egress: %v", err)
+	}
+
+	if c.ChaosDropRate < 0 || c.ChaosThrottleRate < 0 || c.ChaosDropRate+c.ChaosThrottleRate > 1 {
+		problemf("chaos drop rate (%v) and throttle rate (%v) must be fractions that add up to at most 1",
+			c.ChaosDropRate, c.ChaosThrottleRate)
+	}
+
+	switch c.EventBroker {
+	case "":
+	case brokerKafka, brokerNATS:
+		if _, ok := eventBrokers[c.EventBroker]; !ok {
+			problemf("publishing events to %s needs a build with the %s tag, e.g. go build -tags %s", c.EventBroker, c.EventBroker, c.EventBroker)
+		}
+		if c.EventBrokerURL == "" || c.EventTopic == "" {
+			problemf("publishing events requires the broker's URL and a topic")
+		}
+	default:
+		problemf("event broker must be %q or %q, got %q", brokerKafka, brokerNATS, c.EventBroker)
+	}
+
+	if len(c.WatchChannels) > 0 {
+		if c.WebSubAddr == "" {
+			problemf("watching channels requires a websub address to serve the hub's callback on")
+		}
+		if u, err := url.Parse(c.WebSubURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problemf("websub URL must be an absolute http(s) URL, got %q", c.WebSubURL)
+		}
+	}
+
+	if c.RegionCode != "" {
+		if _, ok := countryNames[c.RegionCode]; !ok {
+			problemf("unknown region %q, expecting an ISO 3166-1 alpha-2 code such as GB", c.RegionCode)
+		}
+	}
+	if c.ComparePeriod < 0 {
+		problemf("compare period must not be negative, got %s", c.ComparePeriod)
+	}
+	if c.ComparePeriod > 0 {
+		if len(c.CompareRegions) != 2 {
+			problemf("comparing needs exactly 2 regions, got %d", len(c.CompareRegions))
+		}
+		for _, code := range c.CompareRegions {
+			if _, ok := countryNames[code]; !ok {
+				problemf("unknown compare region %q", code)
+			}
+		}
+		if c.CompareTop < 1 || c.CompareTop > maxAPIResultsPerPage {
+			problemf("compare top must be between 1 and %d, got %d", maxAPIResultsPerPage, c.CompareTop)
+		}
+	}
+
+	if !c.twitterEnabled() {
+		problemf("no publisher is enabled, Twitter credentials are incomplete")
+	}
+
+	return problems
+}
+
+func (c *config) twitterEnabled() bool {
+	return c.ConsumerKey != "" && c.ConsumerSecret != "" &&
+		c.AccessToken != "" && c.AccessSecret != ""
+}
+
+// envLines formats c as shell export statements of the environment
+// variables that loadConfig would read it back from. Without secrets
+// the credentials are left as commented out placeholders to fill in.
+func envLines(c *config, prefix string, secrets bool) []string {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	var lines []string
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("env")
+		if name == "" {
+			continue
+		}
+
+		if !secrets && t.Field(i).Tag.Get("secret") == "true" {
+			lines = append(lines, fmt.Sprintf("# export %s%s=''", prefix, name))
+			continue
+		}
+
+		field := v.Field(i)
+		var value string
+		switch {
+		case field.Type() == durationType:
+			value = time.Duration(field.Int()).String()
+		case field.Kind() == reflect.Slice:
+			value = strings.Join(field.Interface().([]string), ",")
+		default:
+			value = fmt.Sprint(field.Interface())
+		}
+		lines = append(lines, fmt.Sprintf("export %s%s='%s'", prefix, name, strings.Replace(value, "'", `'\''`, -1)))
+	}
+	return lines
+}
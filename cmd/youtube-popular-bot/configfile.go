@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// parseConfigFile reads the flat settings of a TOML or YAML config
+// file, chosen by its extension, keyed by the env tags of the fields
+// they set. Keys are the lower cased env names e.g "max_pages", and
+// lists are written as ["a", "b"] in either format or, in YAML, as
+// "- a" lines under their key. Nested tables and maps aren't supported.
+func parseConfigFile(path string) (map[string]string, error) {
+	var sep string
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".toml":
+		sep = "="
+	case ".yaml", ".yml":
+		sep = ":"
+	default:
+		return nil, fmt.Errorf("config file %q: unsupported format %q, expecting .toml, .yaml or .yml", path, ext)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	known := map[string]bool{}
+	t := reflect.TypeOf(config{})
+	for i := 0; i < t.NumField(); i++ {
+		if name := t.Field(i).Tag.Get("env"); name != "" {
+			known[name] = true
+		}
+	}
+
+	values := map[string]string{}
+	var listKey string
+	scanner := bufio.NewScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		errorf := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%s:%d: %s", path, lineno, fmt.Sprintf(format, args...))
+		}
+		if line == "" || line == "---" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "- ") && sep == ":" {
+			if listKey == "" {
+				return nil, errorf("list item outside of a list")
+			}
+			item := unquote(strings.TrimSpace(line[2:]))
+			if values[listKey] != "" {
+				item = "," + item
+			}
+			values[listKey] += item
+			continue
+		}
+		listKey = ""
+
+		if strings.HasPrefix(line, "[") {
+			return nil, errorf("tables are not supported")
+		}
+		i := strings.Index(line, sep)
+		if i < 0 {
+			return nil, errorf("expecting key %s value", sep)
+		}
+		key := strings.ToUpper(strings.Replace(strings.TrimSpace(line[:i]), "-", "_", -1))
+		if !known[key] {
+			return nil, errorf("unknown setting %q", strings.TrimSpace(line[:i]))
+		}
+
+		value := strings.TrimSpace(line[i+1:])
+		switch {
+		case value == "" && sep == ":":
+			listKey = key
+			values[key] = ""
+		case strings.HasPrefix(value, "["):
+			if !strings.HasSuffix(value, "]") {
+				return nil, errorf("lists must be on a single line")
+			}
+			var items []string
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = unquote(strings.TrimSpace(item)); item != "" {
+					items = append(items, item)
+				}
+			}
+			values[key] = strings.Join(items, ",")
+		default:
+			values[key] = unquote(value)
+		}
+	}
+	return values, scanner.Err()
+}
+
+// stripComment removes a trailing "#" comment that isn't within quotes.
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquote(value string) string {
+	if n := len(value); n >= 2 && (value[0] == '"' || value[0] == '\'') && value[n-1] == value[0] {
+		return value[1 : n-1]
+	}
+	return value
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"path"
+	"sync"
+)
+
+const costsStateFile = "costs.json"
+
+// maxCostHistory is the number of cycles whose costs are kept.
+const maxCostHistory = 120
+
+// quotaUnits are the quota costs of the YouTube API's list
+// methods, keyed by resource, other calls costing 1 unit.
+var quotaUnits = map[string]int64{
+	"search": 100,
+}
+
+// cycleCost is what a cycle spent of the quotas of the APIs, including
+// what was spent while it ran by mentions, reports and the like.
+type cycleCost struct {
+	Cycle        string `json:"cycle"`
+	QuotaUnits   int64  `json:"quota_units"`
+	YouTubeCalls int64  `json:"youtube_calls"`
+	Tweets       int64  `json:"tweets"`
+	DMs          int64  `json:"dms"`
+	MediaUploads int64  `json:"media_uploads"`
+	Retries      int64  `json:"retries"`
+}
+
+func (c *cycleCost) add(o *cycleCost) {
+	c.QuotaUnits += o.QuotaUnits
+	c.YouTubeCalls += o.YouTubeCalls
+	c.Tweets += o.Tweets
+	c.DMs += o.DMs
+	c.MediaUploads += o.MediaUploads
+	c.Retries += o.Retries
+}
+
+var (
+	costsMu     sync.Mutex
+	currentCost = new(cycleCost)
+	lastCost    *cycleCost
+	costTotals  cycleCost
+)
+
+// countCost records a cost against the running cycle.
+func countCost(fn func(*cycleCost)) {
+	costsMu.Lock()
+	fn(currentCost)
+	costsMu.Unlock()
+}
+
+func beginCycleCost(cycle string) {
+	costsMu.Lock()
+	currentCost.Cycle = cycle
+	costsMu.Unlock()
+}
+
+// endCycleCost logs and stores the running cycle's costs,
+// adds them to the totals and starts counting afresh.
+func endCycleCost() error {
+	costsMu.Lock()
+	cost := currentCost
+	costTotals.add(cost)
+	lastCost = cost
+	currentCost = new(cycleCost)
+	costsMu.Unlock()
+
+	log.Printf("cycle %s cost %d quota units in %d YouTube calls, %d tweets, %d DMs, %d media uploads, %d retries\n",
+		cost.Cycle, cost.QuotaUnits, cost.YouTubeCalls, cost.Tweets, cost.DMs, cost.MediaUploads, cost.Retries)
+
+	return store.AppendCost(cost)
+}
+
+// costSummary returns the last cycle's costs, if any,
+// and the totals since the bot started.
+func costSummary() (*cycleCost, cycleCost) {
+	costsMu.Lock()
+	defer costsMu.Unlock()
+	return lastCost, costTotals
+}
+
+// quotaTransport counts the quota units spent by requests to the YouTube API.
+type quotaTransport struct {
+	base http.RoundTripper
+}
+
+func (t *quotaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	units, ok := quotaUnits[path.Base(req.URL.Path)]
+	if !ok {
+		units = 1
+	}
+	countCost(func(c *cycleCost) {
+		c.QuotaUnits += units
+		c.YouTubeCalls++
+	})
+
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
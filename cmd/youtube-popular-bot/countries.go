@@ -0,0 +1,164 @@
+package main
+
+import (
+	"strings"
+)
+
+// countryNames maps the ISO 3166-1 alpha-2 codes of the regions
+// that YouTube offers charts for to their names in English.
+var countryNames = map[string]string{
+	"AE": "United Arab Emirates",
+	"AR": "Argentina",
+	"AT": "Austria",
+	"AU": "Australia",
+	"AZ": "Azerbaijan",
+	"BA": "Bosnia and Herzegovina",
+	"BD": "Bangladesh",
+	"BE": "Belgium",
+	"BG": "Bulgaria",
+	"BH": "Bahrain",
+	"BO": "Bolivia",
+	"BR": "Brazil",
+	"BY": "Belarus",
+	"CA": "Canada",
+	"CH": "Switzerland",
+	"CL": "Chile",
+	"CO": "Colombia",
+	"CR": "Costa Rica",
+	"CY": "Cyprus",
+	"CZ": "Czechia",
+	"DE": "Germany",
+	"DK": "Denmark",
+	"DO": "Dominican Republic",
+	"DZ": "Algeria",
+	"EC": "Ecuador",
+	"EE": "Estonia",
+	"EG": "Egypt",
+	"ES": "Spain",
+	"FI": "Finland",
+	"FR": "France",
+	"GB": "United Kingdom",
+	"GE": "Georgia",
+	"GH": "Ghana",
+	"GR": "Greece",
+	"GT": "Guatemala",
+	"HK": "Hong Kong",
+	"HN": "Honduras",
+	"HR": "Croatia",
+	"HU": "Hungary",
+	"ID": "Indonesia",
+	"IE": "Ireland",
+	"IL": "Israel",
+	"IN": "India",
+	"IQ": "Iraq",
+	"IS": "Iceland",
+	"IT": "Italy",
+	"JM": "Jamaica",
+	"JO": "Jordan",
+	"JP": "Japan",
+	"KE": "Kenya",
+	"KR": "South Korea",
+	"KW": "Kuwait",
+	"KZ": "Kazakhstan",
+	"LB": "Lebanon",
+	"LI": "Liechtenstein",
+	"LK": "Sri Lanka",
+	"LT": "Lithuania",
+	"LU": "Luxembourg",
+	"LV": "Latvia",
+	"LY": "Libya",
+	"MA": "Morocco",
+	"ME": "Montenegro",
+	"MK": "North Macedonia",
+	"MT": "Malta",
+	"MX": "Mexico",
+	"MY": "Malaysia",
+	"NG": "Nigeria",
+	"NI": "Nicaragua",
+	"NL": "Netherlands",
+	"NO": "Norway",
+	"NP": "Nepal",
+	"NZ": "New Zealand",
+	"OM": "Oman",
+	"PA": "Panama",
+	"PE": "Peru",
+	"PG": "Papua New Guinea",
+	"PH": "Philippines",
+	"PK": "Pakistan",
+	"PL": "Poland",
+	"PR": "Puerto Rico",
+	"PT": "Portugal",
+	"PY": "Paraguay",
+	"QA": "Qatar",
+	"RO": "Romania",
+	"RS": "Serbia",
+	"RU": "Russia",
+	"SA": "Saudi Arabia",
+	"SE": "Sweden",
+	"SG": "Singapore",
+	"SI": "Slovenia",
+	"SK": "Slovakia",
+	"SN": "Senegal",
+	"SV": "El Salvador",
+	"TH": "Thailand",
+	"TN": "Tunisia",
+	"TR": "Turkey",
+	"TW": "Taiwan",
+	"TZ": "Tanzania",
+	"UA": "Ukraine",
+	"UG": "Uganda",
+	"US": "United States",
+	"UY": "Uruguay",
+	"VE": "Venezuela",
+	"VN": "Vietnam",
+	"YE": "Yemen",
+	"ZA": "South Africa",
+	"ZW": "Zimbabwe",
+}
+
+// countryAliases are other names commonly used for some countries.
+var countryAliases = map[string]string{
+	"usa":                      "US",
+	"america":                  "US",
+	"united states of america": "US",
+	"the us":                   "US",
+	"the usa":                  "US",
+	"uk":                       "GB",
+	"the uk":                   "GB",
+	"britain":                  "GB",
+	"great britain":            "GB",
+	"england":                  "GB",
+	"korea":                    "KR",
+	"czech republic":           "CZ",
+	"holland":                  "NL",
+	"the netherlands":          "NL",
+	"macedonia":                "MK",
+	"uae":                      "AE",
+	"turkiye":                  "TR",
+	"türkiye":                  "TR",
+}
+
+// lookupCountry resolves a country's code or name, in
+// any case, to its code and name. ok is false if the
+// country is not one YouTube offers charts for.
+func lookupCountry(query string) (code, name string, ok bool) {
+	query = strings.TrimSpace(strings.Trim(query, "?!.,"))
+	if query == "" {
+		return "", "", false
+	}
+
+	if name, ok := countryNames[strings.ToUpper(query)]; ok && len(query) == 2 {
+		return strings.ToUpper(query), name, true
+	}
+
+	lowered := strings.ToLower(query)
+	if code, ok := countryAliases[lowered]; ok {
+		return code, countryNames[code], true
+	}
+	for code, name := range countryNames {
+		if strings.ToLower(name) == lowered {
+			return code, name, true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// customPost is a post that operators define without changing the
+// bot: at the times of Schedule, Query is run against the history
+// database and Template is rendered from its rows and posted.
+type customPost struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	Query    string `json:"query"`
+	Template string `json:"template"`
+
+	schedule *schedule
+	tmpl     *template.Template
+}
+
+// customPostData is what a custom post's template is rendered from,
+// every row mapping the query's columns to their values.
+type customPostData struct {
+	Rows []map[string]interface{}
+	Now  time.Time
+}
+
+var customPosts []*customPost
+
+// customFuncs are the functions of custom posts' templates.
+var customFuncs = template.FuncMap{
+	"youtubeURL": youtubeURL,
+	"plural":     plural,
+	"ordinal":    ordinal,
+	"commafy":    tmplFuncs["commafy"],
+	"truncate":   truncate,
+}
+
+func loadCustomPosts(path string) ([]*customPost, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var posts []*customPost
+	if err := json.Unmarshal(blob, &posts); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	names := map[string]bool{}
+	for i, cp := range posts {
+		if cp.Name == "" {
+			return nil, fmt.Errorf("%s: custom post #%d needs a name", path, i+1)
+		}
+		if names[cp.Name] {
+			return nil, fmt.Errorf("%s: more than one custom post is named %q", path, cp.Name)
+		}
+		names[cp.Name] = true
+		if err := cp.parse(); err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", path, cp.Name, err)
+		}
+	}
+	return posts, nil
+}
+
+func (cp *customPost) parse() error {
+	var err error
+	if cp.schedule, err = parseSchedule(cp.Schedule, cfg.ScheduleTimezone); err != nil {
+		return err
+	}
+	// Queries only read the history, which they run in a
+	// transaction that is rolled back, whatever they do.
+	verb := strings.ToUpper(strings.SplitN(strings.TrimSpace(cp.Query), " ", 2)[0])
+	if verb != "SELECT" && verb != "WITH" {
+		return fmt.Errorf("the query must be a SELECT")
+	}
+	cp.tmpl, err = template.New(cp.Name).Funcs(customFuncs).Parse(cp.Template)
+	return err
+}
+
+// compose runs the query and renders the post from its rows,
+// returning "" if the template rendered nothing but space.
+func (cp *customPost) compose() (string, error) {
+	db, err := openHistory()
+	if err != nil {
+		return "", err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(cp.Query)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+
+	data := &customPostData{Rows: []map[string]interface{}{}, Now: time.Now()}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return "", err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			// Drivers return text as bytes, which templates would print as numbers.
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[column] = values[i]
+		}
+		data.Rows = append(data.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := cp.tmpl.Execute(buf, data); err != nil {
+		return "", err
+	}
+	text := strings.TrimSpace(buf.String())
+	if n := tweetLength(text); n > maxTweetLength {
+		return "", fmt.Errorf("post is %d characters long, over the limit of %d", n, maxTweetLength)
+	}
+	return text, nil
+}
+
+// periodicCustomPost posts the custom post at the times of its schedule.
+func periodicCustomPost(cp *customPost) chan error {
+	return runOnSchedule(cp.schedule, func(time.Time) error {
+		var text string
+		err := withReloadable(func() (err error) {
+			text, err = cp.compose()
+			return err
+		})
+		if err != nil || text == "" {
+			return err
+		}
+		_, err = postTweet(text, nil)
+		return err
+	})
+}
+
+// customCommand prints the named custom post as it would be posted now.
+func customCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: custom <name>")
+	}
+	for _, cp := range customPosts {
+		if cp.Name == args[0] {
+			text, err := cp.compose()
+			if err != nil {
+				return err
+			}
+			fmt.Println(text)
+			return nil
+		}
+	}
+	return fmt.Errorf("no custom post is named %q", args[0])
+}
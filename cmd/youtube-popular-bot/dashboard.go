@@ -0,0 +1,241 @@
+package main
+
+import (
+	"expvar"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const dashboardTmplStr = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>youtube-popular-bot</title></head>
+<body>
+<h1>youtube-popular-bot</h1>
+{{if .Error}}<p style="color: red">{{.Error}}</p>{{end}}
+
+<p>Cycles are <strong>{{if .Status.Paused}}paused{{else}}running{{end}}</strong>,
+{{if .Status.Running}}one is running now{{else if not .Status.LastRun.IsZero}}the last ran at {{.Status.LastRun.Format "Jan 2 15:04 MST"}}{{else}}none has run yet{{end}}{{if not .Status.NextRun.IsZero}}
+and the next is due at {{.Status.NextRun.Format "Jan 2 15:04 MST"}}{{end}}.
+<form method="post" action="/trigger"><button>Run a cycle now</button></form>
+{{if .Status.Paused}}<form method="post" action="/resume"><button>Resume</button></form>
+{{else}}<form method="post" action="/pause"><button>Pause</button></form>{{end}}</p>
+
+<p>Safe mode is <strong>{{if .SafeMode}}on{{else}}off{{end}}</strong>.
+{{if .SafeMode}}<form method="post" action="/safe-mode/off"><button>Switch off</button></form>
+{{else}}<form method="post" action="/safe-mode/on"><button>Switch on</button></form>{{end}}</p>
+
+{{range .Approvals}}
+<h2>Digest {{.Code}} awaits approval</h2>
+<pre>{{.Preview}}</pre>
+<form method="post" action="/approvals/approve"><input type="hidden" name="code" value="{{.Code}}"><button>Approve</button></form>
+<form method="post" action="/approvals/reject"><input type="hidden" name="code" value="{{.Code}}"><button>Reject</button></form>
+{{end}}
+
+<h2>Queue{{if .Cycle}} for {{.Cycle}}{{end}}</h2>
+<table>
+<tr><th>Rank</th><th>Video</th><th>Views</th><th>Title</th><th>State</th><th>Batch</th><th></th></tr>
+{{range $post := .Posts}}
+<tr>
+<td>#{{.Rank}}</td>
+<td><a href="https://youtu.be/{{.VideoId}}">{{.VideoId}}</a></td>
+<td>{{if .ViewsHidden}}hidden{{else}}{{commafy .ViewCount}}{{end}}</td>
+{{if or (eq .State "queued") (eq .State "edited")}}
+<td><form method="post" action="/queue/edit"><input type="hidden" name="video_id" value="{{.VideoId}}"><input name="title" size="80" value="{{.Title}}"><button>Save</button></form></td>
+<td>{{.State}}</td>
+<td>{{with .Batch}}{{.}}, due {{$post.Due.Format "15:04"}}{{end}}</td>
+<td><form method="post" action="/queue/drop"><input type="hidden" name="video_id" value="{{.VideoId}}"><button>Drop</button></form></td>
+{{else}}
+<td>{{.Title}}</td>
+<td>{{.State}}</td>
+<td>{{with .Batch}}{{.}}, due {{$post.Due.Format "15:04"}}{{end}}</td>
+<td></td>
+{{end}}
+</tr>
+{{else}}
+<tr><td colspan="7">Nothing is queued.</td></tr>
+{{end}}
+</table>
+
+<h2>Publishers</h2>
+<table>
+{{range .Publishers}}
+<tr><td>{{.Name}}</td><td>{{if .Enabled}}enabled{{else}}disabled{{end}}</td>
+<td><form method="post" action="/publishers/{{if .Enabled}}disable{{else}}enable{{end}}"><input type="hidden" name="name" value="{{.Name}}"><button>{{if .Enabled}}Disable{{else}}Enable{{end}}</button></form></td></tr>
+{{end}}
+</table>
+
+<h2>Costs</h2>
+<table>
+<tr><th></th><th>Quota units</th><th>YouTube calls</th><th>Tweets</th><th>DMs</th><th>Media uploads</th><th>Retries</th></tr>
+{{with .LastCost}}<tr><td>Cycle {{.Cycle}}</td><td>{{.QuotaUnits}}</td><td>{{.YouTubeCalls}}</td><td>{{.Tweets}}</td><td>{{.DMs}}</td><td>{{.MediaUploads}}</td><td>{{.Retries}}</td></tr>{{end}}
+{{with .CostTotals}}<tr><td>Since starting</td><td>{{.QuotaUnits}}</td><td>{{.YouTubeCalls}}</td><td>{{.Tweets}}</td><td>{{.DMs}}</td><td>{{.MediaUploads}}</td><td>{{.Retries}}</td></tr>{{end}}
+</table>
+
+{{with .Freshness}}
+<h2>Freshness</h2>
+<p>Cycle {{.Cycle}} posted {{.Posts}} videos published a median of {{.MedianPublishLag}} and at most
+{{.MaxPublishLag}} before, with statistics at most {{.MaxStatsLag}} old.</p>
+{{end}}
+</body>
+</html>`
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"commafy": tmplFuncs["commafy"],
+}).Parse(dashboardTmplStr))
+
+type dashboardPage struct {
+	Error     string
+	SafeMode  bool
+	Cycle     string
+	Posts     []queuedPost
+	Approvals []*pendingApproval
+
+	LastCost   *cycleCost
+	CostTotals cycleCost
+
+	Freshness *cycleFreshness
+
+	Publishers []publisher
+
+	Status botStatus
+}
+
+func renderDashboard(w http.ResponseWriter, errMsg string) {
+	page := &dashboardPage{Error: errMsg, SafeMode: safeMode()}
+	page.Cycle, page.Posts = queue.list()
+	page.LastCost, page.CostTotals = costSummary()
+	page.Freshness = freshnessSummary()
+	page.Publishers = publishers()
+	statusMu.Lock()
+	page.Status = *status
+	statusMu.Unlock()
+
+	approvalsMu.Lock()
+	for _, pa := range approvals {
+		page.Approvals = append(page.Approvals, pa)
+	}
+	approvalsMu.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, page); err != nil {
+		log.Printf("rendering dashboard: %v\n", err)
+	}
+}
+
+// sameOrigin reports whether the request was made from a page of the
+// dashboard itself, going by its Origin header or, failing that, its
+// Referer. Browsers send either with forms, so a request with neither
+// comes from a script rather than from a page of another site.
+func sameOrigin(req *http.Request) bool {
+	source := req.Header.Get("Origin")
+	if source == "" {
+		source = req.Header.Get("Referer")
+	}
+	if source == "" {
+		return true
+	}
+	u, err := url.Parse(source)
+	return err == nil && u.Host == req.Host
+}
+
+// postOnly wraps handlers of forms, which change state, and
+// so must never be triggered by a plain GET nor by another
+// site's page, as browsers resend the basic authentication
+// with those too, then returns to the dashboard or shows
+// the error that occurred.
+func postOnly(fn func(*http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !sameOrigin(req) {
+			http.Error(w, "cross-origin request refused", http.StatusForbidden)
+			return
+		}
+		if err := fn(req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			renderDashboard(w, err.Error())
+			return
+		}
+		http.Redirect(w, req, "/", http.StatusSeeOther)
+	}
+}
+
+func dashboardMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", requireRole(roleViewer, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/" {
+			http.NotFound(w, req)
+			return
+		}
+		renderDashboard(w, "")
+	}))
+	mux.Handle("/debug/vars", requireRole(roleViewer, expvar.Handler().ServeHTTP))
+	mux.HandleFunc("/queue/edit", requireRole(roleAdmin, postOnly(func(req *http.Request) error {
+		return queue.edit(req.FormValue("video_id"), req.FormValue("title"))
+	})))
+	mux.HandleFunc("/queue/drop", requireRole(roleAdmin, postOnly(func(req *http.Request) error {
+		return queue.drop(req.FormValue("video_id"))
+	})))
+	mux.HandleFunc("/safe-mode/on", requireRole(roleAdmin, postOnly(func(req *http.Request) error {
+		setSafeMode(true)
+		return nil
+	})))
+	mux.HandleFunc("/safe-mode/off", requireRole(roleAdmin, postOnly(func(req *http.Request) error {
+		setSafeMode(false)
+		return nil
+	})))
+	mux.HandleFunc("/status", requireRole(roleViewer, serveStatus))
+	mux.HandleFunc("/trigger", requireRole(roleAdmin, postOnly(func(req *http.Request) error {
+		triggerCycle()
+		return nil
+	})))
+	mux.HandleFunc("/pause", requireRole(roleAdmin, postOnly(func(req *http.Request) error {
+		setPaused(true)
+		return nil
+	})))
+	mux.HandleFunc("/resume", requireRole(roleAdmin, postOnly(func(req *http.Request) error {
+		setPaused(false)
+		return nil
+	})))
+	mux.HandleFunc("/reload", requireRole(roleAdmin, postOnly(func(req *http.Request) error {
+		requestReload()
+		return nil
+	})))
+	mux.HandleFunc("/publishers/enable", requireRole(roleAdmin, postOnly(func(req *http.Request) error {
+		return setPublisherEnabled(req.FormValue("name"), true)
+	})))
+	mux.HandleFunc("/publishers/disable", requireRole(roleAdmin, postOnly(func(req *http.Request) error {
+		return setPublisherEnabled(req.FormValue("name"), false)
+	})))
+	mux.HandleFunc("/approvals/approve", requireRole(roleAdmin, postOnly(func(req *http.Request) error {
+		resolveApproval(req.FormValue("code"), true)
+		return nil
+	})))
+	mux.HandleFunc("/approvals/reject", requireRole(roleAdmin, postOnly(func(req *http.Request) error {
+		resolveApproval(req.FormValue("code"), false)
+		return nil
+	})))
+	if cfg.WebhookSecret != "" {
+		// Webhooks authenticate with their signature rather than a token.
+		mux.HandleFunc("/webhook", serveWebhook)
+	}
+	return mux
+}
+
+// serveDashboard serves the operator's dashboard on addr.
+func serveDashboard(addr string) error {
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      dashboardMux(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	log.Printf("serving the dashboard on %s\n", addr)
+	return server.ListenAndServe()
+}
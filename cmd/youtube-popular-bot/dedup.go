@@ -0,0 +1,45 @@
+package main
+
+import (
+	"expvar"
+	"log"
+	"time"
+)
+
+// dedupSkipped counts the videos left out for having been posted
+// within the dedup TTL, served on /debug/vars.
+var dedupSkipped = expvar.NewInt("dedup_skipped")
+
+// dropRecentlyPosted leaves out the videos that were posted within
+// ttl of now, so that videos that stay on the chart for days are not
+// posted every cycle. Videos are known to have been posted by the
+// store and, if there is one, by the history database, which also
+// remembers the videos posted before the store was reset.
+func dropRecentlyPosted(tweets []*tweet, ttl time.Duration, now time.Time) ([]*tweet, error) {
+	posted, err := store.PostedSince(now.Add(-ttl))
+	if err != nil {
+		return tweets, err
+	}
+	if cfg.HistoryDB != "" {
+		tweeted, err := postedVideosSince(now.Add(-ttl))
+		if err != nil {
+			return tweets, err
+		}
+		for id, at := range tweeted {
+			if at.After(posted[id]) {
+				posted[id] = at
+			}
+		}
+	}
+	var kept []*tweet
+	for _, tw := range tweets {
+		if at, ok := posted[tw.YouTubeId]; ok {
+			log.Printf("skipping %q: posted %s ago, within the dedup TTL of %s\n",
+				tw.YouTubeId, now.Sub(at).Round(time.Minute), ttl)
+			dedupSkipped.Add(1)
+			continue
+		}
+		kept = append(kept, tw)
+	}
+	return kept, nil
+}
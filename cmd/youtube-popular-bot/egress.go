@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// newEgressClient returns an HTTP client whose requests go through
+// proxyURL, if set, and originate from localAddr, if set. Either may
+// be an IPv6 address e.g. "http://[2001:db8::1]:3128" and "2001:db8::2".
+func newEgressClient(proxyURL, localAddr string) (*http.Client, error) {
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSHandshakeTimeout: 10 * time.Second,
+		IdleConnTimeout:     90 * time.Second,
+	}
+
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("proxy %q must be an absolute URL", proxyURL)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if localAddr != "" {
+		ip := net.ParseIP(localAddr)
+		if ip == nil {
+			return nil, fmt.Errorf("local address %q is not an IP address", localAddr)
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{Transport: transport}, nil
+}
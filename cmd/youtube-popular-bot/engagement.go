@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const engagementStateFile = "engagement.json"
+
+// maxEngagementRecords is how many posted videos are
+// remembered for learning the weights of categories.
+const maxEngagementRecords = 1000
+
+// Weights are shrunk towards 1 as though every category had
+// engagementPrior more posts with the average engagement, and
+// are kept within [minEngagementWeight, maxEngagementWeight].
+const (
+	engagementPrior     = 5
+	minEngagementWeight = 0.5
+	maxEngagementWeight = 2
+)
+
+// postedVideo is a tweet about a video whose engagement is learnt from.
+type postedVideo struct {
+	TweetId    string    `json:"tweet_id"`
+	VideoId    string    `json:"video_id"`
+	CategoryId string    `json:"category_id"`
+	PostedAt   time.Time `json:"posted_at"`
+}
+
+var engagementMu sync.Mutex
+
+// recordPostedVideo remembers the tweet about tw for learning.
+func recordPostedVideo(tweetId string, tw *tweet) error {
+	if tw.video == nil {
+		return nil
+	}
+	engagementMu.Lock()
+	defer engagementMu.Unlock()
+
+	var records []*postedVideo
+	if err := loadStateFile(engagementStateFile, &records); err != nil {
+		return err
+	}
+	records = append(records, &postedVideo{
+		TweetId:    tweetId,
+		VideoId:    tw.YouTubeId,
+		CategoryId: tw.video.CategoryId,
+		PostedAt:   time.Now(),
+	})
+	if len(records) > maxEngagementRecords {
+		records = records[len(records)-maxEngagementRecords:]
+	}
+	return saveStateFile(engagementStateFile, records)
+}
+
+// categoryWeights learns how much better, or worse, than average the
+// tweets about each category of videos did, in favorites and retweets,
+// from the tweets still on the account's recent timeline.
+func categoryWeights() (map[string]float64, error) {
+	engagementMu.Lock()
+	var records []*postedVideo
+	err := loadStateFile(engagementStateFile, &records)
+	engagementMu.Unlock()
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+
+	params := url.Values{
+		"count":           {"200"},
+		"include_rts":     {"false"},
+		"exclude_replies": {"true"},
+		"trim_user":       {"true"},
+	}
+	timeline, err := twitterAPI.GetUserTimeline(params)
+	if err != nil {
+		return nil, err
+	}
+	engagement := make(map[string]int, len(timeline))
+	for _, tw := range timeline {
+		engagement[tw.IdStr] = tw.FavoriteCount + tw.RetweetCount
+	}
+
+	sums := map[string]float64{}
+	counts := map[string]float64{}
+	var total, n float64
+	for _, rec := range records {
+		e, ok := engagement[rec.TweetId]
+		if !ok {
+			continue
+		}
+		sums[rec.CategoryId] += float64(e)
+		counts[rec.CategoryId]++
+		total += float64(e)
+		n++
+	}
+	if n == 0 || total == 0 {
+		return nil, nil
+	}
+
+	mean := total / n
+	weights := make(map[string]float64, len(sums))
+	for category, sum := range sums {
+		shrunk := (sum + engagementPrior*mean) / (counts[category] + engagementPrior)
+		weight := shrunk / mean
+		if weight < minEngagementWeight {
+			weight = minEngagementWeight
+		}
+		if weight > maxEngagementWeight {
+			weight = maxEngagementWeight
+		}
+		weights[category] = weight
+	}
+	return weights, nil
+}
+
+// rerankByEngagement reorders the tweets, scoring each by its position
+// weighted by the learnt weight of its category, and logs the weights
+// and every tweet that moved so that the re-ranking can be followed.
+func rerankByEngagement(tweets []*tweet) ([]*tweet, error) {
+	weights, err := categoryWeights()
+	if err != nil || len(weights) == 0 {
+		return tweets, err
+	}
+
+	var parts []string
+	for category, weight := range weights {
+		parts = append(parts, fmt.Sprintf("%s=%.2f", category, weight))
+	}
+	sort.Strings(parts)
+	log.Printf("engagement: category weights %s\n", strings.Join(parts, " "))
+
+	type scored struct {
+		tw    *tweet
+		from  int
+		score float64
+	}
+	scoredTweets := make([]scored, len(tweets))
+	for i, tw := range tweets {
+		weight := 1.0
+		if tw.video != nil {
+			if w, ok := weights[tw.video.CategoryId]; ok {
+				weight = w
+			}
+		}
+		scoredTweets[i] = scored{tw: tw, from: i, score: float64(len(tweets)-i) * weight}
+	}
+	sort.SliceStable(scoredTweets, func(i, j int) bool {
+		return scoredTweets[i].score > scoredTweets[j].score
+	})
+
+	reranked := make([]*tweet, len(tweets))
+	for i, st := range scoredTweets {
+		reranked[i] = st.tw
+		if st.from != i {
+			log.Printf("engagement: %q moved from #%d to #%d\n", st.tw.YouTubeId, st.from+1, i+1)
+		}
+	}
+	return reranked, nil
+}
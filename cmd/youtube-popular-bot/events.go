@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Kinds of event brokers.
+const (
+	brokerKafka = "kafka"
+	brokerNATS  = "nats"
+)
+
+// eventBus publishes the cycles' events to a topic of a broker.
+type eventBus interface {
+	Publish(blob []byte) error
+
+	// Close flushes the events not yet delivered and disconnects.
+	Close() error
+}
+
+// eventBrokers connect to the brokers of the kinds that the build
+// includes, given the broker's URL and the topic to publish to.
+// Builds with the kinds' tags register them.
+var eventBrokers = map[string]func(url, topic string) (eventBus, error){}
+
+// events is where cycle events are published, nil if nowhere.
+var events eventBus
+
+// Kinds of cycle events.
+const (
+	eventSnapshot = "snapshot"
+	eventPost     = "post"
+	eventError    = "error"
+)
+
+// cycleEvent is what the posting loop publishes for analytics stacks to
+// consume: the fetched snapshot, every published post and every error.
+type cycleEvent struct {
+	Kind  string    `json:"kind"`
+	Cycle string    `json:"cycle,omitempty"`
+	At    time.Time `json:"at"`
+
+	// Source and Videos are those of snapshots, ranked as fetched.
+	Source string         `json:"source,omitempty"`
+	Videos []*digestVideo `json:"videos,omitempty"`
+
+	Post  *postEvent `json:"post,omitempty"`
+	Error string     `json:"error,omitempty"`
+}
+
+func connectEvents(broker, url, topic string) (eventBus, error) {
+	connect, ok := eventBrokers[broker]
+	if !ok {
+		return nil, fmt.Errorf("publishing events to %s needs a build with the %s tag, e.g. go build -tags %s", broker, broker, broker)
+	}
+	return connect(url, topic)
+}
+
+// publishEvent publishes the event if events are published anywhere.
+func publishEvent(event *cycleEvent) error {
+	if events == nil {
+		return nil
+	}
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+	blob, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if err := events.Publish(blob); err != nil {
+		return fmt.Errorf("publishing a %s event: %v", event.Kind, err)
+	}
+	return nil
+}
+
+// snapshotEvent describes the tweets fetched for the cycle.
+func snapshotEvent(cycle, source string, tweets []*tweet) *cycleEvent {
+	videos := newDigestRecord(cycle, time.Time{}, 0, source, tweets).Videos
+	for i, dv := range videos {
+		dv.Rank = uint64(i + 1)
+	}
+	return &cycleEvent{Kind: eventSnapshot, Cycle: cycle, Source: source, Videos: videos}
+}
+
+// publishErrorEvent publishes the posting loop's error, only logging
+// any failure to, as the loop's errors end up here.
+func publishErrorEvent(err error) {
+	if err := publishEvent(&cycleEvent{Kind: eventError, Error: err.Error()}); err != nil {
+		log.Printf("%v\n", err)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// What the export command can export.
+const (
+	exportTweets    = "tweets"
+	exportDigests   = "digests"
+	exportSnapshots = "snapshots"
+)
+
+// Formats of exports.
+const (
+	exportJSON = "json"
+	exportCSV  = "csv"
+)
+
+// exportRange is the dates, inclusive, from which to export.
+type exportRange struct {
+	from, until time.Time
+}
+
+func (r *exportRange) contains(t time.Time) bool {
+	return !t.Before(r.from) && (r.until.IsZero() || t.Before(r.until))
+}
+
+// exportCommand dumps the history of posted tweets, the digests of
+// the archive or the snapshots of the charts, as JSON or CSV, for
+// using the data outside the bot.
+func exportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	what := fs.String("what", exportTweets, "what to export, tweets from the history database, digests from the archive or snapshots of the charts")
+	format := fs.String("format", exportJSON, "the format to export in, json or csv")
+	since := fs.String("since", "", "the date, as 2006-01-02, from which to export")
+	until := fs.String("until", "", "the last date, as 2006-01-02, to export")
+	out := fs.String("o", "", "the file to export to, by default the standard output")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != exportJSON && *format != exportCSV {
+		return fmt.Errorf("format must be %q or %q, got %q", exportJSON, exportCSV, *format)
+	}
+
+	var r exportRange
+	var err error
+	if *since != "" {
+		if r.from, err = time.ParseInLocation("2006-01-02", *since, time.Local); err != nil {
+			return fmt.Errorf("invalid date %q, expecting the form 2006-01-02", *since)
+		}
+	}
+	if *until != "" {
+		if r.until, err = time.ParseInLocation("2006-01-02", *until, time.Local); err != nil {
+			return fmt.Errorf("invalid date %q, expecting the form 2006-01-02", *until)
+		}
+		r.until = r.until.AddDate(0, 0, 1)
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	switch *what {
+	case exportTweets:
+		return exportPostedTweets(w, *format, &r)
+	case exportDigests:
+		return exportDigestRecords(w, *format, &r)
+	case exportSnapshots:
+		return exportTrendingSnapshots(w, *format, &r)
+	}
+	return fmt.Errorf("unknown export %q, expecting %q, %q or %q", *what, exportTweets, exportDigests, exportSnapshots)
+}
+
+func exportPostedTweets(w io.Writer, format string, r *exportRange) error {
+	if cfg.HistoryDB == "" {
+		return fmt.Errorf("there is no history without a history database")
+	}
+	all, err := postedTweetsSince(r.from)
+	if err != nil {
+		return err
+	}
+	tweets := []*postedTweet{}
+	for _, pt := range all {
+		if r.contains(pt.PostedAt) {
+			tweets = append(tweets, pt)
+		}
+	}
+
+	if format == exportJSON {
+		return writeExportJSON(w, tweets)
+	}
+	rows := [][]string{{"tweet_id", "video_id", "rank", "views", "views_hidden", "cycle", "posted_at", "channel_id", "title"}}
+	for _, pt := range tweets {
+		rows = append(rows, []string{
+			pt.TweetId, pt.VideoId, strconv.FormatUint(pt.Rank, 10), strconv.FormatUint(pt.Views, 10),
+			strconv.FormatBool(pt.ViewsHidden), pt.Cycle, pt.PostedAt.UTC().Format(time.RFC3339), pt.ChannelId, pt.Title,
+		})
+	}
+	return csv.NewWriter(w).WriteAll(rows)
+}
+
+// exportDigestRecords exports the archived digests posted in the range,
+// oldest first. As CSV every video of a digest is a row of its own.
+func exportDigestRecords(w io.Writer, format string, r *exportRange) error {
+	if cfg.ArchiveDir == "" {
+		return fmt.Errorf("there are no digests without an archive directory")
+	}
+	digests := []*digestRecord{}
+	err := forEachDigest(cfg.ArchiveDir, func(dr *digestRecord) error {
+		if r.contains(dr.PostedAt) {
+			digests = append(digests, dr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(digests, func(i, j int) bool { return digests[i].PostedAt.Before(digests[j].PostedAt) })
+
+	if format == exportJSON {
+		return writeExportJSON(w, digests)
+	}
+	rows := [][]string{{"cycle", "posted_at", "region", "source", "rank", "video_id", "title",
+		"channel_id", "channel_title", "category_id", "views", "views_hidden", "tweet_id", "url"}}
+	for _, dr := range digests {
+		for _, dv := range dr.Videos {
+			rows = append(rows, []string{
+				dr.Cycle, dr.PostedAt.UTC().Format(time.RFC3339), dr.Region, dr.Source,
+				strconv.FormatUint(dv.Rank, 10), dv.VideoId, dv.Title, dv.ChannelId, dv.ChannelTitle,
+				dv.CategoryId, strconv.FormatUint(dv.ViewCount, 10), strconv.FormatBool(dv.ViewsHidden),
+				dv.TweetId, dv.URL,
+			})
+		}
+	}
+	return csv.NewWriter(w).WriteAll(rows)
+}
+
+func writeExportJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// exportTrendingSnapshots exports the snapshots fetched in the range,
+// oldest first. As CSV every video of a snapshot is a row of its own.
+func exportTrendingSnapshots(w io.Writer, format string, r *exportRange) error {
+	if cfg.SnapshotDir == "" {
+		return fmt.Errorf("there are no snapshots without a snapshot directory")
+	}
+	snapshots := []*trendingSnapshot{}
+	err := forEachTrendingSnapshot(cfg.SnapshotDir, func(_ string, ts *trendingSnapshot) error {
+		if r.contains(ts.FetchedAt) {
+			snapshots = append(snapshots, ts)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if format == exportJSON {
+		return writeExportJSON(w, snapshots)
+	}
+	rows := [][]string{{"fetched_at", "region", "source", "rank", "video_id", "title", "channel_id",
+		"channel_title", "category_id", "published_at", "views", "likes", "comments", "views_hidden", "likes_hidden"}}
+	for _, ts := range snapshots {
+		for _, sv := range ts.Videos {
+			rows = append(rows, []string{
+				ts.FetchedAt.UTC().Format(time.RFC3339), ts.Region, ts.Source, strconv.FormatUint(sv.Rank, 10),
+				sv.VideoId, sv.Title, sv.ChannelId, sv.ChannelTitle, sv.CategoryId, sv.PublishedAt,
+				strconv.FormatUint(sv.ViewCount, 10), strconv.FormatUint(sv.LikeCount, 10),
+				strconv.FormatUint(sv.CommentCount, 10), strconv.FormatBool(sv.ViewsHidden), strconv.FormatBool(sv.LikesHidden),
+			})
+		}
+	}
+	return csv.NewWriter(w).WriteAll(rows)
+}
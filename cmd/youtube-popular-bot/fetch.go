@@ -0,0 +1,242 @@
+package main
+
+import (
+	"log"
+	"sort"
+
+	"github.com/odeke-em/youtube-popular-bot/youtube"
+)
+
+// Sources that a cycle's tweets can be fetched from.
+const (
+	sourceChart     = "chart"
+	sourceViewCount = "search by view count"
+	sourceSnapshot  = "last snapshot"
+)
+
+// fetchStrategy fetches a cycle's tweets from a single source.
+type fetchStrategy struct {
+	source string
+	fetch  func(*youtube.SearchParam) ([]*tweet, []error)
+}
+
+// fallbackFetch tries every strategy in order until one of them
+// produces tweets, returning those tweets and the source they
+// came from. Errors from every attempted strategy are returned.
+func fallbackFetch(param *youtube.SearchParam, strategies ...fetchStrategy) ([]*tweet, string, []error) {
+	var errs []error
+	for i, strategy := range strategies {
+		tweets, strategyErrs := strategy.fetch(param)
+		errs = append(errs, strategyErrs...)
+		if len(strategyErrs) == 0 && len(tweets) > 0 {
+			return tweets, strategy.source, errs
+		}
+		// A failure part way through pagination still leaves the pages
+		// fetched before it, which are good enough if there are enough.
+		if len(strategyErrs) > 0 && len(tweets) > 0 && len(tweets) >= cfg.MinPartialResults {
+			log.Printf("fetching from %s failed part way, proceeding with %d videos\n", strategy.source, len(tweets))
+			return tweets, strategy.source, errs
+		}
+		if i+1 < len(strategies) {
+			log.Printf("fetching from %s produced %d videos, falling back to %s\n", strategy.source, len(tweets), strategies[i+1].source)
+		}
+	}
+	return []*tweet{}, "", errs
+}
+
+// fetchTweets builds the cycle's tweets from the most popular chart,
+// falling back to searching by view count and then to the last
+// successfully fetched snapshot so that a digest is always produced.
+// Errors encountered along the way are returned alongside whatever
+// tweets could still be built and the source they were built from.
+func fetchTweets(param *youtube.SearchParam) ([]*tweet, string, []error) {
+	tweets, source, errs := fallbackFetch(param,
+		fetchStrategy{source: sourceChart, fetch: fetchPrimary},
+		fetchStrategy{source: sourceViewCount, fetch: fetchByViewCount},
+		fetchStrategy{source: sourceSnapshot, fetch: fetchSnapshot},
+	)
+	if source != "" && source != sourceSnapshot {
+		if err := saveSnapshot(tweets); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return tweets, source, errs
+}
+
+func fetchPrimary(param *youtube.SearchParam) ([]*tweet, []error) {
+	if param.RegionCode != "" {
+		if err := youtubeClient.ProbeMostPopular(param.RegionCode); err != nil {
+			return nil, []error{err}
+		}
+	}
+	if len(cfg.CategoryShards) > 0 {
+		return fetchSharded(param, cfg.CategoryShards)
+	}
+	return fetchChart(param)
+}
+
+// fetchByViewCount approximates the most popular chart, for regions
+// that don't support it, by searching for the region's most viewed
+// videos and then fetching their statistics.
+func fetchByViewCount(param *youtube.SearchParam) ([]*tweet, []error) {
+	searchParam := *param
+	searchParam.Order = "viewCount"
+	searchParam.Type = "video"
+
+	pages, err := youtubeClient.Search(&searchParam)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	var errs []error
+	var ids []string
+	for page := range pages {
+		if page.Err != nil {
+			errs = append(errs, page.Err)
+			continue
+		}
+		for _, result := range page.Items {
+			if result.VideoId != "" {
+				ids = append(ids, result.VideoId)
+			}
+		}
+	}
+
+	videos, err := videosById(ids)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	tweetList := []*tweet{}
+	for _, id := range ids {
+		if video, ok := videos[id]; ok {
+			tweetList = append(tweetList, newTweet(video))
+		}
+	}
+	return tweetList, errs
+}
+
+// chartFields are the only parts of chart responses that the bot
+// uses, requesting just them keeps responses small to decode.
+const chartFields = "nextPageToken,pageInfo/totalResults," +
+	"items(id,statistics,contentDetails(duration,contentRating/ytRating)," +
+	"snippet(title,description,categoryId,channelId,channelTitle,publishedAt," +
+	"defaultLanguage,defaultAudioLanguage,liveBroadcastContent,tags,thumbnails))"
+
+func fetchChart(param *youtube.SearchParam) ([]*tweet, []error) {
+	start := readMemStats()
+	defer func() { recordFetchAllocs(start) }()
+
+	if param.Fields == "" {
+		chartParam := *param
+		chartParam.Fields = chartFields
+		param = &chartParam
+	}
+
+	videoPages, err := youtubeClient.MostPopular(param)
+	if err != nil {
+		return nil, []error{err}
+	}
+	return collectPages(param, videoPages)
+}
+
+// collectPages collects the videos of the pages of a fetch into tweets,
+// sized for the fetch's results up front, along with the pages' errors.
+func collectPages(param *youtube.SearchParam, videoPages <-chan *youtube.ResultsPage) ([]*tweet, []error) {
+	var errs []error
+	var tweetList []*tweet
+	for videoPage := range videoPages {
+		if videoPage.Err != nil {
+			errs = append(errs, videoPage.Err)
+			continue
+		}
+
+		if tweetList == nil {
+			tweetList = make([]*tweet, 0, expectedResults(param, videoPage.TotalResults))
+		}
+		for _, video := range videoPage.Items {
+			tweetList = append(tweetList, newTweet(video))
+		}
+	}
+
+	if tweetList == nil {
+		tweetList = []*tweet{}
+	}
+	return tweetList, errs
+}
+
+// expectedResults estimates how many videos a fetch will return
+// from the requested page limits and the API's total, so that the
+// results can be collected without growing the slice repeatedly.
+func expectedResults(param *youtube.SearchParam, totalResults int64) int {
+	limit := int64(param.MaxPage * param.MaxResultsPerPage)
+	if totalResults > 0 && (limit == 0 || totalResults < limit) {
+		limit = totalResults
+	}
+	if limit <= 0 || limit > maxAPIResultsPerPage*10 {
+		limit = maxAPIResultsPerPage
+	}
+	return int(limit)
+}
+
+// fetchSharded fetches the most popular chart of every category,
+// merges them into one pool without duplicates and keeps the most
+// viewed, as many as the unsharded chart would have returned.
+func fetchSharded(param *youtube.SearchParam, categoryIds []string) ([]*tweet, []error) {
+	var errs []error
+	seen := make(map[string]bool)
+	pool := []*tweet{}
+	views := make(map[*tweet]uint64)
+
+	for _, categoryId := range categoryIds {
+		shardParam := *param
+		shardParam.VideoCategoryId = categoryId
+
+		tweets, shardErrs := fetchChart(&shardParam)
+		errs = append(errs, shardErrs...)
+		for tw, n := range shardViews(tweets) {
+			views[tw] = n
+		}
+		for _, tw := range tweets {
+			if seen[tw.YouTubeId] {
+				continue
+			}
+			seen[tw.YouTubeId] = true
+			pool = append(pool, tw)
+		}
+	}
+
+	sort.SliceStable(pool, func(i, j int) bool { return views[pool[i]] > views[pool[j]] })
+
+	if limit := param.MaxPage * param.MaxResultsPerPage; limit > 0 && uint64(len(pool)) > limit {
+		pool = pool[:limit]
+	}
+
+	return pool, errs
+}
+
+// shardViews returns the views that the chart's videos are merged by.
+// Rather than sinking to the bottom as though it had none, a video
+// whose views are hidden keeps its place in the chart, taking the
+// views of the video ranked above it, or below it if it tops the chart.
+func shardViews(tweets []*tweet) map[*tweet]uint64 {
+	views := make(map[*tweet]uint64, len(tweets))
+	var above uint64
+	for i, tw := range tweets {
+		switch {
+		case !tw.ViewsHidden:
+			views[tw] = tw.ViewCount
+		case i > 0:
+			views[tw] = above
+		default:
+			for _, below := range tweets {
+				if !below.ViewsHidden {
+					views[tw] = below.ViewCount
+					break
+				}
+			}
+		}
+		above = views[tw]
+	}
+	return views
+}
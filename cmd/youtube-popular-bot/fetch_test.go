@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/odeke-em/youtube-popular-bot/youtube"
+)
+
+// benchmarkPages returns the pages of a fetch of n pages of 50 videos.
+func benchmarkPages(n int) []*youtube.ResultsPage {
+	pages := make([]*youtube.ResultsPage, n)
+	for i := range pages {
+		page := &youtube.ResultsPage{Index: uint64(i), TotalResults: int64(n * maxAPIResultsPerPage)}
+		for j := 0; j < maxAPIResultsPerPage; j++ {
+			page.Items = append(page.Items, benchmarkVideo(i*maxAPIResultsPerPage+j))
+		}
+		pages[i] = page
+	}
+	return pages
+}
+
+func BenchmarkCollectPages(b *testing.B) {
+	pages := benchmarkPages(4)
+	param := &youtube.SearchParam{MaxPage: 4, MaxResultsPerPage: maxAPIResultsPerPage}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c := make(chan *youtube.ResultsPage, len(pages))
+		for _, page := range pages {
+			c <- page
+		}
+		close(c)
+		if tweets, errs := collectPages(param, c); len(errs) > 0 || len(tweets) != 4*maxAPIResultsPerPage {
+			b.Fatalf("collected %d tweets, errors: %v", len(tweets), errs)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isoDurationPattern matches the ISO 8601 durations of
+// videos, e.g. "PT4M13S", "PT1H2M" or "P1DT3H".
+var isoDurationPattern = regexp.MustCompile(`^P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+func parseISODuration(s string) (time.Duration, error) {
+	m := isoDurationPattern.FindStringSubmatch(s)
+	if m == nil || s == "P" || s == "PT" {
+		return 0, fmt.Errorf("invalid ISO 8601 duration %q", s)
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(m[i+1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ISO 8601 duration %q", s)
+		}
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
+
+// dropBelowMinViews drops the videos with fewer than min views, so that
+// thinly watched entries of regional charts aren't amplified. Videos
+// whose views are hidden can't be judged by them and are kept.
+func dropBelowMinViews(tweets []*tweet, min uint64) []*tweet {
+	kept := make([]*tweet, 0, len(tweets))
+	for _, tw := range tweets {
+		if !tw.ViewsHidden && tw.ViewCount < min {
+			log.Printf("skipping %q: %d views, below the minimum of %d\n", tw.YouTubeId, tw.ViewCount, min)
+			continue
+		}
+		kept = append(kept, tw)
+	}
+	return kept
+}
+
+// filterCategories keeps, if include is set, only the videos of its
+// categories, and drops those of the exclude categories.
+func filterCategories(tweets []*tweet, include, exclude []string) []*tweet {
+	kept := make([]*tweet, 0, len(tweets))
+	for _, tw := range tweets {
+		if tw.video != nil {
+			category := tw.video.CategoryId
+			if len(include) > 0 && !anyEqualFold(include, category) {
+				log.Printf("skipping %q: category %q isn't included\n", tw.YouTubeId, category)
+				continue
+			}
+			if anyEqualFold(exclude, category) {
+				log.Printf("skipping %q: category %q is excluded\n", tw.YouTubeId, category)
+				continue
+			}
+		}
+		kept = append(kept, tw)
+	}
+	return kept
+}
+
+// filterChannels keeps, if allowed is set, only the videos of its
+// channels, and drops those of the blocked channels.
+func filterChannels(tweets []*tweet, allowed, blocked []string) []*tweet {
+	kept := make([]*tweet, 0, len(tweets))
+	for _, tw := range tweets {
+		if tw.video != nil {
+			channel := tw.video.ChannelId
+			if len(allowed) > 0 && !anyEqualFold(allowed, channel) {
+				log.Printf("skipping %q: channel %q isn't allowed\n", tw.YouTubeId, channel)
+				continue
+			}
+			if anyEqualFold(blocked, channel) {
+				log.Printf("skipping %q: channel %q is blocked\n", tw.YouTubeId, channel)
+				continue
+			}
+		}
+		kept = append(kept, tw)
+	}
+	return kept
+}
+
+// filterLanguages keeps only the videos in one of the languages, e.g.
+// "en" also keeping "en-GB", judged by their default audio language or
+// failing that the language of their metadata. Videos that declare
+// neither can't be judged by them and are kept.
+func filterLanguages(tweets []*tweet, languages []string) []*tweet {
+	kept := make([]*tweet, 0, len(tweets))
+	for _, tw := range tweets {
+		if tw.video != nil {
+			lang := tw.video.DefaultAudioLanguage
+			if lang == "" {
+				lang = tw.video.DefaultLanguage
+			}
+			if lang != "" && !matchesLanguage(languages, lang) {
+				log.Printf("skipping %q: language %q isn't one of %v\n", tw.YouTubeId, lang, languages)
+				continue
+			}
+		}
+		kept = append(kept, tw)
+	}
+	return kept
+}
+
+// compilePatterns compiles the regular expressions of a blocklist.
+func compilePatterns(exprs []string) ([]*regexp.Regexp, error) {
+	patterns := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
+
+// dropBlockedText drops the videos whose title or description contains
+// any of the keywords, regardless of case, or matches any of the
+// regular expressions, to keep clickbait, spoilers and unwanted topics
+// off the timeline.
+func dropBlockedText(tweets []*tweet, keywords []string, patterns []*regexp.Regexp) []*tweet {
+	kept := make([]*tweet, 0, len(tweets))
+next:
+	for _, tw := range tweets {
+		text := tw.Title
+		if tw.video != nil {
+			text = tw.video.Title + "\n" + tw.video.Description
+		}
+		lower := strings.ToLower(text)
+		for _, keyword := range keywords {
+			if strings.Contains(lower, strings.ToLower(keyword)) {
+				log.Printf("skipping %q: it mentions the blocked keyword %q\n", tw.YouTubeId, keyword)
+				continue next
+			}
+		}
+		for _, re := range patterns {
+			if re.MatchString(text) {
+				log.Printf("skipping %q: it matches the blocked pattern %q\n", tw.YouTubeId, re)
+				continue next
+			}
+		}
+		kept = append(kept, tw)
+	}
+	return kept
+}
+
+// dropShorterThan drops the videos shorter than min, so that Shorts
+// don't flood the timeline. Videos whose duration is unknown, as is
+// that of live broadcasts, can't be judged by it and are kept.
+func dropShorterThan(tweets []*tweet, min time.Duration) []*tweet {
+	kept := make([]*tweet, 0, len(tweets))
+	for _, tw := range tweets {
+		if tw.video != nil && tw.video.Duration != "" {
+			d, err := parseISODuration(tw.video.Duration)
+			if err != nil {
+				log.Printf("keeping %q: %v\n", tw.YouTubeId, err)
+			} else if d > 0 && d < min {
+				log.Printf("skipping %q: it lasts %s, shorter than %s\n", tw.YouTubeId, d, min)
+				continue
+			}
+		}
+		kept = append(kept, tw)
+	}
+	return kept
+}
+
+// screenBlocked passes the videos through the purged videos, the
+// content policies, safe mode and the blocklists, which every video the
+// bot posts is held to, returning those that may be posted along with
+// what went wrong screening them. Jobs beside the posting loop call it, and
+// screenCandidates, with withReloadable.
+func screenBlocked(tweets []*tweet) ([]*tweet, []error) {
+	var errs []error
+	purged, err := loadPurged()
+	if err != nil {
+		// The purged videos can't be told apart, so nothing is let through.
+		errs = append(errs, fmt.Errorf("the purged videos couldn't be loaded, dropping all %d candidates: %v", len(tweets), err))
+		return nil, errs
+	}
+	tweets = dropPurged(tweets, purged)
+	candidates := tweets
+	if policy != nil {
+		var err error
+		if tweets, err = applyPolicy(policy, tweets); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if shadowPolicy != nil {
+		if err := shadowApplyPolicy(shadowPolicy, candidates, tweets); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	tweets = applySafeMode(tweets)
+	if len(cfg.BlockedChannels) > 0 {
+		tweets = filterChannels(tweets, nil, cfg.BlockedChannels)
+	}
+	if len(cfg.blockedPatterns) != len(cfg.BlockedPatterns) {
+		// The blocklist can't be enforced, so nothing is let through.
+		errs = append(errs, fmt.Errorf("the blocked patterns weren't compiled, dropping all %d candidates", len(tweets)))
+		return nil, errs
+	}
+	if len(cfg.BlockedKeywords) > 0 || len(cfg.BlockedPatterns) > 0 {
+		tweets = dropBlockedText(tweets, cfg.BlockedKeywords, cfg.blockedPatterns)
+	}
+	return tweets, errs
+}
+
+// screenCandidates screens the videos of a digest as screenBlocked
+// does, then keeps those that the configured filters let through.
+func screenCandidates(tweets []*tweet) ([]*tweet, []error) {
+	tweets, errs := screenBlocked(tweets)
+	if len(cfg.IncludeCategories) > 0 || len(cfg.ExcludeCategories) > 0 {
+		tweets = filterCategories(tweets, cfg.IncludeCategories, cfg.ExcludeCategories)
+	}
+	if len(cfg.AllowedChannels) > 0 {
+		tweets = filterChannels(tweets, cfg.AllowedChannels, nil)
+	}
+	if len(cfg.Languages) > 0 {
+		tweets = filterLanguages(tweets, cfg.Languages)
+	}
+	if cfg.MinDuration > 0 {
+		tweets = dropShorterThan(tweets, cfg.MinDuration)
+	}
+	if cfg.MinViews > 0 {
+		tweets = dropBelowMinViews(tweets, uint64(cfg.MinViews))
+	}
+	return tweets, errs
+}
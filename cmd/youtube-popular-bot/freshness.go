@@ -0,0 +1,93 @@
+package main
+
+import (
+	"expvar"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/odeke-em/youtube-popular-bot/youtube"
+)
+
+// Freshness metrics of the last cycle, served on /debug/vars: how long
+// after being published the posted videos were posted, and how old
+// the statistics in the posts were by the time they were posted.
+var (
+	publishLagMedian = expvar.NewFloat("publish_lag_seconds_median")
+	publishLagMax    = expvar.NewFloat("publish_lag_seconds_max")
+	statsLagMax      = expvar.NewFloat("stats_lag_seconds_max")
+)
+
+// cycleFreshness summarizes how fresh a cycle's posts were.
+type cycleFreshness struct {
+	Cycle            string
+	Posts            int
+	MedianPublishLag time.Duration
+	MaxPublishLag    time.Duration
+	MaxStatsLag      time.Duration
+
+	publishLags []time.Duration
+}
+
+var (
+	freshnessMu   sync.Mutex
+	lastFreshness *cycleFreshness
+)
+
+// add records the post of the video, whose statistics were fetched at
+// fetchedAt. Videos without a parseable publishing time only count
+// towards the age of the statistics.
+func (f *cycleFreshness) add(video *youtube.Video, fetchedAt, postedAt time.Time) {
+	f.Posts++
+	if lag := postedAt.Sub(fetchedAt); lag > f.MaxStatsLag {
+		f.MaxStatsLag = lag
+	}
+	if video == nil {
+		return
+	}
+	publishedAt, err := time.Parse(time.RFC3339, video.PublishedAt)
+	if err != nil {
+		return
+	}
+	lag := postedAt.Sub(publishedAt)
+	f.publishLags = append(f.publishLags, lag)
+	if lag > f.MaxPublishLag {
+		f.MaxPublishLag = lag
+	}
+}
+
+// recordFreshness publishes and logs the cycle's freshness.
+func recordFreshness(f *cycleFreshness) {
+	if f.Posts == 0 {
+		return
+	}
+	if n := len(f.publishLags); n > 0 {
+		sort.Slice(f.publishLags, func(i, j int) bool { return f.publishLags[i] < f.publishLags[j] })
+		f.MedianPublishLag = f.publishLags[n/2]
+		if n%2 == 0 {
+			f.MedianPublishLag = (f.publishLags[n/2-1] + f.publishLags[n/2]) / 2
+		}
+	}
+
+	publishLagMedian.Set(f.MedianPublishLag.Seconds())
+	publishLagMax.Set(f.MaxPublishLag.Seconds())
+	statsLagMax.Set(f.MaxStatsLag.Seconds())
+
+	// Rounded for reading in the log and on the dashboard.
+	f.MedianPublishLag = f.MedianPublishLag.Round(time.Minute)
+	f.MaxPublishLag = f.MaxPublishLag.Round(time.Minute)
+	f.MaxStatsLag = f.MaxStatsLag.Round(time.Second)
+	log.Printf("cycle %s posted %d videos published a median of %s and at most %s before, with statistics at most %s old\n",
+		f.Cycle, f.Posts, f.MedianPublishLag, f.MaxPublishLag, f.MaxStatsLag)
+
+	freshnessMu.Lock()
+	lastFreshness = f
+	freshnessMu.Unlock()
+}
+
+func freshnessSummary() *cycleFreshness {
+	freshnessMu.Lock()
+	defer freshnessMu.Unlock()
+	return lastFreshness
+}
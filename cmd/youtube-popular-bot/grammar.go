@@ -0,0 +1,84 @@
+package main
+
+import "fmt"
+
+// locales are the languages whose grammar the templates' helpers know.
+var locales = []string{"en", "es", "fr", "de", "pt"}
+
+func validLocale(locale string) bool {
+	for _, l := range locales {
+		if l == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// toInt64 converts the integers that templates pass to helpers.
+func toInt64(n interface{}) (int64, error) {
+	switch n := n.(type) {
+	case int:
+		return int64(n), nil
+	case int64:
+		return n, nil
+	case uint64:
+		return int64(n), nil
+	case uint:
+		return int64(n), nil
+	}
+	return 0, fmt.Errorf("expecting an integer, got %T", n)
+}
+
+// plural returns the singular form for counts that take it in
+// the configured locale and the plural form for the others.
+func plural(n interface{}, singular, pluralForm string) (string, error) {
+	count, err := toInt64(n)
+	if err != nil {
+		return "", err
+	}
+	switch cfg.Locale {
+	case "fr":
+		// French treats 0 as singular too.
+		if count == 0 || count == 1 {
+			return singular, nil
+		}
+	default:
+		if count == 1 {
+			return singular, nil
+		}
+	}
+	return pluralForm, nil
+}
+
+// ordinal writes the rank as an ordinal of the configured locale,
+// e.g. "1st", "2nd" and "11th" in English or "1er" and "2e" in French.
+func ordinal(n interface{}) (string, error) {
+	rank, err := toInt64(n)
+	if err != nil {
+		return "", err
+	}
+	switch cfg.Locale {
+	case "es", "pt":
+		return fmt.Sprintf("%dº", rank), nil
+	case "fr":
+		if rank == 1 {
+			return "1er", nil
+		}
+		return fmt.Sprintf("%de", rank), nil
+	case "de":
+		return fmt.Sprintf("%d.", rank), nil
+	}
+
+	suffix := "th"
+	if rank%100 < 11 || rank%100 > 13 {
+		switch rank % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return fmt.Sprintf("%d%s", rank, suffix), nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// historyDriver is the database/sql driver of the history database,
+// registered by builds with the sqlite tag.
+const historyDriver = "sqlite3"
+
+const historySchema = `CREATE TABLE IF NOT EXISTS posted_tweets (
+	tweet_id     TEXT PRIMARY KEY,
+	video_id     TEXT NOT NULL,
+	rank         INTEGER NOT NULL,
+	views        INTEGER NOT NULL,
+	views_hidden INTEGER NOT NULL,
+	cycle        TEXT NOT NULL,
+	posted_at    TIMESTAMP NOT NULL,
+	channel_id   TEXT NOT NULL DEFAULT '',
+	title        TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS posted_tweets_video_id ON posted_tweets (video_id);
+CREATE INDEX IF NOT EXISTS posted_tweets_posted_at ON posted_tweets (posted_at);`
+
+// historyAddedColumns are the columns added to posted_tweets since it
+// was first created, which tables created before them lack. Tweets
+// recorded before then have them empty.
+var historyAddedColumns = []struct{ name, definition string }{
+	{"channel_id", "TEXT NOT NULL DEFAULT ''"},
+	{"title", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// postedTweet is a row of the history of every tweet posted about a video.
+type postedTweet struct {
+	TweetId     string    `json:"tweet_id"`
+	VideoId     string    `json:"video_id"`
+	Rank        uint64    `json:"rank"`
+	Views       uint64    `json:"views"`
+	ViewsHidden bool      `json:"views_hidden"`
+	Cycle       string    `json:"cycle"`
+	PostedAt    time.Time `json:"posted_at"`
+	ChannelId   string    `json:"channel_id,omitempty"`
+	Title       string    `json:"title,omitempty"`
+}
+
+var (
+	historyOnce sync.Once
+	historyDB   *sql.DB
+	historyErr  error
+)
+
+func historyAvailable() bool {
+	for _, driver := range sql.Drivers() {
+		if driver == historyDriver {
+			return true
+		}
+	}
+	return false
+}
+
+// openHistory opens the history database, creating its table on first
+// use. It is kept open for as long as the bot runs.
+func openHistory() (*sql.DB, error) {
+	historyOnce.Do(func() {
+		if historyDB, historyErr = sql.Open(historyDriver, cfg.HistoryDB); historyErr != nil {
+			return
+		}
+		// SQLite allows one writer at a time.
+		historyDB.SetMaxOpenConns(1)
+		if _, historyErr = historyDB.Exec(historySchema); historyErr == nil {
+			historyErr = addHistoryColumns(historyDB)
+		}
+		if historyErr != nil {
+			historyDB.Close()
+		}
+	})
+	return historyDB, historyErr
+}
+
+// addHistoryColumns adds the columns that the table lacks.
+func addHistoryColumns(db *sql.DB) error {
+	rows, err := db.Query(`PRAGMA table_info(posted_tweets)`)
+	if err != nil {
+		return err
+	}
+	columns := map[string]bool{}
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, typ        string
+			dflt             sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		columns[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, column := range historyAddedColumns {
+		if columns[column.name] {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE posted_tweets ADD COLUMN ` + column.name + ` ` + column.definition); err != nil {
+			return fmt.Errorf("adding %s to the history: %v", column.name, err)
+		}
+	}
+	return nil
+}
+
+func recordPostedTweet(pt *postedTweet) error {
+	db, err := openHistory()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT OR REPLACE INTO posted_tweets
+		(tweet_id, video_id, rank, views, views_hidden, cycle, posted_at, channel_id, title) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		pt.TweetId, pt.VideoId, int64(pt.Rank), int64(pt.Views), pt.ViewsHidden, pt.Cycle, pt.PostedAt.UTC(), pt.ChannelId, pt.Title)
+	if err != nil {
+		return fmt.Errorf("recording tweet %s in the history: %v", pt.TweetId, err)
+	}
+	return nil
+}
+
+// postedTweetsSince returns the history's tweets posted since t, oldest first.
+func postedTweetsSince(t time.Time) ([]*postedTweet, error) {
+	db, err := openHistory()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT tweet_id, video_id, rank, views, views_hidden, cycle, posted_at, channel_id, title
+		FROM posted_tweets WHERE posted_at >= ? ORDER BY posted_at, rank DESC`, t.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tweets []*postedTweet
+	for rows.Next() {
+		pt := new(postedTweet)
+		var rank, views int64
+		if err := rows.Scan(&pt.TweetId, &pt.VideoId, &rank, &views, &pt.ViewsHidden, &pt.Cycle, &pt.PostedAt, &pt.ChannelId, &pt.Title); err != nil {
+			return nil, err
+		}
+		pt.Rank, pt.Views = uint64(rank), uint64(views)
+		tweets = append(tweets, pt)
+	}
+	return tweets, rows.Err()
+}
+
+// postedVideosSince returns when each video that the history has a
+// tweet about since t was last tweeted about.
+func postedVideosSince(t time.Time) (map[string]time.Time, error) {
+	tweets, err := postedTweetsSince(t)
+	if err != nil {
+		return nil, err
+	}
+	posted := make(map[string]time.Time)
+	for _, pt := range tweets {
+		if pt.PostedAt.After(posted[pt.VideoId]) {
+			posted[pt.VideoId] = pt.PostedAt
+		}
+	}
+	return posted, nil
+}
+
+// historyTweetIds returns the ids of the history's tweets about the videos.
+func historyTweetIds(videoIds map[string]bool) ([]string, error) {
+	db, err := openHistory()
+	if err != nil {
+		return nil, err
+	}
+	var tweetIds []string
+	for videoId := range videoIds {
+		rows, err := db.Query(`SELECT tweet_id FROM posted_tweets WHERE video_id = ?`, videoId)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			tweetIds = append(tweetIds, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return tweetIds, nil
+}
+
+// forgetHistory removes the videos' tweets from the history.
+func forgetHistory(videoIds map[string]bool) error {
+	db, err := openHistory()
+	if err != nil {
+		return err
+	}
+	for videoId := range videoIds {
+		if _, err := db.Exec(`DELETE FROM posted_tweets WHERE video_id = ?`, videoId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// historyCommand prints the tweets posted since a date, by default
+// those of the last 30 days, for answering what the bot posted.
+func historyCommand(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	since := fs.String("since", "", "the date, as 2006-01-02, from which to list tweets")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if cfg.HistoryDB == "" {
+		return fmt.Errorf("there is no history without a history database")
+	}
+	from := time.Now().AddDate(0, 0, -30)
+	if *since != "" {
+		var err error
+		if from, err = time.ParseInLocation("2006-01-02", *since, time.Local); err != nil {
+			return fmt.Errorf("invalid date %q, expecting the form 2006-01-02", *since)
+		}
+	}
+
+	tweets, err := postedTweetsSince(from)
+	if err != nil {
+		return err
+	}
+	for _, pt := range tweets {
+		views := fmt.Sprintf("%d views", pt.Views)
+		if pt.ViewsHidden {
+			views = "views hidden"
+		}
+		fmt.Printf("%s\t%s\t#%d\t%s\t%s\thttps://twitter.com/i/web/status/%s\n",
+			pt.PostedAt.Local().Format(time.RFC3339), pt.Cycle, pt.Rank, pt.VideoId, views, pt.TweetId)
+	}
+	return nil
+}
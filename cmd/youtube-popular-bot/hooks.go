@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/ChimeraCoder/anaconda"
+)
+
+// postEvent describes a post that was published, for consumption
+// by hooks that operators configure e.g. to feed their own analytics.
+type postEvent struct {
+	Platform string    `json:"platform"`
+	PostId   string    `json:"post_id"`
+	Text     string    `json:"text"`
+	PostedAt time.Time `json:"posted_at"`
+
+	// Kind is "intro" for a digest's intro, "video" for a post
+	// about a video and "upload" for a watched channel's upload.
+	Kind string `json:"kind"`
+
+	Rank       uint64 `json:"rank,omitempty"`
+	VideoId    string `json:"video_id,omitempty"`
+	CategoryId string `json:"category_id,omitempty"`
+	Title      string `json:"title,omitempty"`
+	ViewCount  uint64 `json:"view_count,omitempty"`
+	URL        string `json:"url,omitempty"`
+
+	// ViewsHidden is set if the video's owner hid its views.
+	ViewsHidden bool `json:"views_hidden,omitempty"`
+
+	// ContentWarning is the warning that the content policy
+	// put on the video, for mirrors that support them.
+	ContentWarning string `json:"content_warning,omitempty"`
+
+	// PostURL is the canonical URL of the post on Twitter. If
+	// crosslinking, Crosslink is the text with which to mirror the
+	// post elsewhere, linking back to it.
+	PostURL   string `json:"post_url"`
+	Crosslink string `json:"crosslink,omitempty"`
+
+	// Mirrors are the posts that the hooks run before
+	// this one reported having made of this post.
+	Mirrors []*mirrorPost `json:"mirrors,omitempty"`
+
+	// Options are those of the platform that the hook receiving
+	// the event mirrors it to, if the hook has any.
+	Options *postOptions `json:"options,omitempty"`
+}
+
+// mirrorPost is what a hook may respond with, or write
+// to its stdout, after mirroring a post elsewhere.
+type mirrorPost struct {
+	Platform string `json:"platform"`
+	PostId   string `json:"post_id"`
+	PostURL  string `json:"post_url,omitempty"`
+}
+
+// newPostEvent describes the tweet posted as text.
+func newPostEvent(kind string, posted anaconda.Tweet, text string) *postEvent {
+	event := &postEvent{
+		Platform: "twitter",
+		PostId:   posted.IdStr,
+		Text:     text,
+		PostedAt: time.Now(),
+		Kind:     kind,
+	}
+	// Nothing was posted to Twitter while it is disabled.
+	if posted.IdStr != "" {
+		event.PostURL = fmt.Sprintf("https://twitter.com/%s/status/%s", posted.User.ScreenName, posted.IdStr)
+	}
+	if cfg.Crosslink && event.PostURL != "" {
+		event.Crosslink = text + "\n\n" + event.PostURL
+	}
+	return event
+}
+
+const hookTimeout = 10 * time.Second
+
+var hookClient = &http.Client{Timeout: hookTimeout}
+
+// runPostHooks delivers the event to every configured hook, one after
+// another: URLs receive it as the JSON body of a POST, commands on their
+// stdin. Hooks that mirror the post report it in their response, or on
+// their stdout, and every later hook receives the mirrors made so far.
+func runPostHooks(event *postEvent) []error {
+	if len(cfg.PostHookURLs) == 0 && len(cfg.PostHookCommands) == 0 {
+		return nil
+	}
+
+	var errs []error
+	run := func(name string, hook func([]byte) ([]byte, error)) {
+		if !publisherEnabled(name) {
+			return
+		}
+		event.Options = nil
+		if opts, ok := hookOptions[name]; ok {
+			event.Options = opts.forPost(event.CategoryId, event.ContentWarning)
+		}
+		blob, err := json.Marshal(event)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		out, err := hook(blob)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("post hook %q: %v", name, err))
+			return
+		}
+		if mirror := parseMirrorPost(out); mirror != nil {
+			event.Mirrors = append(event.Mirrors, mirror)
+		} else if len(out) > 0 {
+			os.Stdout.Write(out)
+		}
+	}
+
+	for _, hookURL := range cfg.PostHookURLs {
+		run(hookURL, func(blob []byte) ([]byte, error) { return postHook(hookURL, blob) })
+	}
+	for _, command := range cfg.PostHookCommands {
+		run(command, func(blob []byte) ([]byte, error) { return execHook(command, blob) })
+	}
+	event.Options = nil
+	return errs
+}
+
+// parseMirrorPost returns the mirrored post that out reports, if any.
+func parseMirrorPost(out []byte) *mirrorPost {
+	out = bytes.TrimSpace(out)
+	if len(out) == 0 || out[0] != '{' {
+		return nil
+	}
+	mirror := new(mirrorPost)
+	if err := json.Unmarshal(out, mirror); err != nil || mirror.Platform == "" || mirror.PostId == "" {
+		return nil
+	}
+	return mirror
+}
+
+// maxHookResponse is the most of a hook's response that is read.
+const maxHookResponse = 64 << 10
+
+func postHook(hookURL string, blob []byte) ([]byte, error) {
+	res, err := hookClient.Post(hookURL, "application/json", bytes.NewReader(blob))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %q", res.Status)
+	}
+	return ioutil.ReadAll(io.LimitReader(res.Body, maxHookResponse))
+}
+
+// hookKillGrace is how long a killed hook is waited on for its
+// output to be closed, beyond which it is abandoned.
+const hookKillGrace = time.Second
+
+// execHook runs the command through the shell with the event on its
+// stdin, killing it and every process it started if it runs for longer
+// than hookTimeout. The processes it started may keep its stdout open,
+// so the hook isn't waited on for more than hookKillGrace after that.
+func execHook(command string, blob []byte) ([]byte, error) {
+	var stdout bytes.Buffer
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(blob)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	setHookProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		return stdout.Bytes(), err
+	case <-time.After(hookTimeout):
+		killHook(cmd)
+		select {
+		case <-done:
+		case <-time.After(hookKillGrace):
+		}
+		return nil, fmt.Errorf("timed out after %s", hookTimeout)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "os/exec"
+
+// setHookProcessGroup does nothing on Windows, which has no process groups
+// to kill at once, where killHook only kills the hook's shell.
+func setHookProcessGroup(cmd *exec.Cmd) {}
+
+func killHook(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
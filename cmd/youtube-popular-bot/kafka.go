@@ -0,0 +1,47 @@
+//go:build kafka
+// +build kafka
+
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Building with -tags kafka registers publishing events to Kafka.
+func init() {
+	eventBrokers[brokerKafka] = func(url, topic string) (eventBus, error) {
+		return &kafkaBus{writer: &kafka.Writer{
+			Addr:         kafka.TCP(strings.Split(url, ",")...),
+			Topic:        topic,
+			RequiredAcks: kafka.RequireOne,
+			BatchTimeout: kafkaBatchTimeout,
+		}}, nil
+	}
+}
+
+// kafkaPublishTimeout bounds how long publishing an event may hold up a cycle.
+const kafkaPublishTimeout = 10 * time.Second
+
+// kafkaBatchTimeout is how long the writer waits for more events to batch
+// with one it was given, which it would otherwise do for a second on every
+// publish, as events are published one at a time.
+const kafkaBatchTimeout = 10 * time.Millisecond
+
+// kafkaBus publishes events to a topic of the comma separated brokers.
+type kafkaBus struct {
+	writer *kafka.Writer
+}
+
+func (b *kafkaBus) Publish(blob []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaPublishTimeout)
+	defer cancel()
+	return b.writer.WriteMessages(ctx, kafka.Message{Value: blob})
+}
+
+func (b *kafkaBus) Close() error {
+	return b.writer.Close()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// leaderboardSize is the most channels a leaderboard lists,
+// fewer if their names would not fit in a tweet.
+const leaderboardSize = 5
+
+// channelStanding is a channel's showing in a month's digests.
+type channelStanding struct {
+	Id, Title string
+
+	// Videos is how many of the channel's videos were in the digests,
+	// each counted once however many digests it stayed in, which
+	// Appearances counts.
+	Videos      int
+	Appearances int
+}
+
+// buildLeaderboard ranks the channels whose videos were in the
+// digests archived in dir that were posted in the month of t, as it
+// is in loc, by how many of their videos were.
+func buildLeaderboard(dir string, t time.Time, loc *time.Location) ([]*channelStanding, error) {
+	year, month, _ := t.In(loc).Date()
+	channels := map[string]*channelStanding{}
+	videos := map[string]bool{}
+	err := forEachDigest(dir, func(dr *digestRecord) error {
+		if y, m, _ := dr.PostedAt.In(loc).Date(); y != year || m != month {
+			return nil
+		}
+		for _, dv := range dr.Videos {
+			if dv.ChannelId == "" {
+				// Digests archived before channels were recorded.
+				continue
+			}
+			cs, ok := channels[dv.ChannelId]
+			if !ok {
+				cs = &channelStanding{Id: dv.ChannelId, Title: dv.ChannelId}
+				channels[dv.ChannelId] = cs
+			}
+			if dv.ChannelTitle != "" {
+				cs.Title = dv.ChannelTitle
+			} else if cs.Title == cs.Id {
+				// Older digests lack the channels' names, which
+				// the archived videos might have.
+				if av, err := loadArchivedVideo(dir, dv.VideoId); err == nil && av.Video != nil && av.Video.ChannelTitle != "" {
+					cs.Title = av.Video.ChannelTitle
+				}
+			}
+			cs.Appearances++
+			if !videos[dv.VideoId] {
+				videos[dv.VideoId] = true
+				cs.Videos++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	board := make([]*channelStanding, 0, len(channels))
+	for _, cs := range channels {
+		board = append(board, cs)
+	}
+	sort.Slice(board, func(i, j int) bool {
+		a, b := board[i], board[j]
+		if a.Videos != b.Videos {
+			return a.Videos > b.Videos
+		}
+		if a.Appearances != b.Appearances {
+			return a.Appearances > b.Appearances
+		}
+		return a.Id < b.Id
+	})
+	return board, nil
+}
+
+// formatLeaderboard lists as many of the leading channels of the month
+// of t as fit in a tweet, or returns "" if there are none.
+func formatLeaderboard(board []*channelStanding, t time.Time) string {
+	if len(board) == 0 {
+		return ""
+	}
+	text := fmt.Sprintf("Channels with the most trending videos in %s:", t.Format("January 2006"))
+	for i, cs := range board {
+		if i == leaderboardSize {
+			break
+		}
+		videos := "videos"
+		if cs.Videos == 1 {
+			videos = "video"
+		}
+		line := fmt.Sprintf("\n%d. %s, %d %s", i+1, truncate(cs.Title, 40), cs.Videos, videos)
+		if tweetLength(text+line) > maxTweetLength {
+			break
+		}
+		text += line
+	}
+	return text
+}
+
+// periodicLeaderboards posts the leaderboard of the month at the times
+// of the leaderboard schedule. One due on the 1st of a month is of the
+// month that just ended.
+func periodicLeaderboards(s *schedule) chan error {
+	_, loc := pacing()
+	return runOnSchedule(s, func(at time.Time) error {
+		month := at.AddDate(0, 0, -1).In(loc)
+		board, err := buildLeaderboard(cfg.ArchiveDir, month, loc)
+		if err != nil {
+			return err
+		}
+		text := formatLeaderboard(board, month)
+		if text == "" {
+			return nil
+		}
+		_, err = postTweet(text, nil)
+		return err
+	})
+}
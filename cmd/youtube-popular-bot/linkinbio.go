@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const linkInBioTmplStr = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Most popular YouTube videos right now</title>
+</head>
+<body>
+<h1>Most popular YouTube videos right now</h1>
+<p>Updated {{.PostedAt.Format "Jan 2, 2006 15:04 MST"}}.{{with .Permalink}} <a href="{{.}}">The whole digest</a>.{{end}}</p>
+<ul>
+{{range .Videos}}
+<li><a href="{{.URL}}">{{if .ThumbnailURL}}<img src="{{.ThumbnailURL}}" alt="" width="320"><br>{{end}}{{.Rank}}. {{.Title}}</a></li>
+{{end}}
+</ul>
+</body>
+</html>`
+
+var linkInBioTemplate = template.Must(template.New("linkinbio").Parse(linkInBioTmplStr))
+
+// linkInBioPage is the latest digest as listed on the link in bio page.
+type linkInBioPage struct {
+	*digestRecord
+	Permalink string
+}
+
+func renderLinkInBio(dr *digestRecord) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	page := &linkInBioPage{digestRecord: dr, Permalink: digestPermalink(dr.Cycle)}
+	if err := linkInBioTemplate.Execute(buf, page); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var linkInBioClient = &http.Client{Timeout: 30 * time.Second}
+
+// publishLinkInBio updates the link in bio page with the digest,
+// writing it to the link in bio file and pushing it to the static
+// host, whichever are set.
+func publishLinkInBio(dr *digestRecord) error {
+	blob, err := renderLinkInBio(dr)
+	if err != nil {
+		return err
+	}
+	if cfg.LinkInBioFile != "" {
+		if err := os.MkdirAll(filepath.Dir(cfg.LinkInBioFile), 0755); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(cfg.LinkInBioFile, blob, 0644); err != nil {
+			return err
+		}
+	}
+	if cfg.LinkInBioPushURL == "" {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodPut, cfg.LinkInBioPushURL, bytes.NewReader(blob))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/html; charset=utf-8")
+	res, err := linkInBioClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("pushing the link in bio page: %s: %s", res.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// serveLinkInBio serves the link in bio page of the latest
+// archived digest.
+func serveLinkInBio(w http.ResponseWriter, req *http.Request, index *siteIndex) {
+	if len(index.cycles) == 0 {
+		http.NotFound(w, req)
+		return
+	}
+	cycle := index.cycles[len(index.cycles)-1]
+	dr, err := loadDigestRecord(cfg.ArchiveDir, cycle)
+	if err != nil {
+		log.Printf("loading digest %q: %v\n", cycle, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	blob, err := renderLinkInBio(dr)
+	if err != nil {
+		log.Printf("rendering the link in bio page of %q: %v\n", cycle, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(blob)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// allowedLinkHosts are the only hosts that composed links, and
+// any redirects they issue, are permitted to point at.
+var allowedLinkHosts = map[string]bool{
+	"youtu.be":            true,
+	"youtube.com":         true,
+	"www.youtube.com":     true,
+	"m.youtube.com":       true,
+	"consent.youtube.com": true,
+}
+
+var errPrivateAddress = errors.New("refusing to connect to a non-public address")
+
+// linkCheckClient dials only public addresses and refuses to follow
+// redirects away from the YouTube hosts, so that validating a link
+// cannot be turned into a request against internal services.
+var linkCheckClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				ip := net.ParseIP(host)
+				if ip == nil || !isPublicIP(ip) {
+					return errPrivateAddress
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return validateLinkURL(req.URL)
+	},
+}
+
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+func validateLinkURL(u *url.URL) error {
+	if u.Scheme != "https" {
+		return fmt.Errorf("%q: only https links are allowed", u)
+	}
+	if !allowedLinkHosts[u.Hostname()] {
+		return fmt.Errorf("%q: host %q is not allowed", u, u.Hostname())
+	}
+	return nil
+}
+
+// checkLink issues a HEAD request for the link and reports
+// an error if it cannot be resolved or does not resolve
+// to a successful response.
+func checkLink(link string) error {
+	u, err := url.Parse(link)
+	if err != nil {
+		return err
+	}
+	if err := validateLinkURL(u); err != nil {
+		return err
+	}
+
+	res, err := linkCheckClient.Head(u.String())
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 399 {
+		return fmt.Errorf("%q: unexpected status %q", link, res.Status)
+	}
+	return nil
+}
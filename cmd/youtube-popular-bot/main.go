@@ -2,14 +2,19 @@ package main
 
 import (
 	"bytes"
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
-	"github.com/odeke-em/youtube"
+	"github.com/odeke-em/youtube-popular-bot/youtube"
 
 	"github.com/ChimeraCoder/anaconda"
 	"github.com/dustin/go-humanize"
@@ -20,22 +25,11 @@ var (
 	youtubeClient *youtube.Client
 )
 
-var (
-	twitterConsumerKey    = envValueAtInit("YOUTUBE_TWITTER_BOT_CONSUMER_KEY")
-	twitterConsumerSecret = envValueAtInit("YOUTUBE_TWITTER_BOT_CONSUMER_SECRET")
-	twitterAccessToken    = envValueAtInit("YOUTUBE_TWITTER_BOT_ACCESS_TOKEN")
-	twitterAccessSecret   = envValueAtInit("YOUTUBE_TWITTER_BOT_ACCESS_SECRET")
-)
-
 var initErrMsgList = []string{}
 
-func envValueAtInit(key string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		initErrMsgList = append(initErrMsgList, fmt.Sprintf("%q is not defined", key))
-	}
-	return value
-}
+// policy if set decides which videos may be posted while
+// shadowPolicy's decisions are only compared against it.
+var policy, shadowPolicy *contentPolicy
 
 func exitOnError(err error) {
 	if err != nil {
@@ -43,132 +37,1088 @@ func exitOnError(err error) {
 	}
 }
 
-func init() {
+var configFile = flag.String("config", "", "a TOML or YAML file of settings, overridden by the environment")
+
+// Flags for the most tuned settings, which override
+// both the environment and the config file.
+var (
+	periodFlag     = flag.Duration("period", 0, "how often a digest is posted, overriding PERIOD")
+	maxPagesFlag   = flag.Int("max-pages", 0, "the most pages of videos fetched, overriding MAX_PAGES")
+	maxResultsFlag = flag.Int("max-results", 0, "the most videos fetched per page, overriding MAX_RESULTS_PER_PAGE")
+	dryRunFlag     = flag.Bool("dry-run", false, "compose and log the tweets without posting anything, overriding DRY_RUN")
+	onceFlag       = flag.Bool("once", false, "run a single cycle and exit, non-zero on failure, overriding ONCE")
+	runAtStartFlag = flag.Bool("run-at-start", false, "run a cycle on starting before following the schedule, overriding RUN_AT_START")
+	regionFlag     = flag.String("region", "", "the ISO 3166-1 alpha-2 code of the country whose trending videos are posted, overriding REGION_CODE")
+)
+
+// applyFlags overrides the configuration with the flags that were set.
+func applyFlags(c *config) {
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "period":
+			c.Period = *periodFlag
+		case "max-pages":
+			c.MaxPages = *maxPagesFlag
+		case "max-results":
+			c.MaxResultsPerPage = *maxResultsFlag
+		case "dry-run":
+			c.DryRun = *dryRunFlag
+		case "once":
+			c.Once = *onceFlag
+		case "run-at-start":
+			c.RunAtStart = *runAtStartFlag
+		case "region":
+			c.RegionCode = strings.ToUpper(*regionFlag)
+		}
+	})
+}
+
+// setup loads the configuration and creates the clients
+// and the state that every command of the bot needs.
+func setup() {
+	var fileValues map[string]string
+	if *configFile != "" {
+		var err error
+		fileValues, err = parseConfigFile(*configFile)
+		exitOnError(err)
+	}
+
+	initErrMsgList = append(initErrMsgList, loadConfig(&cfg, envPrefix(), fileValues)...)
+	applyFlags(&cfg)
+	initErrMsgList = append(initErrMsgList, cfg.validate()...)
 	if len(initErrMsgList) > 0 {
 		msg := fmt.Sprintf("Errors Encountered:\n%s", strings.Join(initErrMsgList, "\n"))
 		exitOnError(fmt.Errorf("%s", msg))
 	}
 
+	exitOnError(migrateState())
+
 	var err error
-	youtubeClient, err = youtube.New()
+	store, err = newStore(cfg.Store)
+	exitOnError(err)
+	exitOnError(queue.restore())
+
+	if cfg.PolicyFile != "" {
+		policy, err = loadPolicy(cfg.PolicyFile)
+		exitOnError(err)
+	}
+	if cfg.ShadowPolicyFile != "" {
+		shadowPolicy, err = loadPolicy(cfg.ShadowPolicyFile)
+		exitOnError(err)
+	}
+	if cfg.PublisherOptionsFile != "" {
+		hookOptions, err = loadPublisherOptions(cfg.PublisherOptionsFile)
+		exitOnError(err)
+	}
+	if cfg.CustomPostsFile != "" {
+		customPosts, err = loadCustomPosts(cfg.CustomPostsFile)
+		exitOnError(err)
+	}
+	if cfg.RegionAccountsFile != "" {
+		regionAccounts, err = loadRegionAccounts(cfg.RegionAccountsFile)
+		exitOnError(err)
+	}
+	if cfg.TemplatesFile != "" {
+		templates, err = loadTemplates(cfg.TemplatesFile)
+		exitOnError(err)
+	}
+	quiet, err = parseQuietHours(cfg.QuietHours, cfg.ScheduleTimezone)
+	exitOnError(err)
+	setSafeMode(cfg.SafeMode)
+
+	chaos := newChaosTransport(cfg.ChaosDropRate, cfg.ChaosThrottleRate)
+
+	apiKey := cfg.YouTubeAPIKey
+	if apiKey == "" {
+		apiKey = strings.TrimSpace(os.Getenv("YOUTUBE_API_KEY"))
+	}
+	var youtubeTransport http.RoundTripper = http.DefaultTransport
+	if chaos != nil {
+		chaos.base = youtubeTransport
+		youtubeTransport = chaos
+	}
+	youtubeClient, err = youtube.NewWithTransport(apiKey, &quotaTransport{base: youtubeTransport})
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	anaconda.SetConsumerKey(twitterConsumerKey)
-	anaconda.SetConsumerSecret(twitterConsumerSecret)
-	twitterAPI = anaconda.NewTwitterApi(twitterAccessToken, twitterAccessSecret)
+	anaconda.SetConsumerKey(cfg.ConsumerKey)
+	anaconda.SetConsumerSecret(cfg.ConsumerSecret)
+	twitterAPI = anaconda.NewTwitterApi(cfg.AccessToken, cfg.AccessSecret)
+	if cfg.TwitterProxy != "" || cfg.TwitterLocalAddr != "" {
+		twitterAPI.HttpClient, err = newEgressClient(cfg.TwitterProxy, cfg.TwitterLocalAddr)
+		exitOnError(err)
+	}
+	if chaos != nil {
+		twitterChaos := *chaos
+		twitterChaos.base = twitterAPI.HttpClient.Transport
+		twitterAPI.HttpClient = &http.Client{Transport: &twitterChaos}
+		log.Printf("chaos mode: failing %.0f%% and throttling %.0f%% of API calls\n",
+			100*cfg.ChaosDropRate, 100*cfg.ChaosThrottleRate)
+	}
+	for _, ra := range regionAccounts {
+		exitOnError(ra.connect())
+	}
+	if cfg.MonitorAccessToken != "" {
+		exitOnError(connectMonitor())
+	}
 }
 
-func periodicTweets(period time.Duration) chan error {
-	tick := time.Tick(period)
+func periodicTweets(period, throttlePeriod time.Duration) chan error {
+	tick, ticksFrom := cycleTicks(period), time.Now()
+	heartbeats := time.Tick(heartbeatInterval)
 	errsChan := make(chan error)
+
+	// waitNextCycle waits for the next cycle's time, or for one to be
+	// triggered, skipping those that come due while paused and applying
+	// any reload of the configuration requested in the meantime.
+	waitNextCycle := func() {
+		for {
+			next := nextCycleAt(ticksFrom, period)
+			updateStatus(func(s *botStatus) { s.NextRun = next })
+			select {
+			case <-tick:
+				if paused() {
+					log.Printf("cycles are paused, skipping this one\n")
+					if err := sendHeartbeat(cycleKey(time.Now()), "paused, nothing posted"); err != nil {
+						errsChan <- err
+					}
+					continue
+				}
+				return
+			case <-triggerRequests:
+				return
+			case <-heartbeats:
+				heartbeat(heartbeatInterval)
+			case <-reloadRequests:
+				schedule := cfg.Schedule + " " + cfg.ScheduleTimezone
+				if err := reloadConfig(); err != nil {
+					errsChan <- fmt.Errorf("reloading the configuration: %v", err)
+					continue
+				}
+				if cfg.Period != period || cfg.Schedule+" "+cfg.ScheduleTimezone != schedule {
+					tick, ticksFrom = cycleTicks(cfg.Period), time.Now()
+				}
+				period, throttlePeriod = cfg.Period, cfg.Throttle
+			}
+		}
+	}
+
 	go func() {
 		defer close(errsChan)
 
+		// A digest that a restart cut short between batches is
+		// finished first, and becomes the last run.
+		if !cfg.Once {
+			for _, err := range resumeBatches(throttlePeriod) {
+				errsChan <- err
+			}
+		}
+
+		// The last run is only consulted by the first cycle after
+		// starting, which is the one that could repeat it.
+		last, err := store.LoadLastRun()
+		if err != nil {
+			errsChan <- err
+		}
+		// previousAt is when the previous snapshot was fetched, which
+		// before the first cycle is about when the last run started.
+		var previousAt time.Time
+		if last != nil {
+			updateStatus(func(s *botStatus) { s.LastRun = last.At })
+			previousAt = last.At
+		}
+
+		// Scheduled cycles run at their times, not when the bot starts,
+		// unless asked to or the bot is run by an external scheduler.
+		// A bot that is restarted within a period of its last run
+		// likewise waits for the rest of it.
+		switch {
+		case cfg.Once || cfg.RunAtStart:
+			// The first cycle runs now.
+		case cfg.Schedule != "":
+			waitNextCycle()
+		case last != nil && time.Since(last.At) < period:
+			resumeAt := last.At.Add(period)
+			log.Printf("the last cycle ran at %s, resuming at %s\n", last.At.Format(time.RFC3339), resumeAt.Format(time.RFC3339))
+			tick, ticksFrom = resumedTicks(resumeAt, period), last.At
+			waitNextCycle()
+		}
+
 		for {
+			if delay := jitter(); delay > 0 {
+				log.Printf("delaying the cycle by %s of jitter\n", delay.Round(time.Second))
+				realClock{}.Sleep(delay)
+			}
+			// A cycle due in quiet hours is held off to their end.
+			waitOutQuietHours(realClock{})
 
-			since := time.Now().Add(-1 * period)
+			cycleStart := time.Now()
+			updateStatus(func(s *botStatus) { s.Running, s.LastRun = true, cycleStart })
+			beginCycleCost(cycleKey(cycleStart))
+			since := cycleStart.Add(-1 * period)
 			param := &youtube.SearchParam{
-				MaxPage: 2,
+				MaxPage: uint64(cfg.MaxPages),
+
+				MaxResultsPerPage: uint64(cfg.MaxResultsPerPage),
 
-				MaxResultsPerPage: 10,
+				RegionCode: cfg.RegionCode,
 			}
 
-			videoPages, err := youtubeClient.MostPopular(param)
+			// The last snapshot is replaced by this cycle's fetch.
+			previous, err := store.LoadSnapshot()
 			if err != nil {
 				errsChan <- err
-				<-tick
-				break
+			}
+			tweetList, source, errs := fetchTweets(param)
+			for _, err := range errs {
+				errsChan <- err
+			}
+			if err := publishEvent(snapshotEvent(cycleKey(cycleStart), source, tweetList)); err != nil {
+				errsChan <- err
+			}
+			fetchedAt := time.Now()
+			if cfg.RankChanges && source != sourceSnapshot {
+				annotateMovement(tweetList, previous)
+			}
+			// Snapshots are of the whole chart, whatever is posted of it.
+			if cfg.SnapshotDir != "" && source != "" && source != sourceSnapshot {
+				if err := archiveTrendingSnapshot(cfg.SnapshotDir, source, fetchedAt, tweetList); err != nil {
+					errsChan <- err
+				}
+			}
+			if cfg.NewEntrantsOnly {
+				tweetList = dropPreviousEntrants(tweetList, previous)
+			}
+			// Snapshots keep the chart's ranks, not those by velocity.
+			fetchedBefore := previousAt
+			if cfg.RankByVelocity && source != sourceSnapshot {
+				rankByVelocity(tweetList, previous, fetchedBefore, fetchedAt)
+			}
+			if source != "" && source != sourceSnapshot {
+				previousAt = fetchedAt
+			}
+			if cfg.PicksFile != "" {
+				picks, err := loadPicks(cfg.PicksFile)
+				if err == nil {
+					tweetList, err = mergePicks(tweetList, picks)
+				}
+				if err != nil {
+					errsChan <- err
+				}
+			}
+			tweetList, errs = screenCandidates(tweetList)
+			for _, err := range errs {
+				errsChan <- err
+			}
+			if cfg.EngagementWeighting {
+				var err error
+				if tweetList, err = rerankByEngagement(tweetList); err != nil {
+					errsChan <- err
+				}
+			}
+			if last != nil && cycleStart.Sub(last.At) < period {
+				tweetList = dropLastRun(tweetList, last)
+			}
+			last = nil
+			if cfg.BotName != "" {
+				var err error
+				if tweetList, err = dropClaimed(tweetList); err != nil {
+					errsChan <- err
+				}
+			}
+			if cfg.DedupTTL > 0 {
+				var err error
+				if tweetList, err = dropRecentlyPosted(tweetList, cfg.DedupTTL, cycleStart); err != nil {
+					errsChan <- err
+				}
+			}
+			var spotlight *tweet
+			if cfg.MaxPosts > 0 && len(tweetList) > cfg.MaxPosts {
+				kept, rest := truncateKeepingPicks(tweetList, cfg.MaxPosts)
+				if cfg.Spotlight && source != sourceSnapshot {
+					spotlight = chooseSpotlight(append(kept[:len(kept):len(kept)], rest...), len(kept), previous, fetchedBefore, fetchedAt)
+				}
+				tweetList = kept
+			}
+			if cfg.NewEntrantsOnly && len(tweetList) == 0 {
+				log.Printf("no videos entered the chart since the last cycle, skipping the digest\n")
+				if err := sendHeartbeat(cycleKey(cycleStart), "no new entrants, nothing posted"); err != nil {
+					errsChan <- err
+				}
+				if err := endCycleCost(); err != nil {
+					errsChan <- err
+				}
+				updateStatus(func(s *botStatus) { s.Running, s.LastRunEnd = false, time.Now() })
+				if cfg.Once {
+					return
+				}
+				waitNextCycle()
+				continue
 			}
 
-			tweetList := []*tweet{}
-			for videoPage := range videoPages {
-				if videoPage.Err != nil {
-					errsChan <- videoPage.Err
-					continue
+			// Let's tweet them in reverse chronological order
+			// and since the first will be the last to be tweeted,
+			// the intro too is the last to be tweeted
+
+			for i, tw := range tweetList {
+				tw.Rank = uint64(i + 1)
+			}
+
+			if cfg.AttachThumbnails {
+				for _, err := range uploadThumbnails(tweetList, cfg.MediaConcurrency) {
+					errsChan <- err
 				}
+			}
+
+			if cfg.RefreshBeforeCompose {
+				if err := refreshTweets(tweetList); err != nil {
+					errsChan <- err
+				} else {
+					fetchedAt = time.Now()
+				}
+			}
 
-				for _, video := range videoPage.Items {
-					snippet := video.Snippet
-					stats := video.Statistics
+			for _, err := range composeTweets(tweetList) {
+				errsChan <- err
+			}
+
+			queue.reset(cycleKey(cycleStart), tweetList)
 
-					tw := &tweet{
-						ViewCount:   stats.ViewCount,
-						Title:       snippet.Title,
-						YouTubeId:   video.Id,
-						Description: snippet.Description,
+			if cfg.RequireApproval {
+				approved, err := awaitApproval(cycleStart, tweetList)
+				if err != nil {
+					errsChan <- err
+				}
+				if !approved {
+					log.Printf("digest of %s was not approved, skipping it\n", cycleKey(cycleStart))
+					if err := sendHeartbeat(cycleKey(cycleStart), "not approved, nothing posted"); err != nil {
+						errsChan <- err
+					}
+					if err := endCycleCost(); err != nil {
+						errsChan <- err
+					}
+					updateStatus(func(s *botStatus) { s.Running, s.LastRunEnd = false, time.Now() })
+					if cfg.Once {
+						return
 					}
-					tweetList = append(tweetList, tw)
+					waitNextCycle()
+					continue
 				}
 			}
 
-			// Let's tweet them in reverse chronological order
-			// and since the first will be the last to be tweeted,
-			// the intro too is the last to be tweeted
+			var postedTexts []string
+			var postedTweets []*tweet
+			freshness := &cycleFreshness{Cycle: cycleKey(cycleStart)}
 
-			throttle := time.Tick(15 * time.Second)
+			// Dry runs go through the same waits on a clock that skips
+			// ahead, to plan when each post would have gone out.
+			var clk clock = realClock{}
+			limit := tweetWindow
+			var timeline []plannedPost
+			if cfg.DryRun {
+				clk = &simClock{now: time.Now()}
+				limit = &rateWindow{max: tweetLimit, per: tweetLimitWindow}
+			}
+			planned := func(what string) {
+				if cfg.DryRun {
+					limit.add(clk.Now())
+					timeline = append(timeline, plannedPost{At: clk.Now(), What: what})
+				}
+			}
+			paced := clk.Now()
+			var batchDue []time.Time
+			if cfg.BatchSize > 0 && len(tweetList) > cfg.BatchSize {
+				batchDue = batchDueTimes(len(tweetList), cfg.BatchSize, clk.Now(), period)
+				queue.planBatches(tweetList, cfg.BatchSize, batchDue)
+			}
 			for rank := len(tweetList); rank > 0; rank-- {
 				tw := tweetList[rank-1]
-				tw.Rank = uint64(rank)
+				if i := len(tweetList) - rank; batchDue != nil && i > 0 && i%cfg.BatchSize == 0 {
+					log.Printf("posted batch %d of %s, the next is due at %s\n",
+						i/cfg.BatchSize, cycleKey(cycleStart), batchDue[i].Format(time.RFC3339))
+					clk.Sleep(batchDue[i].Sub(clk.Now()))
+					paced = clk.Now()
+				}
+				limit.wait(clk)
+				waitOutQuietHours(clk)
+				if cfg.RecheckAvailability {
+					if err := checkAvailable(tw.YouTubeId); err != nil {
+						log.Printf("skipping #%d %q: %v\n", tw.Rank, tw.YouTubeId, err)
+						continue
+					}
+				}
+
+				if cfg.CheckLinks {
+					if err := checkLink(tw.URL); err != nil {
+						log.Printf("skipping #%d %q: %v\n", tw.Rank, tw.YouTubeId, err)
+						continue
+					}
+				}
+
+				if cfg.DigestTTL > 0 && time.Since(fetchedAt) > cfg.DigestTTL {
+					if err := refreshTweets(tweetList[:rank]); err != nil {
+						errsChan <- err
+					} else {
+						fetchedAt = time.Now()
+					}
+				}
+
+				if !queue.claim(tw) {
+					log.Printf("skipping #%d %q: dropped by the operator\n", tw.Rank, tw.YouTubeId)
+					continue
+				}
+
 				tweetText, err := composeTweet(tw)
 				if err != nil {
 					errsChan <- err
+					continue
+				}
+
+				var params url.Values
+				if tw.mediaId != "" {
+					params = url.Values{"media_ids": {tw.mediaId}}
 				}
 
-				result, err := twitterAPI.PostTweet(tweetText, nil)
+				result, err := postTweet(tweetText, params)
 				if err != nil {
 					errsChan <- err
 				}
+				planned(fmt.Sprintf("#%d %s", tw.Rank, tw.Title))
 				log.Printf("result: %v err: %s\n", result, err)
-				<-throttle
+				queue.markDone(tw.YouTubeId, err == nil)
+				if err == nil {
+					tw.postId = result.IdStr
+					freshness.add(tw.video, fetchedAt, time.Now())
+					postedTexts = append(postedTexts, tweetText)
+					postedTweets = append([]*tweet{tw}, postedTweets...)
+				}
+				if err == nil && !cfg.DryRun {
+					if err := store.MarkPosted(tw.YouTubeId, time.Now()); err != nil {
+						errsChan <- err
+					}
+					if cfg.HistoryDB != "" && result.IdStr != "" {
+						pt := &postedTweet{
+							TweetId:     result.IdStr,
+							VideoId:     tw.YouTubeId,
+							Rank:        tw.Rank,
+							Views:       tw.ViewCount,
+							ViewsHidden: tw.ViewsHidden,
+							Cycle:       cycleKey(cycleStart),
+							PostedAt:    time.Now(),
+							Title:       tw.Title,
+						}
+						if tw.video != nil {
+							pt.ChannelId = tw.video.ChannelId
+						}
+						if err := recordPostedTweet(pt); err != nil {
+							errsChan <- err
+						}
+					}
+					if cfg.EngagementWeighting && result.IdStr != "" {
+						if err := recordPostedVideo(result.IdStr, tw); err != nil {
+							errsChan <- err
+						}
+					}
+					event := newPostEvent("video", result, tweetText)
+					event.Rank = tw.Rank
+					event.VideoId = tw.YouTubeId
+					if tw.video != nil {
+						event.CategoryId = tw.video.CategoryId
+					}
+					event.ContentWarning = tw.ContentWarning
+					event.Title = tw.Title
+					event.ViewCount = tw.ViewCount
+					event.ViewsHidden = tw.ViewsHidden
+					event.URL = tw.URL
+					for _, err := range runPostHooks(event) {
+						errsChan <- err
+					}
+					if err := publishEvent(&cycleEvent{Kind: eventPost, Cycle: cycleKey(cycleStart), Post: event}); err != nil {
+						errsChan <- err
+					}
+				}
+				if err == nil && !cfg.DryRun && cfg.ArchiveDir != "" {
+					if err := archiveVideo(cfg.ArchiveDir, tw.video, time.Now()); err != nil {
+						errsChan <- err
+					}
+					if cfg.ArchiveThumbnails {
+						if err := archiveThumbnail(cfg.ArchiveDir, cycleStart, tw.video); err != nil {
+							errsChan <- err
+						}
+					}
+				}
+				if paced = paced.Add(throttlePeriod); paced.Before(clk.Now()) {
+					paced = clk.Now()
+				}
+				clk.Sleep(paced.Sub(clk.Now()))
 			}
 
-			introTweet := fmt.Sprintf("Most Popular/Trending %d YouTube videos for the last %s since %s", len(tweetList), period, since)
+			recordFreshness(freshness)
+
+			introFields := &introData{Count: len(tweetList), Period: period, Since: since}
+			if source != sourceChart {
+				introFields.Source = source
+			}
+			dr := newDigestRecord(cycleKey(cycleStart), since, period, source, postedTweets)
+			if cfg.ArchiveDir != "" && !cfg.DryRun {
+				if err := saveDigestRecord(cfg.ArchiveDir, dr); err != nil {
+					errsChan <- err
+				} else {
+					introFields.Permalink = digestPermalink(cycleKey(cycleStart))
+				}
+			}
+			if (cfg.LinkInBioFile != "" || cfg.LinkInBioPushURL != "") && !cfg.DryRun {
+				if err := publishLinkInBio(dr); err != nil {
+					errsChan <- err
+				}
+			}
 
-			if _, err := twitterAPI.PostTweet(introTweet, nil); err != nil {
+			introTweet, err := composeIntro(introFields)
+			if err != nil {
+				errsChan <- err
+				introTweet = fmt.Sprintf("Most Popular/Trending %d YouTube videos for the last %s since %s", len(tweetList), period, since)
+			}
+			limit.wait(clk)
+			waitOutQuietHours(clk)
+			intro, err := postTweet(introTweet, nil)
+			planned("intro")
+			if cfg.DryRun {
+				logTimeline(cycleKey(cycleStart), cycleStart, timeline)
+			}
+			if err != nil {
 				errsChan <- err
+			} else if !cfg.DryRun {
+				run := &lastRun{At: cycleStart}
+				for _, tw := range postedTweets {
+					run.VideoIds = append(run.VideoIds, tw.YouTubeId)
+				}
+				if err := store.SaveLastRun(run); err != nil {
+					errsChan <- err
+				}
+
+				event := newPostEvent("intro", intro, introTweet)
+				for _, err := range runPostHooks(event) {
+					errsChan <- err
+				}
+				if err := publishEvent(&cycleEvent{Kind: eventPost, Cycle: cycleKey(cycleStart), Post: event}); err != nil {
+					errsChan <- err
+				}
+
+				if cfg.PinIntro && intro.IdStr != "" {
+					if err := repin(intro.IdStr); err != nil {
+						errsChan <- err
+					}
+				}
+
+				if cfg.SubscriberDMs {
+					// Tweets were posted last to first, the digest reads first to last.
+					lines := []string{introTweet}
+					for i := len(postedTexts) - 1; i >= 0; i-- {
+						lines = append(lines, postedTexts[i])
+					}
+					if cfg.Once {
+						// Exiting would cut the digest short.
+						for _, err := range sendDigestToSubscribers(lines, cfg.DMInterval) {
+							errsChan <- err
+						}
+					} else {
+						go func() {
+							for _, err := range sendDigestToSubscribers(lines, cfg.DMInterval) {
+								log.Printf("%v\n", err)
+							}
+						}()
+					}
+				}
 			}
 
-			<-tick
+			outcome := fmt.Sprintf("posted %d of %d videos", len(postedTweets), len(tweetList))
+			switch source {
+			case sourceChart:
+			case "":
+				outcome += ", nothing could be fetched"
+			default:
+				outcome += " from the " + source
+			}
+			if err != nil {
+				outcome += ", the intro failed"
+			}
+			if err := sendHeartbeat(cycleKey(cycleStart), outcome); err != nil {
+				errsChan <- err
+			}
+
+			if spotlight != nil {
+				limit.wait(clk)
+				waitOutQuietHours(clk)
+				if err := postSpotlight(spotlight); err != nil {
+					errsChan <- err
+				}
+			}
+
+			if err := endCycleCost(); err != nil {
+				errsChan <- err
+			}
+			updateStatus(func(s *botStatus) { s.Running, s.LastRunEnd = false, time.Now() })
+			if cfg.Once {
+				return
+			}
+			waitNextCycle()
 		}
 	}()
 
 	return errsChan
 }
 
-const tweetTmplStr = `#{{.Rank}}: {{commafy .ViewCount}} views {{.Title}} {{youtubeURL .YouTubeId}}`
+// dropLastRun leaves out the videos that were posted in the last run,
+// for a cycle that runs again before its period is over.
+func dropLastRun(tweets []*tweet, last *lastRun) []*tweet {
+	posted := map[string]bool{}
+	for _, id := range last.VideoIds {
+		posted[id] = true
+	}
+	var kept []*tweet
+	for _, tw := range tweets {
+		if posted[tw.YouTubeId] {
+			log.Printf("skipping %q: posted in the last run at %s\n", tw.YouTubeId, last.At.Format(time.RFC3339))
+			continue
+		}
+		kept = append(kept, tw)
+	}
+	return kept
+}
+
+// defaultTemplatesStr defines the texts that are posted: "tweet" for
+// a video, "compact" for ranks below those that get the full treatment
+// and "intro" for a digest, out of the shared "header", "stats" and
+// "footer" partials, "changelog" for announcing what the bot covers
+// after a reload, "upload" for a watched channel's new video and
+// "monthly" and "monthlyVideo" for the monthly recap's thread and
+// "spotlight" for a cycle's hidden gem. A templates file can redefine
+// any of them.
+const defaultTemplatesStr = `{{define "header"}}#{{.Rank}}{{with .Movement}} {{.}}{{end}}{{if .EditorsPick}} Editor's pick{{end}}:{{end}}
+{{- define "stats"}}{{if .ViewsHidden}}views hidden{{else}}{{commafy .ViewCount}} {{plural .ViewCount "view" "views"}}{{end}}{{end}}
+{{- define "footer"}}{{youtubeURL .YouTubeId}}{{end}}
+{{- define "tweet"}}{{template "header" .}} {{template "stats" .}} {{.Title}} {{template "footer" .}}{{end}}
+{{- define "compact"}}{{template "header" .}} {{.Title}} {{template "footer" .}}{{end}}
+{{- define "intro"}}Most Popular/Trending {{.Count}} YouTube {{plural .Count "video" "videos"}} for the last {{.Period}} since {{.Since}}
+{{- with .Source}} (via {{.}}){{end}}{{with .Permalink}} {{.}}{{end}}{{end}}
+{{- define "changelog"}}Now covering: {{.Region}}{{with .Categories}}, categories {{.}}{{end}}, {{with .Schedule}}on the schedule {{.}}{{else}}every {{.Every}}{{end}}{{end}}
+{{- define "upload"}}New from {{.ChannelTitle}}: {{.Title}} {{template "footer" .}}{{end}}
+{{- define "monthly"}}Top {{.Count}} YouTube {{plural .Count "video" "videos"}} of {{.Month.Format "January 2006"}}:{{end}}
+{{- define "monthlyVideo"}}{{.Rank}}. {{with .Title}}{{.}}, {{end}}posted {{.Posts}} {{plural .Posts "time" "times"}}, peaking at #{{.BestRank}} {{template "footer" .}}{{end}}
+{{- define "spotlight"}}Hidden gem at #{{.Rank}}: {{.Title}}{{if .ViewsPerHour}}, gaining {{commafy .ViewsPerHour}} views an hour{{end}} {{template "footer" .}}{{end}}`
+
+// youtubeURL returns the short link for the video with the given id,
+// carrying any UTM parameters that were configured.
+func youtubeURL(id string) string {
+	u := &url.URL{
+		Scheme: "https",
+		Host:   "youtu.be",
+		Path:   "/" + id,
+	}
+
+	query := url.Values{}
+	if cfg.UTMSource != "" {
+		query.Set("utm_source", cfg.UTMSource)
+	}
+	if cfg.UTMMedium != "" {
+		query.Set("utm_medium", cfg.UTMMedium)
+	}
+	if cfg.UTMCampaign != "" {
+		query.Set("utm_campaign", cfg.UTMCampaign)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
 
 var tmplFuncs = template.FuncMap{
-	"youtubeURL": func(id string) string { return fmt.Sprintf("https://youtu.be/%s", id) },
+	"youtubeURL": youtubeURL,
+	"plural":     plural,
+	"ordinal":    ordinal,
 	"commafy": func(views uint64) string {
 		return humanize.Comma(int64(views))
 	},
 }
-var tweetTemplate = template.Must(template.New("tweet").Funcs(tmplFuncs).Parse(tweetTmplStr))
+var defaultTemplates = template.Must(template.New("templates").Funcs(tmplFuncs).Parse(defaultTemplatesStr))
 
-func composeTweet(tw *tweet) (string, error) {
+// templates are the default templates, with those
+// of the templates file, if any, overriding them.
+var templates = defaultTemplates
+
+// loadTemplates parses the templates file over the default templates,
+// so that it only needs to redefine the templates it changes.
+func loadTemplates(path string) (*template.Template, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := defaultTemplates.Clone()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmpl.Parse(string(blob)); err != nil {
+		return nil, fmt.Errorf("parsing %q: %v", path, err)
+	}
+	return tmpl, nil
+}
+
+// introData is what the "intro" template is rendered from.
+type introData struct {
+	Count     int
+	Period    time.Duration
+	Since     time.Time
+	Source    string
+	Permalink string
+}
+
+func composeIntro(data *introData) (string, error) {
 	buf := new(bytes.Buffer)
-	if err := tweetTemplate.Execute(buf, tw); err != nil {
+	if err := templates.ExecuteTemplate(buf, "intro", data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// isRich reports whether the rank gets media and full stats.
+func isRich(rank uint64) bool {
+	return cfg.RichRanks <= 0 || rank <= uint64(cfg.RichRanks)
+}
+
+var composeBufPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// composeTweet renders the tweet's text, reusing the previous
+// rendering if none of the fields it is rendered from changed.
+func composeTweet(tw *tweet) (string, error) {
+	key := tw.composeKey()
+	if tw.composed != "" && tw.composedFrom == key {
+		return tw.composed, nil
+	}
+
+	buf := composeBufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer composeBufPool.Put(buf)
+
+	name := "tweet"
+	if !isRich(tw.Rank) {
+		name = "compact"
+	}
+	if err := templates.ExecuteTemplate(buf, name, tw); err != nil {
 		return "", err
 	}
-	return string(buf.Bytes()), nil
+	if n := tweetLength(buf.String()); n > maxTweetLength {
+		return "", fmt.Errorf("tweet is %d characters long, over the limit of %d", n, maxTweetLength)
+	}
+	tw.composed = buf.String()
+	tw.composedFrom = key
+	return tw.composed, nil
+}
+
+// composeKey holds the fields of a tweet that its text is rendered from.
+type composeKey struct {
+	Rank         uint64
+	ViewCount    uint64
+	ViewsHidden  bool
+	Title        string
+	URL          string
+	YouTubeId    string
+	Description  string
+	Labels       string
+	Movement     string
+	ViewsPerHour uint64
+	EditorsPick  bool
+	Thumbnail    string
+}
+
+func (tw *tweet) composeKey() composeKey {
+	key := composeKey{
+		Rank:         tw.Rank,
+		ViewCount:    tw.ViewCount,
+		ViewsHidden:  tw.ViewsHidden,
+		Title:        tw.Title,
+		URL:          tw.URL,
+		YouTubeId:    tw.YouTubeId,
+		Description:  tw.Description,
+		Labels:       strings.Join(tw.Labels, ","),
+		Movement:     tw.Movement,
+		ViewsPerHour: tw.ViewsPerHour,
+		EditorsPick:  tw.EditorsPick,
+	}
+	if tw.Thumbnail != nil {
+		key.Thumbnail = tw.Thumbnail.URL
+	}
+	return key
+}
+
+func newTweet(video *youtube.Video) *tweet {
+	tw := &tweet{
+		YouTubeId: video.Id,
+		URL:       youtubeURL(video.Id),
+	}
+	tw.setVideo(video)
+	return tw
+}
+
+// setVideo updates the tweet's fields from the video's metadata.
+func (tw *tweet) setVideo(video *youtube.Video) {
+	tw.Title = video.Title
+	tw.Description = video.Description
+	tw.ViewCount = video.ViewCount
+	tw.ViewsHidden = video.ViewsHidden
+	tw.Thumbnail = chooseThumbnail(video, cfg.ThumbnailQuality)
+	tw.video = video
 }
 
 type tweet struct {
 	Rank        uint64
 	ViewCount   uint64
+	ViewsHidden bool
 	Title       string
 	URL         string
 	YouTubeId   string
 	Description string
+
+	// Thumbnail is the video's thumbnail of the configured
+	// quality, or the best smaller one that it has.
+	Thumbnail *thumbnail
+
+	video *youtube.Video
+
+	// Labels are attached by the content policy, as is
+	// ContentWarning, the warning to put on the video's posts
+	// on the platforms that support them.
+	Labels         []string
+	ContentWarning string
+
+	// Movement is how the video moved on the chart since the last
+	// cycle, e.g. "▲3", "▼1" or "NEW", if rank changes are shown.
+	Movement string
+
+	// ViewsPerHour is how fast the video gained views, if
+	// videos are ranked by it.
+	ViewsPerHour uint64
+
+	// EditorsPick is set for videos of the picks file.
+	EditorsPick bool
+
+	// composed is the text last rendered
+	// for the tweet from composedFrom.
+	composed     string
+	composedFrom composeKey
+
+	// mediaId is the id of the uploaded media
+	// to attach to the tweet, if any.
+	mediaId string
+
+	// postId is the id of the tweet once posted.
+	postId string
 }
 
 func main() {
-	errsChan := periodicTweets(6 * time.Hour)
+	flag.Parse()
+	setup()
+
+	if args := flag.Args(); len(args) > 0 {
+		switch args[0] {
+		case "backup":
+			exitOnError(backupCommand(args[1:]))
+			return
+		case "restore":
+			exitOnError(restoreCommand(args[1:]))
+			return
+		case "purge":
+			exitOnError(purgeCommand(args[1:]))
+			return
+		case "recap":
+			exitOnError(recapCommand(args[1:]))
+			return
+		case "history":
+			exitOnError(historyCommand(args[1:]))
+			return
+		case "export":
+			exitOnError(exportCommand(args[1:]))
+			return
+		case "custom":
+			exitOnError(customCommand(args[1:]))
+			return
+		case "stats":
+			exitOnError(statsCommand(args[1:]))
+			return
+		default:
+			exitOnError(fmt.Errorf("unknown command %q, expecting backup, restore, purge, recap, history, export, custom or stats", args[0]))
+		}
+	}
+
+	notifyReloads()
+	notifyControlSignals()
+	notifyShutdown()
+
+	if cfg.EventBroker != "" {
+		var err error
+		events, err = connectEvents(cfg.EventBroker, cfg.EventBrokerURL, cfg.EventTopic)
+		exitOnError(err)
+	}
+
+	if cfg.AdminAddr != "" {
+		go func() {
+			log.Fatal(serveDashboard(cfg.AdminAddr))
+		}()
+	}
+
+	if cfg.BotName != "" {
+		exitOnError(saveClaims())
+		if !cfg.Once {
+			go func() {
+				for err := range refreshClaims() {
+					log.Printf("claims: %v\n", err)
+				}
+			}()
+		}
+	}
+
+	if err := seedPosted(); err != nil {
+		log.Printf("seeding posted videos: %v\n", err)
+	}
+
+	if cfg.Once {
+		code := runOnce()
+		closeResources()
+		os.Exit(code)
+	}
+
+	if cfg.SiteAddr != "" {
+		go func() {
+			log.Fatal(serveSite(cfg.SiteAddr))
+		}()
+	}
+
+	if cfg.AnswerMentions {
+		go func() {
+			for err := range pollMentions(cfg.MentionsInterval) {
+				log.Printf("mentions: %v\n", err)
+			}
+		}()
+	}
+
+	if len(cfg.WatchChannels) > 0 {
+		var err error
+		websubSecret, err = newWebSubSecret()
+		exitOnError(err)
+		go func() {
+			log.Fatal(serveWebSubCallback(cfg.WebSubAddr))
+		}()
+		go func() {
+			for err := range subscribeChannels(cfg.WatchChannels) {
+				log.Printf("websub: %v\n", err)
+			}
+		}()
+	}
+
+	if cfg.ComparePeriod > 0 {
+		go func() {
+			for err := range periodicComparisons(cfg.ComparePeriod, cfg.CompareRegions, cfg.CompareTop) {
+				log.Printf("compare: %v\n", err)
+			}
+		}()
+	}
+
+	if cfg.ReportPeriod > 0 {
+		go func() {
+			for err := range periodicReports(cfg.ReportPeriod) {
+				log.Printf("report: %v\n", err)
+			}
+		}()
+	}
+
+	if cfg.LeaderboardSchedule != "" {
+		go func() {
+			for err := range periodicLeaderboards(cfg.leaderboardSchedule) {
+				log.Printf("leaderboard: %v\n", err)
+			}
+		}()
+	}
+
+	if cfg.CategoryChartSchedule != "" {
+		go func() {
+			for err := range periodicCategoryCharts(cfg.categoryChartSchedule) {
+				log.Printf("category chart: %v\n", err)
+			}
+		}()
+	}
+
+	if cfg.MonthlyRecapSchedule != "" {
+		go func() {
+			for err := range periodicMonthlyRecaps(cfg.monthlyRecapSchedule) {
+				log.Printf("monthly recap: %v\n", err)
+			}
+		}()
+	}
+
+	if cfg.WeeklyDigestSchedule != "" {
+		go func() {
+			for err := range periodicWeeklyDigests(cfg.weeklyDigestSchedule) {
+				log.Printf("weekly digest: %v\n", err)
+			}
+		}()
+	}
+
+	for _, ra := range regionAccounts {
+		ra := ra
+		go func() {
+			for err := range periodicRegionDigests(ra) {
+				log.Printf("region %s: %v\n", ra.Region, err)
+			}
+		}()
+	}
+
+	for _, cp := range customPosts {
+		cp := cp
+		go func() {
+			for err := range periodicCustomPost(cp) {
+				log.Printf("custom post %s: %v\n", cp.Name, err)
+			}
+		}()
+	}
+
+	if cfg.RecapSchedule != "" {
+		go func() {
+			for err := range periodicRecaps(cfg.recapSchedule) {
+				log.Printf("recap: %v\n", err)
+			}
+		}()
+	}
+
+	go func() {
+		for err := range superviseWithSystemd() {
+			log.Printf("systemd: %v\n", err)
+		}
+	}()
+
+	errsChan := periodicTweets(cfg.Period, cfg.Throttle)
 	for err := range errsChan {
 		if err != nil {
 			log.Printf("%v\n", err)
+			recordStatusError(err)
+			publishErrorEvent(err)
 		}
 	}
 }
+
+// runOnce runs a single cycle, leaving out the jobs that only make
+// sense for a long running bot, and returns the status to exit with.
+func runOnce() int {
+	failed := false
+	for err := range periodicTweets(cfg.Period, cfg.Throttle) {
+		if err != nil {
+			log.Printf("%v\n", err)
+			publishErrorEvent(err)
+			failed = true
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/odeke-em/youtube-popular-bot/youtube"
+)
+
+var errNoThumbnail = errors.New("video has no thumbnail")
+
+var mediaClient = &http.Client{Timeout: 30 * time.Second}
+
+// thumbnailQualities are the qualities of thumbnails
+// that YouTube provides, from the largest to the smallest.
+var thumbnailQualities = []string{"maxres", "standard", "high", "medium", "default"}
+
+// thumbnail is the thumbnail chosen for a video.
+type thumbnail struct {
+	Quality string
+	URL     string
+	Width   int64
+	Height  int64
+}
+
+// chooseThumbnail returns the video's thumbnail of the given
+// quality, falling back to the next smaller ones that it has.
+func chooseThumbnail(video *youtube.Video, quality string) *thumbnail {
+	if video == nil {
+		return nil
+	}
+
+	start := 0
+	for i, q := range thumbnailQualities {
+		if q == quality {
+			start = i
+			break
+		}
+	}
+
+	for _, q := range thumbnailQualities[start:] {
+		if thumb := video.Thumbnails[q]; thumb != nil && thumb.URL != "" {
+			return &thumbnail{Quality: q, URL: thumb.URL, Width: thumb.Width, Height: thumb.Height}
+		}
+	}
+	return nil
+}
+
+// fetchThumbnail downloads the thumbnail.
+func fetchThumbnail(thumb *thumbnail) ([]byte, error) {
+	if thumb == nil {
+		return nil, errNoThumbnail
+	}
+
+	res, err := mediaClient.Get(thumb.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching thumbnail %q: %s", thumb.URL, res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// uploadThumbnails fetches and uploads the thumbnail of every tweet
+// using at most concurrency workers, recording each media id on its
+// tweet. Tweets whose upload failed, and those of ranks that don't get
+// media, are left to be posted without it.
+func uploadThumbnails(tweets []*tweet, concurrency int) []error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var mu sync.Mutex
+	var errs []error
+
+	var wg sync.WaitGroup
+	sem := make(chan bool, concurrency)
+	for _, tw := range tweets {
+		if tw.Thumbnail == nil || !isRich(tw.Rank) {
+			continue
+		}
+
+		wg.Add(1)
+		sem <- true
+		go func(tw *tweet) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			mediaId, err := uploadThumbnail(tw.Thumbnail)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("uploading thumbnail for %q: %v", tw.YouTubeId, err))
+				mu.Unlock()
+				return
+			}
+			tw.mediaId = mediaId
+		}(tw)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+func uploadThumbnail(thumb *thumbnail) (string, error) {
+	blob, err := fetchThumbnail(thumb)
+	if err != nil {
+		return "", err
+	}
+	media, err := uploadMedia(base64.StdEncoding.EncodeToString(blob))
+	if err != nil {
+		return "", err
+	}
+	return media.MediaIDString, nil
+}
+
+func validThumbnailQuality(quality string) bool {
+	for _, q := range thumbnailQualities {
+		if q == quality {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChimeraCoder/anaconda"
+)
+
+const mentionsStateFile = "mentions.json"
+
+type mentionsState struct {
+	SinceId string `json:"since_id"`
+}
+
+// mentionHandler handles a mention whose text, with the bot's
+// own handle removed, starts with the command it is registered
+// for. args are the words that follow the command.
+type mentionHandler func(mention anaconda.Tweet, args []string) error
+
+var mentionHandlers = map[string]mentionHandler{
+	"subscribe":   handleSubscribe,
+	"unsubscribe": handleUnsubscribe,
+}
+
+// mentionCommand splits the mention's text into a lowercased
+// command and its arguments, skipping any leading @handles.
+func mentionCommand(text string) (string, []string) {
+	fields := strings.Fields(text)
+	for len(fields) > 0 && strings.HasPrefix(fields[0], "@") {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return strings.ToLower(strings.Trim(fields[0], "!?.,")), fields[1:]
+}
+
+// handleMention answers questions asked in the mention
+// or otherwise runs the command it starts with, if any.
+func handleMention(mention anaconda.Tweet) error {
+	if match := trendingQuestion.FindStringSubmatch(mention.Text); match != nil {
+		return handleTrendingQuestion(mention, match[1])
+	}
+
+	command, args := mentionCommand(mention.Text)
+	if handler, ok := mentionHandlers[command]; ok {
+		return handler(mention, args)
+	}
+	return nil
+}
+
+// replyTo replies to the mention, addressing its author.
+func replyTo(mention anaconda.Tweet, text string) error {
+	params := url.Values{"in_reply_to_status_id": {mention.IdStr}}
+	_, err := postTweet("@"+mention.User.ScreenName+" "+text, params)
+	return err
+}
+
+// pollMentions checks for new mentions of the bot every interval
+// and dispatches those carrying a known command to their handler.
+func pollMentions(interval time.Duration) chan error {
+	errsChan := make(chan error)
+	go func() {
+		defer close(errsChan)
+
+		var state mentionsState
+		if err := loadStateFile(mentionsStateFile, &state); err != nil {
+			errsChan <- err
+		}
+
+		tick := time.Tick(interval)
+		for {
+			params := url.Values{"count": {"200"}}
+			if state.SinceId != "" {
+				params.Set("since_id", state.SinceId)
+			}
+
+			mentions, err := twitterAPI.GetMentionsTimeline(params)
+			if err != nil {
+				errsChan <- err
+				<-tick
+				continue
+			}
+
+			// Mentions come newest first, handle them in the order they were made.
+			for i := len(mentions) - 1; i >= 0; i-- {
+				mention := mentions[i]
+				if newer(mention.IdStr, state.SinceId) {
+					state.SinceId = mention.IdStr
+				}
+
+				if err := handleMention(mention); err != nil {
+					errsChan <- err
+				}
+			}
+
+			if err := saveStateFile(mentionsStateFile, &state); err != nil {
+				errsChan <- err
+			}
+
+			<-tick
+		}
+	}()
+
+	return errsChan
+}
+
+// newer reports whether tweet id a is more recent than b.
+func newer(a, b string) bool {
+	ai, _ := strconv.ParseUint(a, 10, 64)
+	bi, _ := strconv.ParseUint(b, 10, 64)
+	return ai > bi
+}
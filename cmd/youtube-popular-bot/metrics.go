@@ -0,0 +1,33 @@
+package main
+
+import (
+	"expvar"
+	"runtime"
+)
+
+// Memory metrics, served with the rest of expvar's variables,
+// including the runtime's "memstats", on /debug/vars.
+var (
+	fetchAllocBytes = expvar.NewInt("fetch_alloc_bytes")
+	fetchAllocTotal = expvar.NewInt("fetch_alloc_bytes_total")
+	fetchHeapInuse  = expvar.NewInt("fetch_heap_inuse_bytes")
+	fetchCount      = expvar.NewInt("fetches")
+)
+
+func readMemStats() *runtime.MemStats {
+	ms := new(runtime.MemStats)
+	runtime.ReadMemStats(ms)
+	return ms
+}
+
+// recordFetchAllocs records how much was allocated since start,
+// which is dominated by decoding the API's responses.
+func recordFetchAllocs(start *runtime.MemStats) {
+	end := readMemStats()
+	allocated := int64(end.TotalAlloc - start.TotalAlloc)
+
+	fetchAllocBytes.Set(allocated)
+	fetchAllocTotal.Add(allocated)
+	fetchHeapInuse.Set(int64(end.HeapInuse))
+	fetchCount.Add(1)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/ChimeraCoder/anaconda"
+)
+
+// monitorAPI is the client of the private monitoring account
+// that heartbeats are tweeted to, if one is configured.
+var monitorAPI *anaconda.TwitterApi
+
+// connectMonitor creates the monitoring account's client,
+// egressing like the bot's own.
+func connectMonitor() error {
+	monitorAPI = anaconda.NewTwitterApi(cfg.MonitorAccessToken, cfg.MonitorAccessSecret)
+	if cfg.TwitterProxy != "" || cfg.TwitterLocalAddr != "" {
+		client, err := newEgressClient(cfg.TwitterProxy, cfg.TwitterLocalAddr)
+		if err != nil {
+			return err
+		}
+		monitorAPI.HttpClient = client
+	}
+	return nil
+}
+
+// sendHeartbeat tells the monitoring account, or the monitoring screen
+// name by direct message, how the cycle ended, whether or not anything
+// was posted publicly, so that a silent failure can be told apart from
+// an intentionally quiet cycle. Heartbeats go out even while Twitter is
+// disabled for the public posts.
+func sendHeartbeat(cycle, outcome string) error {
+	if monitorAPI == nil && cfg.MonitorScreenName == "" {
+		return nil
+	}
+	text := fmt.Sprintf("Cycle %s: %s", cycle, outcome)
+	if !publisherEnabled(twitterPublisher) {
+		text += ", Twitter is disabled"
+	}
+	if cfg.DryRun {
+		log.Printf("dry run: would send the heartbeat %q\n", text)
+		return nil
+	}
+	if monitorAPI != nil {
+		_, err := monitorAPI.PostTweet(text, nil)
+		return err
+	}
+	countCost(func(c *cycleCost) { c.DMs++ })
+	_, err := twitterAPI.PostDMToScreenName(text, cfg.MonitorScreenName)
+	return err
+}
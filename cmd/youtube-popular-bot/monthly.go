@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// monthlyTopSize is how many videos the monthly recap lists.
+const monthlyTopSize = 10
+
+// monthlyVideo is a video's showing in a month's history, as the
+// "monthlyVideo" template is rendered from it.
+type monthlyVideo struct {
+	Rank      uint64
+	YouTubeId string
+
+	// Title is only known for videos in the archive.
+	Title string
+
+	// Posts is how many times the video was posted in the
+	// month, and BestRank the highest rank it was posted at.
+	Posts    int
+	BestRank uint64
+
+	// ViewCount is that of its latest post that counted them.
+	ViewCount   uint64
+	ViewsHidden bool
+}
+
+// monthlyData is what the "monthly" template is rendered from.
+type monthlyData struct {
+	Month time.Time
+	Count int
+}
+
+// buildMonthlyTop ranks the videos posted in the month of t, as it is
+// in loc, by how many times they were posted, then by the highest rank
+// they were posted at.
+func buildMonthlyTop(t time.Time, loc *time.Location) ([]*monthlyVideo, error) {
+	year, month, _ := t.In(loc).Date()
+	start := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	end := start.AddDate(0, 1, 0)
+	tweets, err := postedTweetsSince(start)
+	if err != nil {
+		return nil, err
+	}
+
+	videos := map[string]*monthlyVideo{}
+	for _, pt := range tweets {
+		if !pt.PostedAt.Before(end) {
+			continue
+		}
+		mv, ok := videos[pt.VideoId]
+		if !ok {
+			mv = &monthlyVideo{YouTubeId: pt.VideoId, BestRank: pt.Rank, ViewsHidden: true}
+			videos[pt.VideoId] = mv
+		}
+		mv.Posts++
+		if pt.Rank < mv.BestRank {
+			mv.BestRank = pt.Rank
+		}
+		// Tweets are oldest first.
+		if !pt.ViewsHidden {
+			mv.ViewCount, mv.ViewsHidden = pt.Views, false
+		}
+	}
+
+	top := make([]*monthlyVideo, 0, len(videos))
+	for _, mv := range videos {
+		top = append(top, mv)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		a, b := top[i], top[j]
+		if a.Posts != b.Posts {
+			return a.Posts > b.Posts
+		}
+		if a.BestRank != b.BestRank {
+			return a.BestRank < b.BestRank
+		}
+		return a.YouTubeId < b.YouTubeId
+	})
+	if len(top) > monthlyTopSize {
+		top = top[:monthlyTopSize]
+	}
+	for i, mv := range top {
+		mv.Rank = uint64(i + 1)
+		if cfg.ArchiveDir == "" {
+			continue
+		}
+		if av, err := loadArchivedVideo(cfg.ArchiveDir, mv.YouTubeId); err == nil && av.Video != nil {
+			mv.Title = av.Video.Title
+		}
+	}
+	return top, nil
+}
+
+// monthlyRecapTexts renders the posts of the recap's thread, its
+// intro followed by a post for every video.
+func monthlyRecapTexts(month time.Time, top []*monthlyVideo) ([]string, error) {
+	buf := new(bytes.Buffer)
+	if err := templates.ExecuteTemplate(buf, "monthly", &monthlyData{Month: month, Count: len(top)}); err != nil {
+		return nil, err
+	}
+	texts := []string{buf.String()}
+	for _, mv := range top {
+		buf.Reset()
+		if err := templates.ExecuteTemplate(buf, "monthlyVideo", mv); err != nil {
+			return nil, err
+		}
+		texts = append(texts, buf.String())
+	}
+	return texts, nil
+}
+
+// monthlyCollage returns the collage of the thumbnails of the month's
+// top videos, or nil if none of them are in the archive.
+func monthlyCollage(top []*monthlyVideo) ([]byte, error) {
+	var urls []string
+	for _, mv := range top {
+		av, err := loadArchivedVideo(cfg.ArchiveDir, mv.YouTubeId)
+		if err != nil {
+			continue
+		}
+		if thumb := chooseThumbnail(av.Video, cfg.ThumbnailQuality); thumb != nil {
+			urls = append(urls, thumb.URL)
+		}
+	}
+	blob, cells, err := renderCollage(urls)
+	if err != nil || cells == 0 {
+		return nil, err
+	}
+	return blob, nil
+}
+
+// postMonthlyRecap posts the thread of the top videos of the month of
+// t, with the collage of their thumbnails on its intro if configured,
+// doing nothing if no video was posted in the month.
+func postMonthlyRecap(t time.Time, loc *time.Location, throttle time.Duration) error {
+	top, err := buildMonthlyTop(t, loc)
+	if err != nil {
+		return err
+	}
+	if len(top) == 0 {
+		return nil
+	}
+	var texts []string
+	err = withReloadable(func() (err error) {
+		texts, err = monthlyRecapTexts(t, top)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	params := url.Values{}
+	if cfg.MonthlyRecapImage {
+		blob, err := monthlyCollage(top)
+		if err != nil {
+			return err
+		}
+		if blob != nil {
+			media, err := uploadMedia(base64.StdEncoding.EncodeToString(blob))
+			if err != nil {
+				return fmt.Errorf("uploading the monthly recap's collage: %v", err)
+			}
+			if media.MediaIDString != "" {
+				params.Set("media_ids", media.MediaIDString)
+			}
+		}
+	}
+	return postThreadWith(postTweet, texts, params, func(int) { time.Sleep(throttle) })
+}
+
+// periodicMonthlyRecaps posts the monthly recap at the times of its
+// schedule. One due on the 1st of a month is of the month that just
+// ended.
+func periodicMonthlyRecaps(s *schedule) chan error {
+	throttle, loc := pacing()
+	return runOnSchedule(s, func(at time.Time) error {
+		return postMonthlyRecap(at.AddDate(0, 0, -1), loc, throttle)
+	})
+}
@@ -0,0 +1,32 @@
+//go:build nats
+// +build nats
+
+package main
+
+import "github.com/nats-io/nats.go"
+
+// Building with -tags nats registers publishing events to NATS.
+func init() {
+	eventBrokers[brokerNATS] = func(url, subject string) (eventBus, error) {
+		conn, err := nats.Connect(url, nats.MaxReconnects(-1))
+		if err != nil {
+			return nil, err
+		}
+		return &natsBus{conn: conn, subject: subject}, nil
+	}
+}
+
+// natsBus publishes events on a subject of a NATS server.
+type natsBus struct {
+	conn    *nats.Conn
+	subject string
+}
+
+func (b *natsBus) Publish(blob []byte) error {
+	return b.conn.Publish(b.subject, blob)
+}
+
+// Close delivers the events still buffered before disconnecting.
+func (b *natsBus) Close() error {
+	return b.conn.Drain()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// editorsPick is a video that editors curated for the digest, placed
+// at Position, counting from 1, or after the fetched videos if unset.
+type editorsPick struct {
+	VideoId  string `json:"video_id"`
+	Position int    `json:"position,omitempty"`
+}
+
+// loadPicks reads the picks file, a JSON list of picks or, if its name
+// ends in .csv, rows of a video id and an optional position.
+func loadPicks(path string) ([]*editorsPick, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var picks []*editorsPick
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		r := csv.NewReader(bytes.NewReader(blob))
+		r.FieldsPerRecord = -1
+		r.Comment = '#'
+		rows, err := r.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		for i, row := range rows {
+			pick := &editorsPick{VideoId: strings.TrimSpace(row[0])}
+			if i == 0 && pick.VideoId == "video_id" {
+				// The header.
+				continue
+			}
+			if len(row) > 1 && strings.TrimSpace(row[1]) != "" {
+				if pick.Position, err = strconv.Atoi(strings.TrimSpace(row[1])); err != nil {
+					return nil, fmt.Errorf("%s: row %d: invalid position %q", path, i+1, row[1])
+				}
+			}
+			picks = append(picks, pick)
+		}
+	} else if err := json.Unmarshal(blob, &picks); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	for i, pick := range picks {
+		if pick.VideoId == "" {
+			return nil, fmt.Errorf("%s: pick #%d needs a video id", path, i+1)
+		}
+		if pick.Position < 0 {
+			return nil, fmt.Errorf("%s: %s: position must not be negative, got %d", path, pick.VideoId, pick.Position)
+		}
+	}
+	return picks, nil
+}
+
+// mergePicks fetches the picked videos and merges them, flagged as
+// editor's picks, into the fetched tweets at their positions. Picks
+// that were fetched anyway are only flagged and picks of videos that
+// no longer exist are left out.
+func mergePicks(tweets []*tweet, picks []*editorsPick) ([]*tweet, error) {
+	fetched := make(map[string]*tweet, len(tweets))
+	for _, tw := range tweets {
+		fetched[tw.YouTubeId] = tw
+	}
+	var ids []string
+	for _, pick := range picks {
+		if tw, ok := fetched[pick.VideoId]; ok {
+			tw.EditorsPick = true
+		} else {
+			ids = append(ids, pick.VideoId)
+		}
+	}
+	if len(ids) == 0 {
+		return tweets, nil
+	}
+
+	videos, err := videosById(ids)
+	// Picks without a position go after the fetched videos,
+	// and those with one are placed lowest first.
+	var positioned []*editorsPick
+	for _, pick := range picks {
+		video, ok := videos[pick.VideoId]
+		if !ok || fetched[pick.VideoId] != nil {
+			continue
+		}
+		tw := newTweet(video)
+		tw.EditorsPick = true
+		fetched[pick.VideoId] = tw
+		if pick.Position == 0 {
+			tweets = append(tweets, tw)
+		} else {
+			positioned = append(positioned, pick)
+		}
+	}
+	sort.SliceStable(positioned, func(i, j int) bool { return positioned[i].Position < positioned[j].Position })
+	for _, pick := range positioned {
+		i := pick.Position - 1
+		if i > len(tweets) {
+			i = len(tweets)
+		}
+		tweets = append(tweets, nil)
+		copy(tweets[i+1:], tweets[i:])
+		tweets[i] = fetched[pick.VideoId]
+	}
+	return tweets, err
+}
+
+// truncateKeepingPicks keeps n of the tweets, in order, making room
+// for the editors' picks among them by leaving out the last fetched
+// videos, so that picks placed after them are posted too. It also
+// returns the tweets left out.
+func truncateKeepingPicks(tweets []*tweet, n int) (kept, rest []*tweet) {
+	picks := 0
+	for _, tw := range tweets {
+		if tw.EditorsPick {
+			picks++
+		}
+	}
+	if picks > n {
+		picks = n
+	}
+	fetched := n - picks
+	for _, tw := range tweets {
+		switch {
+		case tw.EditorsPick && picks > 0:
+			picks--
+		case !tw.EditorsPick && fetched > 0:
+			fetched--
+		default:
+			rest = append(rest, tw)
+			continue
+		}
+		kept = append(kept, tw)
+	}
+	return kept, rest
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/garyburd/go-oauth/oauth"
+)
+
+// Twitter's v1.1 API does not document pinning, these are
+// the endpoints used by Twitter's own clients.
+const (
+	pinTweetURL   = "https://api.twitter.com/1.1/account/pin_tweet.json"
+	unpinTweetURL = "https://api.twitter.com/1.1/account/unpin_tweet.json"
+)
+
+const (
+	pinAttempts = 3
+	pinDelay    = 5 * time.Second
+)
+
+type pinState struct {
+	TweetId  string    `json:"tweet_id"`
+	PinnedAt time.Time `json:"pinned_at"`
+}
+
+var (
+	pinMu       sync.Mutex
+	inMemoryPin pinState
+)
+
+func pinStatePath() string {
+	return filepath.Join(cfg.StateDir, "pin.json")
+}
+
+func loadPinState() (pinState, error) {
+	if cfg.StateDir == "" {
+		return inMemoryPin, nil
+	}
+
+	var ps pinState
+	blob, err := ioutil.ReadFile(pinStatePath())
+	if os.IsNotExist(err) {
+		return ps, nil
+	}
+	if err != nil {
+		return ps, err
+	}
+	err = json.Unmarshal(blob, &ps)
+	return ps, err
+}
+
+func savePinState(ps pinState) error {
+	inMemoryPin = ps
+	if cfg.StateDir == "" {
+		return nil
+	}
+
+	blob, err := json.Marshal(ps)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cfg.StateDir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(pinStatePath(), blob, 0600)
+}
+
+func postPinRequest(endpoint, tweetId string) error {
+	client := &oauth.Client{
+		Credentials: oauth.Credentials{
+			Token:  cfg.ConsumerKey,
+			Secret: cfg.ConsumerSecret,
+		},
+	}
+	form := url.Values{"id": {tweetId}}
+	res, err := client.Post(twitterAPI.HttpClient, twitterAPI.Credentials, endpoint, form)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("%s %q: %s %s", endpoint, tweetId, res.Status, body)
+	}
+	return nil
+}
+
+// repin unpins the intro pinned in the previous cycle and then
+// pins tweetId, recording it so that the next cycle can unpin it.
+func repin(tweetId string) error {
+	pinMu.Lock()
+	defer pinMu.Unlock()
+
+	prev, err := loadPinState()
+	if err != nil {
+		return err
+	}
+	if prev.TweetId == tweetId {
+		return nil
+	}
+
+	if prev.TweetId != "" {
+		err := retry(pinAttempts, pinDelay, func() error {
+			return postPinRequest(unpinTweetURL, prev.TweetId)
+		})
+		if err != nil {
+			// The previous intro could have been deleted or unpinned
+			// by hand; pinning the new one replaces it either way.
+			log.Printf("unpinning %q: %v\n", prev.TweetId, err)
+		}
+	}
+
+	err = retry(pinAttempts, pinDelay, func() error {
+		return postPinRequest(pinTweetURL, tweetId)
+	})
+	if err != nil {
+		return err
+	}
+
+	return savePinState(pinState{TweetId: tweetId, PinnedAt: time.Now()})
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/odeke-em/youtube-popular-bot/youtube"
+)
+
+// Actions that a policy rule can take.
+const (
+	policyAllow = "allow"
+	policyDeny  = "deny"
+	policyLabel = "label"
+	policyWarn  = "warn"
+)
+
+// policyRule matches videos that satisfy all of its conditions, a
+// condition being satisfied by any one of its values. Empty conditions
+// are ignored so a rule without any conditions matches every video.
+type policyRule struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+
+	// Label is attached to matching videos by label rules, and
+	// Warning is the content warning of their posts by warn rules.
+	Label   string `json:"label,omitempty"`
+	Warning string `json:"warning,omitempty"`
+
+	Categories []string `json:"categories,omitempty"`
+	Channels   []string `json:"channels,omitempty"`
+
+	// Keywords are matched, ignoring case, against
+	// the title, description and tags of the video.
+	Keywords []string `json:"keywords,omitempty"`
+
+	// Languages are matched against the default audio language and
+	// the default language of the video, "en" matching "en-GB" too.
+	Languages []string `json:"languages,omitempty"`
+
+	// AgeRestricted if set matches videos that
+	// are, or aren't, restricted to adult viewers.
+	AgeRestricted *bool `json:"age_restricted,omitempty"`
+}
+
+// contentPolicy evaluates videos against its rules in order. The first
+// allow or deny rule that matches decides, while every matching label
+// rule attaches its label and every matching warn rule its warning.
+// Videos no allow or deny rule matches get the default action.
+type contentPolicy struct {
+	Default string        `json:"default"`
+	Rules   []*policyRule `json:"rules"`
+}
+
+// policyDecision records why a video was allowed or denied.
+type policyDecision struct {
+	Time    time.Time `json:"time"`
+	VideoId string    `json:"video_id"`
+	Title   string    `json:"title"`
+	Action  string    `json:"action"`
+	Rule    string    `json:"rule"`
+	Labels  []string  `json:"labels,omitempty"`
+
+	// Warnings are the content warnings of the video's posts.
+	Warnings []string `json:"warnings,omitempty"`
+
+	// Shadow is set for decisions of the shadow policy,
+	// which are only logged and never acted upon.
+	Shadow bool `json:"shadow,omitempty"`
+}
+
+func loadPolicy(path string) (*contentPolicy, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := new(contentPolicy)
+	if err := json.Unmarshal(blob, policy); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := policy.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return policy, nil
+}
+
+func (p *contentPolicy) validate() error {
+	if p.Default == "" {
+		p.Default = policyAllow
+	}
+	if p.Default != policyAllow && p.Default != policyDeny {
+		return fmt.Errorf("default must be %q or %q, got %q", policyAllow, policyDeny, p.Default)
+	}
+	for i, rule := range p.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule #%d", i+1)
+		}
+		switch rule.Action {
+		case policyAllow, policyDeny:
+		case policyLabel:
+			if rule.Label == "" {
+				return fmt.Errorf("%s: label rules need a label", rule.Name)
+			}
+		case policyWarn:
+			if rule.Warning == "" {
+				return fmt.Errorf("%s: warn rules need a warning", rule.Name)
+			}
+		default:
+			return fmt.Errorf("%s: unknown action %q", rule.Name, rule.Action)
+		}
+	}
+	return nil
+}
+
+func anyEqualFold(values []string, s string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesLanguage(languages []string, lang string) bool {
+	lang = strings.ToLower(lang)
+	for _, want := range languages {
+		want = strings.ToLower(want)
+		if lang == want || strings.HasPrefix(lang, want+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *policyRule) matches(video *youtube.Video) bool {
+	if len(r.Categories) > 0 && !anyEqualFold(r.Categories, video.CategoryId) {
+		return false
+	}
+	if len(r.Channels) > 0 && !anyEqualFold(r.Channels, video.ChannelId) {
+		return false
+	}
+	if len(r.Languages) > 0 &&
+		!matchesLanguage(r.Languages, video.DefaultAudioLanguage) &&
+		!matchesLanguage(r.Languages, video.DefaultLanguage) {
+		return false
+	}
+	if r.AgeRestricted != nil && *r.AgeRestricted != video.AgeRestricted {
+		return false
+	}
+	if len(r.Keywords) > 0 {
+		haystack := strings.ToLower(video.Title + "\n" + video.Description + "\n" + strings.Join(video.Tags, "\n"))
+		found := false
+		for _, keyword := range r.Keywords {
+			if strings.Contains(haystack, strings.ToLower(keyword)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// evaluate decides whether the video is allowed and
+// which labels and content warnings it gets.
+func (p *contentPolicy) evaluate(video *youtube.Video) *policyDecision {
+	decision := &policyDecision{
+		Time:    time.Now(),
+		VideoId: video.Id,
+		Action:  p.Default,
+		Rule:    "default",
+		Title:   video.Title,
+	}
+
+	decided := false
+	for _, rule := range p.Rules {
+		if !rule.matches(video) {
+			continue
+		}
+		if rule.Action == policyLabel {
+			decision.Labels = append(decision.Labels, rule.Label)
+			continue
+		}
+		if rule.Action == policyWarn {
+			decision.Warnings = append(decision.Warnings, rule.Warning)
+			continue
+		}
+		if !decided {
+			decision.Action = rule.Action
+			decision.Rule = rule.Name
+			decided = true
+		}
+	}
+	return decision
+}
+
+var policyLogMu sync.Mutex
+
+// logPolicyDecisions appends the decisions, one JSON object per
+// line, to the log file so that every decision can be audited.
+func logPolicyDecisions(path string, decisions []*policyDecision) error {
+	policyLogMu.Lock()
+	defer policyLogMu.Unlock()
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, decision := range decisions {
+		if err := enc.Encode(decision); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// applyPolicy drops the tweets whose videos the policy denies and
+// attaches labels and content warnings to the remaining ones,
+// logging every decision.
+func applyPolicy(policy *contentPolicy, tweets []*tweet) ([]*tweet, error) {
+	var decisions []*policyDecision
+	kept := make([]*tweet, 0, len(tweets))
+	for _, tw := range tweets {
+		if tw.video == nil {
+			kept = append(kept, tw)
+			continue
+		}
+		decision := policy.evaluate(tw.video)
+		decisions = append(decisions, decision)
+		if decision.Action == policyDeny {
+			continue
+		}
+		tw.Labels = decision.Labels
+		tw.ContentWarning = strings.Join(decision.Warnings, ", ")
+		kept = append(kept, tw)
+	}
+
+	var err error
+	if cfg.PolicyLog != "" {
+		err = logPolicyDecisions(cfg.PolicyLog, decisions)
+	}
+	return kept, err
+}
@@ -0,0 +1,13 @@
+//go:build postgres
+// +build postgres
+
+package main
+
+// Building with -tags postgres registers the Postgres store.
+import _ "github.com/lib/pq"
+
+func init() {
+	storeBackends[storePostgres] = func(dsn string) (Store, error) {
+		return openSQLStore("postgres", dsn, true)
+	}
+}
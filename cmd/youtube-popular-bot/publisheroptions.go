@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Platforms that hooks mirror posts to and that take options.
+const (
+	platformMastodon = "mastodon"
+	platformBluesky  = "bluesky"
+)
+
+// mastodonVisibilities are the visibilities of Mastodon statuses.
+var mastodonVisibilities = []string{"public", "unlisted", "private", "direct"}
+
+// defaultWarningLabels are the Bluesky self-labels of
+// posts that the content policy put a warning on.
+var defaultWarningLabels = []string{"graphic-media"}
+
+// publisherOptions are the options of the platform that a hook mirrors
+// posts to, which the hook receives with every post to apply to it.
+type publisherOptions struct {
+	Platform string `json:"platform"`
+
+	// Visibility is that of Mastodon statuses, and ContentWarnings the
+	// spoiler texts of the statuses about videos of the categories.
+	Visibility      string            `json:"visibility,omitempty"`
+	ContentWarnings map[string]string `json:"content_warnings,omitempty"`
+
+	// Labels are the Bluesky self-labels, e.g. "graphic-media", of
+	// every post, CategoryLabels those of posts about videos of the
+	// categories and WarningLabels those of posts about videos that
+	// the content policy put a warning on, by default "graphic-media".
+	Labels         []string            `json:"labels,omitempty"`
+	CategoryLabels map[string][]string `json:"category_labels,omitempty"`
+	WarningLabels  []string            `json:"warning_labels,omitempty"`
+}
+
+// postOptions are the options of a post for the
+// platform that the hook receiving it mirrors it to.
+type postOptions struct {
+	Platform       string   `json:"platform"`
+	Visibility     string   `json:"visibility,omitempty"`
+	ContentWarning string   `json:"content_warning,omitempty"`
+	Labels         []string `json:"labels,omitempty"`
+}
+
+// hookOptions are the options of the hooks by their URL or command.
+var hookOptions map[string]*publisherOptions
+
+func loadPublisherOptions(path string) (map[string]*publisherOptions, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var options map[string]*publisherOptions
+	if err := json.Unmarshal(blob, &options); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for name, opts := range options {
+		if !isPostHook(name) {
+			return nil, fmt.Errorf("%s: %q is not a post hook", path, name)
+		}
+		if err := opts.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", path, name, err)
+		}
+	}
+	return options, nil
+}
+
+func isPostHook(name string) bool {
+	for _, hook := range append(cfg.PostHookURLs, cfg.PostHookCommands...) {
+		if hook == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *publisherOptions) validate() error {
+	switch o.Platform {
+	case platformMastodon:
+		if len(o.Labels) > 0 || len(o.CategoryLabels) > 0 || len(o.WarningLabels) > 0 {
+			return fmt.Errorf("labels are only for %s", platformBluesky)
+		}
+		if o.Visibility != "" && !anyEqualFold(mastodonVisibilities, o.Visibility) {
+			return fmt.Errorf("visibility must be one of %v, got %q", mastodonVisibilities, o.Visibility)
+		}
+	case platformBluesky:
+		if o.Visibility != "" || len(o.ContentWarnings) > 0 {
+			return fmt.Errorf("visibility and content warnings are only for %s", platformMastodon)
+		}
+		if len(o.WarningLabels) == 0 {
+			o.WarningLabels = defaultWarningLabels
+		}
+	default:
+		return fmt.Errorf("platform must be %q or %q, got %q", platformMastodon, platformBluesky, o.Platform)
+	}
+	return nil
+}
+
+// forPost returns the options of the post about a video of the
+// category that the content policy put the warning on, both of which
+// are empty for posts not about a video. On Mastodon the policy's
+// warning goes along with that of the category, on Bluesky it adds
+// the warning labels.
+func (o *publisherOptions) forPost(categoryId, warning string) *postOptions {
+	po := &postOptions{
+		Platform:   o.Platform,
+		Visibility: o.Visibility,
+		Labels:     append([]string(nil), o.Labels...),
+	}
+	po.Labels = append(po.Labels, o.CategoryLabels[categoryId]...)
+
+	var warnings []string
+	if cw := o.ContentWarnings[categoryId]; cw != "" {
+		warnings = append(warnings, cw)
+	}
+	if warning != "" {
+		warnings = append(warnings, warning)
+		if o.Platform == platformBluesky {
+			po.Labels = append(po.Labels, o.WarningLabels...)
+		}
+	}
+	if o.Platform == platformMastodon {
+		po.ContentWarning = strings.Join(warnings, ", ")
+	}
+	return po
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// twitterPublisher is the name of the bot's own account among the
+// publishers, the others being the post hooks named by their URL or
+// command.
+const twitterPublisher = "twitter"
+
+// disabledPublishers are those that the operator switched off from the
+// dashboard, e.g. during an outage. They are all enabled on starting.
+var (
+	publishersMu       sync.Mutex
+	disabledPublishers = map[string]bool{}
+)
+
+// publisher is a publisher as listed on the dashboard.
+type publisher struct {
+	Name    string
+	Enabled bool
+}
+
+func publishers() []publisher {
+	names := append([]string{twitterPublisher}, cfg.PostHookURLs...)
+	names = append(names, cfg.PostHookCommands...)
+
+	publishersMu.Lock()
+	defer publishersMu.Unlock()
+	list := make([]publisher, 0, len(names))
+	for _, name := range names {
+		list = append(list, publisher{Name: name, Enabled: !disabledPublishers[name]})
+	}
+	return list
+}
+
+func publisherEnabled(name string) bool {
+	publishersMu.Lock()
+	defer publishersMu.Unlock()
+	return !disabledPublishers[name]
+}
+
+func setPublisherEnabled(name string, enabled bool) error {
+	known := false
+	for _, p := range publishers() {
+		known = known || p.Name == name
+	}
+	if !known {
+		return fmt.Errorf("unknown publisher %q", name)
+	}
+
+	publishersMu.Lock()
+	defer publishersMu.Unlock()
+	if disabledPublishers[name] == enabled {
+		log.Printf("publisher %q is now %s\n", name, onOff(enabled))
+	}
+	if enabled {
+		delete(disabledPublishers, name)
+	} else {
+		disabledPublishers[name] = true
+	}
+	return nil
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// purgedStateFile lists the videos and channels that were purged.
+const purgedStateFile = "purged.json"
+
+// purgedVideos are the videos and channels that were purged, which are
+// never posted again, although no record of posting them is left.
+type purgedVideos struct {
+	VideoIds   []string `json:"video_ids,omitempty"`
+	ChannelIds []string `json:"channel_ids,omitempty"`
+}
+
+func loadPurged() (*purgedVideos, error) {
+	purged := new(purgedVideos)
+	err := loadStateFile(purgedStateFile, purged)
+	return purged, err
+}
+
+// addPurged adds the videos and channels to those that were purged.
+func addPurged(videoIds, channelIds map[string]bool) error {
+	purged, err := loadPurged()
+	if err != nil {
+		return err
+	}
+	add := func(ids []string, added map[string]bool) []string {
+		known := map[string]bool{}
+		for _, id := range ids {
+			known[id] = true
+		}
+		for id := range added {
+			if !known[id] {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+		return ids
+	}
+	purged.VideoIds = add(purged.VideoIds, videoIds)
+	purged.ChannelIds = add(purged.ChannelIds, channelIds)
+	return saveStateFile(purgedStateFile, purged)
+}
+
+// dropPurged leaves out the videos that were purged, and those of the
+// channels that were.
+func dropPurged(tweets []*tweet, purged *purgedVideos) []*tweet {
+	if len(purged.VideoIds) == 0 && len(purged.ChannelIds) == 0 {
+		return tweets
+	}
+	var kept []*tweet
+	for _, tw := range tweets {
+		if anyEqualFold(purged.VideoIds, tw.YouTubeId) ||
+			(tw.video != nil && anyEqualFold(purged.ChannelIds, tw.video.ChannelId)) {
+			log.Printf("skipping %q: it was purged\n", tw.YouTubeId)
+			continue
+		}
+		kept = append(kept, tw)
+	}
+	return kept
+}
+
+// purgeCommand removes every trace the bot kept of the given videos,
+// and of the videos of the given channels, from the state directory,
+// the archives and the policy log, optionally also deleting the tweets
+// that were posted about them. The videos and channels are listed in
+// the state directory as purged, for the bot never to post them again.
+func purgeCommand(args []string) error {
+	fs := flag.NewFlagSet("purge", flag.ContinueOnError)
+	videoIds := fs.String("video-id", "", "comma separated ids of the videos to purge")
+	channelIds := fs.String("channel-id", "", "comma separated ids of the channels whose videos to purge")
+	deletePosts := fs.Bool("delete-posts", false, "also delete the tweets posted about the videos")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 || (*videoIds == "" && *channelIds == "") {
+		return fmt.Errorf("usage: purge [-delete-posts] -video-id <ids> | -channel-id <ids>")
+	}
+	if cfg.StateDir == "" {
+		return fmt.Errorf("purging requires a state directory, which lists the purged videos for the bot not to post them again")
+	}
+
+	purged := splitIds(*videoIds)
+	channels := splitIds(*channelIds)
+	if err := addPurged(purged, channels); err != nil {
+		return err
+	}
+	if len(channels) > 0 {
+		if err := addChannelVideos(purged, channels); err != nil {
+			return err
+		}
+	}
+	if len(purged) == 0 {
+		log.Printf("purge: no videos of channels %s are known\n", *channelIds)
+		return nil
+	}
+
+	tweetIds, err := purgedTweetIds(purged)
+	if err != nil {
+		return err
+	}
+	if *deletePosts {
+		for _, id := range tweetIds {
+			n, err := strconv.ParseInt(id, 10, 64)
+			if err != nil {
+				continue
+			}
+			if err := deleteTweet(n); err != nil {
+				return fmt.Errorf("deleting tweet %s: %v", id, err)
+			}
+			log.Printf("purge: deleted tweet %s\n", id)
+		}
+	} else if len(tweetIds) > 0 {
+		log.Printf("purge: left %d tweets posted, use -delete-posts to delete them\n", len(tweetIds))
+	}
+
+	if err := store.Forget(purged); err != nil {
+		return err
+	}
+	if err := purgeStateFiles(purged); err != nil {
+		return err
+	}
+	if cfg.ArchiveDir != "" {
+		if err := purgeArchive(cfg.ArchiveDir, purged); err != nil {
+			return err
+		}
+	}
+	if cfg.SnapshotDir != "" {
+		if err := purgeTrendingSnapshots(cfg.SnapshotDir, purged); err != nil {
+			return err
+		}
+	}
+	if cfg.PolicyLog != "" {
+		if err := purgePolicyLog(cfg.PolicyLog, purged); err != nil {
+			return err
+		}
+	}
+	if cfg.HistoryDB != "" {
+		if err := forgetHistory(purged); err != nil {
+			return err
+		}
+	}
+	log.Printf("purge: purged %d videos\n", len(purged))
+	return nil
+}
+
+func splitIds(s string) map[string]bool {
+	ids := map[string]bool{}
+	for _, id := range strings.Split(s, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+// addChannelVideos adds the videos of the channels that
+// the snapshot, the snapshot archive, the archive or the digests know of.
+func addChannelVideos(videoIds, channelIds map[string]bool) error {
+	snapshot, err := store.LoadSnapshot()
+	if err != nil {
+		return err
+	}
+	for _, video := range snapshot {
+		if channelIds[video.ChannelId] {
+			videoIds[video.Id] = true
+		}
+	}
+	if cfg.SnapshotDir != "" {
+		err := forEachTrendingSnapshot(cfg.SnapshotDir, func(_ string, ts *trendingSnapshot) error {
+			for _, sv := range ts.Videos {
+				if channelIds[sv.ChannelId] {
+					videoIds[sv.VideoId] = true
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.ArchiveDir == "" {
+		return nil
+	}
+
+	paths, err := filepath.Glob(videoArchivePath(cfg.ArchiveDir, "*"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		av, err := loadArchivedVideo(cfg.ArchiveDir, strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			return err
+		}
+		if av.Video != nil && channelIds[av.Video.ChannelId] {
+			videoIds[av.Id] = true
+		}
+	}
+
+	return forEachDigest(cfg.ArchiveDir, func(dr *digestRecord) error {
+		for _, dv := range dr.Videos {
+			if channelIds[dv.ChannelId] {
+				videoIds[dv.VideoId] = true
+			}
+		}
+		return nil
+	})
+}
+
+// purgedTweetIds returns the ids of the tweets posted about the videos.
+func purgedTweetIds(videoIds map[string]bool) ([]string, error) {
+	seen := map[string]bool{}
+	var tweetIds []string
+	add := func(id string) {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			tweetIds = append(tweetIds, id)
+		}
+	}
+
+	var records []*postedVideo
+	if err := loadStateFile(engagementStateFile, &records); err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		if videoIds[rec.VideoId] {
+			add(rec.TweetId)
+		}
+	}
+	if cfg.HistoryDB != "" {
+		ids, err := historyTweetIds(videoIds)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			add(id)
+		}
+	}
+	if cfg.ArchiveDir == "" {
+		return tweetIds, nil
+	}
+	err := forEachDigest(cfg.ArchiveDir, func(dr *digestRecord) error {
+		for _, dv := range dr.Videos {
+			if videoIds[dv.VideoId] {
+				add(dv.TweetId)
+			}
+		}
+		return nil
+	})
+	return tweetIds, err
+}
+
+// purgeStateFiles removes the videos from the state files
+// of the features, those of the store having been purged.
+func purgeStateFiles(videoIds map[string]bool) error {
+	engagementMu.Lock()
+	defer engagementMu.Unlock()
+
+	var records []*postedVideo
+	if err := loadStateFile(engagementStateFile, &records); err != nil {
+		return err
+	}
+	kept := records[:0]
+	for _, rec := range records {
+		if !videoIds[rec.VideoId] {
+			kept = append(kept, rec)
+		}
+	}
+	if len(kept) != len(records) {
+		if err := saveStateFile(engagementStateFile, kept); err != nil {
+			return err
+		}
+	}
+
+	var seed seedState
+	if err := loadStateFile(seedStateFile, &seed); err != nil {
+		return err
+	}
+	var keptIds []string
+	for _, id := range seed.VideoIds {
+		if !videoIds[id] {
+			keptIds = append(keptIds, id)
+		}
+	}
+	if len(keptIds) != len(seed.VideoIds) {
+		seed.VideoIds = keptIds
+		return saveStateFile(seedStateFile, &seed)
+	}
+	return nil
+}
+
+// purgeArchive removes the videos' metadata and thumbnails, and
+// drops them from the digests, whose collages are removed for
+// the site to redraw them without the videos when next served.
+func purgeArchive(dir string, videoIds map[string]bool) error {
+	for id := range videoIds {
+		if err := os.Remove(videoArchivePath(dir, id)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		thumbnails, err := filepath.Glob(filepath.Join(dir, "thumbnails", "*", id+".jpg"))
+		if err != nil {
+			return err
+		}
+		for _, path := range thumbnails {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+
+	return forEachDigest(dir, func(dr *digestRecord) error {
+		var kept []*digestVideo
+		for _, dv := range dr.Videos {
+			if !videoIds[dv.VideoId] {
+				kept = append(kept, dv)
+			}
+		}
+		if len(kept) == len(dr.Videos) {
+			return nil
+		}
+		dr.Videos = kept
+		if err := saveDigestRecord(dir, dr); err != nil {
+			return err
+		}
+		if err := os.Remove(collagePath(dir, dr.Cycle)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+func forEachDigest(dir string, fn func(dr *digestRecord) error) error {
+	paths, err := filepath.Glob(digestArchivePath(dir, "*"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		dr, err := loadDigestRecord(dir, strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			return err
+		}
+		if err := fn(dr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgePolicyLog rewrites the policy log without the videos' decisions.
+func purgePolicyLog(path string, videoIds map[string]bool) error {
+	policyLogMu.Lock()
+	defer policyLogMu.Unlock()
+
+	blob, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var kept bytes.Buffer
+	purged := false
+	scanner := bufio.NewScanner(bytes.NewReader(blob))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var decision policyDecision
+		if err := json.Unmarshal(scanner.Bytes(), &decision); err == nil && videoIds[decision.VideoId] {
+			purged = true
+			continue
+		}
+		kept.Write(scanner.Bytes())
+		kept.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if !purged {
+		return nil
+	}
+	return writeFileAtomic(path, kept.Bytes(), 0644)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// States of a queued post.
+const (
+	postQueued  = "queued"
+	postEdited  = "edited"
+	postDropped = "dropped"
+	postSending = "sending"
+	postPosted  = "posted"
+	postFailed  = "failed"
+)
+
+// queuedPost is the operator's view of a post
+// that is part of the cycle currently being posted.
+type queuedPost struct {
+	Rank        uint64 `json:"rank"`
+	VideoId     string `json:"video_id"`
+	Title       string `json:"title"`
+	ViewCount   uint64 `json:"view_count"`
+	ViewsHidden bool   `json:"views_hidden,omitempty"`
+	State       string `json:"state"`
+
+	// Batch, counting from 1, is the batch that the post goes out
+	// in, and Due when, if the digest is split into batches.
+	Batch int       `json:"batch,omitempty"`
+	Due   time.Time `json:"due,omitempty"`
+}
+
+// postQueue holds the posts of the current cycle so that the operator
+// can edit or drop them before the posting loop gets to them. Edits are
+// only applied to a tweet when the posting loop claims it, so the tweets
+// themselves are never touched from outside the posting loop.
+type postQueue struct {
+	mu    sync.Mutex
+	cycle string
+	posts []*queuedPost
+	byId  map[string]*queuedPost
+}
+
+var queue = new(postQueue)
+
+// save stores the queue so that it outlives restarts.
+func (q *postQueue) save() {
+	cycle, posts := q.list()
+	if err := store.SaveQueue(cycle, posts); err != nil {
+		log.Printf("saving the queue: %v\n", err)
+	}
+}
+
+// restore reloads the queue last saved, for the operator to see what
+// became of it. Posts that were being sent are assumed to have failed.
+func (q *postQueue) restore() error {
+	cycle, posts, err := store.LoadQueue()
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.cycle = cycle
+	q.posts = make([]*queuedPost, 0, len(posts))
+	q.byId = make(map[string]*queuedPost, len(posts))
+	for i := range posts {
+		qp := &posts[i]
+		if qp.State == postSending {
+			qp.State = postFailed
+		}
+		q.posts = append(q.posts, qp)
+		q.byId[qp.VideoId] = qp
+	}
+	return nil
+}
+
+func (q *postQueue) reset(cycle string, tweets []*tweet) {
+	defer q.save()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.cycle = cycle
+	q.posts = make([]*queuedPost, 0, len(tweets))
+	q.byId = make(map[string]*queuedPost, len(tweets))
+	for _, tw := range tweets {
+		qp := &queuedPost{
+			Rank:        tw.Rank,
+			VideoId:     tw.YouTubeId,
+			Title:       tw.Title,
+			ViewCount:   tw.ViewCount,
+			ViewsHidden: tw.ViewsHidden,
+			State:       postQueued,
+		}
+		q.posts = append(q.posts, qp)
+		q.byId[qp.VideoId] = qp
+	}
+}
+
+// planBatches records the batch of every tweet, posted last to first,
+// and when it is due.
+func (q *postQueue) planBatches(tweets []*tweet, size int, due []time.Time) {
+	defer q.save()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i := range due {
+		if qp, ok := q.byId[tweets[len(tweets)-1-i].YouTubeId]; ok {
+			qp.Batch, qp.Due = i/size+1, due[i]
+		}
+	}
+}
+
+// list returns the current cycle and a copy of its posts.
+func (q *postQueue) list() (string, []queuedPost) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	posts := make([]queuedPost, 0, len(q.posts))
+	for _, qp := range q.posts {
+		posts = append(posts, *qp)
+	}
+	return q.cycle, posts
+}
+
+func (q *postQueue) editable(videoId string) (*queuedPost, error) {
+	qp, ok := q.byId[videoId]
+	if !ok {
+		return nil, fmt.Errorf("%q is not queued", videoId)
+	}
+	if qp.State != postQueued && qp.State != postEdited {
+		return nil, fmt.Errorf("%q can no longer be changed, it is %s", videoId, qp.State)
+	}
+	return qp, nil
+}
+
+// edit replaces the title that the video's post will be composed with.
+func (q *postQueue) edit(videoId, title string) error {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return fmt.Errorf("the title of %q cannot be empty", videoId)
+	}
+	defer q.save()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	qp, err := q.editable(videoId)
+	if err != nil {
+		return err
+	}
+	qp.Title = title
+	qp.State = postEdited
+	return nil
+}
+
+// drop removes the video's post from the cycle.
+func (q *postQueue) drop(videoId string) error {
+	defer q.save()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	qp, err := q.editable(videoId)
+	if err != nil {
+		return err
+	}
+	qp.State = postDropped
+	return nil
+}
+
+// claim is called by the posting loop right before composing the tweet.
+// It applies the operator's edits to the tweet, stops further changes
+// and reports whether the tweet should still be posted.
+func (q *postQueue) claim(tw *tweet) bool {
+	defer q.save()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	qp, ok := q.byId[tw.YouTubeId]
+	if !ok {
+		return true
+	}
+	switch qp.State {
+	case postDropped:
+		return false
+	case postEdited:
+		tw.Title = qp.Title
+	default:
+		qp.Title = tw.Title
+		qp.ViewCount = tw.ViewCount
+		qp.ViewsHidden = tw.ViewsHidden
+	}
+	qp.State = postSending
+	return true
+}
+
+func (q *postQueue) markDone(videoId string, posted bool) {
+	defer q.save()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if qp, ok := q.byId[videoId]; ok {
+		qp.State = postFailed
+		if posted {
+			qp.State = postPosted
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// quietWindow is a daily window, in minutes since midnight, during
+// which nothing is posted. Windows ending before they start, such as
+// 22:00-07:00, run over midnight.
+type quietWindow struct {
+	start, end int
+}
+
+type quietHours struct {
+	windows []quietWindow
+	loc     *time.Location
+}
+
+// quiet is nil when there are no quiet hours.
+var quiet *quietHours
+
+// parseQuietHours parses windows of the form "HH:MM-HH:MM",
+// which are in timezone or in the local zone if there is none.
+func parseQuietHours(windows []string, timezone string) (*quietHours, error) {
+	if len(windows) == 0 {
+		return nil, nil
+	}
+	q := &quietHours{loc: time.Local}
+	if timezone != "" {
+		var err error
+		if q.loc, err = time.LoadLocation(timezone); err != nil {
+			return nil, err
+		}
+	}
+	for _, window := range windows {
+		bounds := strings.Split(window, "-")
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("quiet hours %q must be of the form HH:MM-HH:MM", window)
+		}
+		var w quietWindow
+		var err error
+		if w.start, err = parseClock(bounds[0]); err != nil {
+			return nil, fmt.Errorf("quiet hours %q: %v", window, err)
+		}
+		if w.end, err = parseClock(bounds[1]); err != nil {
+			return nil, fmt.Errorf("quiet hours %q: %v", window, err)
+		}
+		if w.start == w.end {
+			return nil, fmt.Errorf("quiet hours %q are empty", window)
+		}
+		q.windows = append(q.windows, w)
+	}
+	return q, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// until returns when the quiet hours that t falls in end,
+// or the zero time if t is outside of the quiet hours.
+func (q *quietHours) until(t time.Time) time.Time {
+	t = t.In(q.loc)
+	minute := t.Hour()*60 + t.Minute()
+	y, m, d := t.Date()
+	for _, w := range q.windows {
+		var in bool
+		if w.start < w.end {
+			in = minute >= w.start && minute < w.end
+		} else {
+			in = minute >= w.start || minute < w.end
+		}
+		if !in {
+			continue
+		}
+		end := time.Date(y, m, d, w.end/60, w.end%60, 0, 0, q.loc)
+		if !end.After(t) {
+			end = end.AddDate(0, 0, 1)
+		}
+		return end
+	}
+	return time.Time{}
+}
+
+// waitOutQuietHours blocks, on clk, until the quiet hours, if it
+// is in any, are over, following on to any adjoining window.
+func waitOutQuietHours(clk clock) {
+	if quiet == nil {
+		return
+	}
+	for {
+		end := quiet.until(clk.Now())
+		if end.IsZero() {
+			return
+		}
+		log.Printf("quiet hours until %s, holding off posting\n", end.Format("15:04 MST"))
+		clk.Sleep(end.Sub(clk.Now()))
+	}
+}
+
+// holdOffQuietHours blocks until the quiet hours, if it is in any, are
+// over. postTweetTo calls it before every tweet, the jobs beside the
+// posting loop included, which unlike the loop can't read the quiet
+// hours without the reload lock.
+func holdOffQuietHours() {
+	for {
+		var end time.Time
+		withReloadable(func() error {
+			if quiet != nil {
+				end = quiet.until(time.Now())
+			}
+			return nil
+		})
+		if end.IsZero() {
+			return
+		}
+		log.Printf("quiet hours until %s, holding off posting\n", end.Format("15:04 MST"))
+		time.Sleep(time.Until(end))
+	}
+}
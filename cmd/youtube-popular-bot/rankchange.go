@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/odeke-em/youtube-popular-bot/youtube"
+)
+
+// annotateMovement sets every tweet's movement between its place on
+// the chart just fetched and its place on the previous snapshot, the
+// chart as it was fetched, before videos were left out of the digest.
+// Without a previous snapshot every video would be new, so none is.
+func annotateMovement(tweets []*tweet, previous []*youtube.Video) {
+	if len(previous) == 0 {
+		return
+	}
+	was := make(map[string]int, len(previous))
+	for i, video := range previous {
+		was[video.Id] = i + 1
+	}
+	for i, tw := range tweets {
+		tw.Movement = movement(was[tw.YouTubeId], i+1)
+	}
+}
+
+// movement describes the change from rank was, 0 if unranked, to rank
+// now, as "▲n" or "▼n", "NEW" or nothing for a video that held its rank.
+func movement(was, now int) string {
+	switch {
+	case was == 0:
+		return "NEW"
+	case was > now:
+		return fmt.Sprintf("▲%d", was-now)
+	case was < now:
+		return fmt.Sprintf("▼%d", now-was)
+	}
+	return ""
+}
+
+// dropPreviousEntrants leaves out the videos that were on the previous
+// snapshot, keeping every video if there is none to compare with.
+func dropPreviousEntrants(tweets []*tweet, previous []*youtube.Video) []*tweet {
+	if len(previous) == 0 {
+		return tweets
+	}
+	was := make(map[string]bool, len(previous))
+	for _, video := range previous {
+		was[video.Id] = true
+	}
+	kept := []*tweet{}
+	for _, tw := range tweets {
+		if was[tw.YouTubeId] {
+			log.Printf("skipping %q: on the chart since the last cycle\n", tw.YouTubeId)
+			continue
+		}
+		kept = append(kept, tw)
+	}
+	return kept
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// recapTitleLength is how much of a title recap posts quote,
+// leaving room for the rest of the text and the link.
+const recapTitleLength = 80
+
+// appearance is a video's showing in a digest.
+type appearance struct {
+	at          time.Time
+	views       uint64
+	viewsHidden bool
+}
+
+// recapVideo is a video's showings in a year's digests.
+type recapVideo struct {
+	id   string
+	seen []appearance
+
+	// title is the latest, in case it changed.
+	title   string
+	titleAt time.Time
+}
+
+// gained is how many views the video gained between
+// the first and the last digests that counted them.
+func (rv *recapVideo) gained() uint64 {
+	var first, last *appearance
+	for i := range rv.seen {
+		if a := &rv.seen[i]; !a.viewsHidden {
+			if first == nil {
+				first = a
+			}
+			last = a
+		}
+	}
+	if first == nil || last.views < first.views {
+		return 0
+	}
+	return last.views - first.views
+}
+
+// days is on how many days the video was in a digest.
+func (rv *recapVideo) days(loc *time.Location) int {
+	days := map[string]bool{}
+	for _, a := range rv.seen {
+		days[a.at.In(loc).Format("2006-01-02")] = true
+	}
+	return len(days)
+}
+
+// jump is the most views the video gained between two
+// digests that counted them at most a day apart.
+func (rv *recapVideo) jump() uint64 {
+	var most uint64
+	var prev *appearance
+	for i := range rv.seen {
+		a := &rv.seen[i]
+		if a.viewsHidden {
+			continue
+		}
+		if prev != nil && a.at.Sub(prev.at) <= 24*time.Hour && a.views > prev.views && a.views-prev.views > most {
+			most = a.views - prev.views
+		}
+		prev = a
+	}
+	return most
+}
+
+// yearRecap is what a year's digests add up to.
+type yearRecap struct {
+	Year    int
+	Digests int
+
+	MostGained, LongestOnChart, BiggestJump *recapVideo
+	Gained, Days                            int64
+	Jump                                    uint64
+}
+
+// buildRecap mines the digests archived in dir that were posted
+// in year, as it is in loc, for the year's standout videos.
+func buildRecap(dir string, year int, loc *time.Location) (*yearRecap, error) {
+	r := &yearRecap{Year: year}
+	videos := map[string]*recapVideo{}
+	err := forEachDigest(dir, func(dr *digestRecord) error {
+		if dr.PostedAt.In(loc).Year() != year {
+			return nil
+		}
+		r.Digests++
+		for _, dv := range dr.Videos {
+			rv, ok := videos[dv.VideoId]
+			if !ok {
+				rv = &recapVideo{id: dv.VideoId}
+				videos[dv.VideoId] = rv
+			}
+			rv.seen = append(rv.seen, appearance{at: dr.PostedAt, views: dv.ViewCount, viewsHidden: dv.ViewsHidden})
+			if !dr.PostedAt.Before(rv.titleAt) {
+				rv.title, rv.titleAt = dv.Title, dr.PostedAt
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Going through the videos in order of their ids breaks ties
+	// the same way every time the recap is built.
+	ids := make([]string, 0, len(videos))
+	for id := range videos {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		rv := videos[id]
+		sort.Slice(rv.seen, func(i, j int) bool { return rv.seen[i].at.Before(rv.seen[j].at) })
+		if gained := int64(rv.gained()); gained > r.Gained {
+			r.MostGained, r.Gained = rv, gained
+		}
+		if days := int64(rv.days(loc)); days > r.Days {
+			r.LongestOnChart, r.Days = rv, days
+		}
+		if jump := rv.jump(); jump > r.Jump {
+			r.BiggestJump, r.Jump = rv, jump
+		}
+	}
+	return r, nil
+}
+
+// texts returns the posts of the recap's thread, or none
+// if no digest was posted in the year.
+func (r *yearRecap) texts() []string {
+	if r.Digests == 0 {
+		return nil
+	}
+	texts := []string{fmt.Sprintf("The top YouTube videos of %d, out of the %s digests posted this year:",
+		r.Year, humanize.Comma(int64(r.Digests)))}
+	if rv := r.MostGained; rv != nil {
+		texts = append(texts, fmt.Sprintf("Most views gained in %d: %s, up %s views while on the chart %s",
+			r.Year, truncate(rv.title, recapTitleLength), humanize.Comma(r.Gained), youtubeURL(rv.id)))
+	}
+	if rv := r.LongestOnChart; rv != nil {
+		days := "days"
+		if r.Days == 1 {
+			days = "day"
+		}
+		texts = append(texts, fmt.Sprintf("Longest on the chart in %d: %s, on it %d %s %s",
+			r.Year, truncate(rv.title, recapTitleLength), r.Days, days, youtubeURL(rv.id)))
+	}
+	if rv := r.BiggestJump; rv != nil {
+		texts = append(texts, fmt.Sprintf("Biggest one-day jump in %d: %s, up %s views in a day %s",
+			r.Year, truncate(rv.title, recapTitleLength), humanize.Comma(int64(r.Jump)), youtubeURL(rv.id)))
+	}
+	return texts
+}
+
+// postRecap sends the operator a preview of the year's recap and,
+// once approved, posts it as a thread.
+func postRecap(year int, loc *time.Location, throttle time.Duration) error {
+	r, err := buildRecap(cfg.ArchiveDir, year, loc)
+	if err != nil {
+		return err
+	}
+	texts := r.texts()
+	if len(texts) == 0 {
+		log.Printf("no digests were archived in %d, there is nothing to recap\n", year)
+		return nil
+	}
+
+	code := fmt.Sprintf("recap-%d", year)
+	preview := fmt.Sprintf("Recap %s of %d posts awaits approval. Reply \"approve %s\" or \"reject %s\".\n\n%s",
+		code, len(texts), code, code, strings.Join(texts, "\n\n"))
+	approved, err := awaitDecision("recap", code, preview)
+	if !approved {
+		log.Printf("recap of %d was not approved, skipping it\n", year)
+		return err
+	}
+	return postThread(texts, throttle)
+}
+
+// periodicRecaps posts the recap of the year at the times of the
+// recap schedule. A recap due on the 1st of January is of the year
+// that just ended.
+func periodicRecaps(s *schedule) chan error {
+	throttle, loc := pacing()
+	return runOnSchedule(s, func(at time.Time) error {
+		return postRecap(at.AddDate(0, 0, -1).Year(), loc, throttle)
+	})
+}
+
+// recapCommand prints the recap of a year, by default the current
+// one, without posting it, to preview it ahead of its schedule.
+func recapCommand(args []string) error {
+	fs := flag.NewFlagSet("recap", flag.ContinueOnError)
+	year := fs.Int("year", time.Now().In(scheduleLocation()).Year(), "the year to recap")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if cfg.ArchiveDir == "" {
+		return fmt.Errorf("recaps need an archive directory")
+	}
+	r, err := buildRecap(cfg.ArchiveDir, *year, scheduleLocation())
+	if err != nil {
+		return err
+	}
+	texts := r.texts()
+	if len(texts) == 0 {
+		fmt.Printf("no digests were archived in %d\n", *year)
+		return nil
+	}
+	fmt.Println(strings.Join(texts, "\n\n"))
+	return nil
+}
@@ -0,0 +1,252 @@
+//go:build redis
+// +build redis
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/odeke-em/youtube-popular-bot/youtube"
+)
+
+// Building with -tags redis registers the Redis store.
+func init() {
+	storeBackends[storeRedis] = func(dsn string) (Store, error) {
+		return openRedisStore(dsn)
+	}
+}
+
+// redisKeyPrefix leads the keys of the Redis store, which bots that
+// share the server keep apart by their names.
+const redisKeyPrefix = "youtube-popular-bot:"
+
+// Keys of the Redis store, after the prefix and bot name: the state
+// kept as JSON by name, the posted videos scored by when they were
+// posted in milliseconds, and the costs of the last cycles. The claims
+// are shared by every bot and keyed by bot.
+const (
+	redisStateKey  = "state:"
+	redisPostedKey = "posted"
+	redisCostsKey  = "costs"
+	redisClaimsKey = redisKeyPrefix + "claims"
+)
+
+// redisStore keeps state in Redis, which lets several nodes share
+// it without running a SQL database.
+type redisStore struct {
+	pool   *redis.Pool
+	prefix string
+	mu     sync.Mutex
+}
+
+func openRedisStore(url string) (*redisStore, error) {
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.DialURL(url, redis.DialConnectTimeout(5*time.Second))
+		},
+		MaxIdle:     3,
+		IdleTimeout: 4 * time.Minute,
+	}
+	prefix := redisKeyPrefix
+	if cfg.BotName != "" {
+		prefix += cfg.BotName + ":"
+	}
+	s := &redisStore{pool: pool, prefix: prefix}
+	if _, err := s.do("PING"); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *redisStore) do(command string, args ...interface{}) (interface{}, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+	return conn.Do(command, args...)
+}
+
+// load decodes the named state into v, leaving v untouched if there is none.
+func (s *redisStore) load(name string, v interface{}) error {
+	blob, err := redis.Bytes(s.do("GET", s.prefix+redisStateKey+name))
+	if err == redis.ErrNil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(blob, v)
+}
+
+func (s *redisStore) save(name string, v interface{}) error {
+	blob, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = s.do("SET", s.prefix+redisStateKey+name, blob)
+	return err
+}
+
+func (s *redisStore) LoadSnapshot() ([]*youtube.Video, error) {
+	var videos []*youtube.Video
+	err := s.load(snapshotStateName, &videos)
+	return videos, err
+}
+
+func (s *redisStore) SaveSnapshot(videos []*youtube.Video) error {
+	return s.save(snapshotStateName, videos)
+}
+
+func unixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func (s *redisStore) MarkPosted(videoId string, at time.Time) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	key := s.prefix + redisPostedKey
+	if _, err := conn.Do("ZADD", key, unixMillis(at), videoId); err != nil {
+		return err
+	}
+	_, err := conn.Do("ZREMRANGEBYSCORE", key, "-inf", fmt.Sprintf("(%d", unixMillis(at.Add(-maxPostedAge))))
+	return err
+}
+
+func (s *redisStore) PostedSince(t time.Time) (map[string]time.Time, error) {
+	values, err := redis.Strings(s.do("ZRANGEBYSCORE", s.prefix+redisPostedKey, unixMillis(t), "+inf", "WITHSCORES"))
+	if err != nil {
+		return nil, err
+	}
+	posted := make(map[string]time.Time, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		millis, err := strconv.ParseFloat(values[i+1], 64)
+		if err != nil {
+			return nil, err
+		}
+		posted[values[i]] = time.Unix(0, int64(millis)*int64(time.Millisecond))
+	}
+	return posted, nil
+}
+
+func (s *redisStore) LoadQueue() (string, []queuedPost, error) {
+	var state queueState
+	err := s.load(queueStateName, &state)
+	return state.Cycle, state.Posts, err
+}
+
+func (s *redisStore) SaveQueue(cycle string, posts []queuedPost) error {
+	return s.save(queueStateName, &queueState{Cycle: cycle, Posts: posts})
+}
+
+func (s *redisStore) AppendCost(cost *cycleCost) error {
+	blob, err := json.Marshal(cost)
+	if err != nil {
+		return err
+	}
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	key := s.prefix + redisCostsKey
+	if _, err := conn.Do("RPUSH", key, blob); err != nil {
+		return err
+	}
+	_, err = conn.Do("LTRIM", key, -maxCostHistory, -1)
+	return err
+}
+
+func (s *redisStore) Costs() ([]*cycleCost, error) {
+	blobs, err := redis.ByteSlices(s.do("LRANGE", s.prefix+redisCostsKey, 0, -1))
+	if err != nil {
+		return nil, err
+	}
+	costs := make([]*cycleCost, 0, len(blobs))
+	for _, blob := range blobs {
+		cost := new(cycleCost)
+		if err := json.Unmarshal(blob, cost); err != nil {
+			return nil, err
+		}
+		costs = append(costs, cost)
+	}
+	return costs, nil
+}
+
+func (s *redisStore) LoadLastRun() (*lastRun, error) {
+	var run *lastRun
+	err := s.load(lastRunStateName, &run)
+	return run, err
+}
+
+func (s *redisStore) SaveLastRun(run *lastRun) error {
+	return s.save(lastRunStateName, run)
+}
+
+func (s *redisStore) Forget(videoIds map[string]bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	videos, err := s.LoadSnapshot()
+	if err != nil {
+		return err
+	}
+	if err := s.SaveSnapshot(forgetVideos(videos, videoIds)); err != nil {
+		return err
+	}
+
+	if len(videoIds) > 0 {
+		args := redis.Args{s.prefix + redisPostedKey}
+		for id := range videoIds {
+			args = args.Add(id)
+		}
+		if _, err := s.do("ZREM", args...); err != nil {
+			return err
+		}
+	}
+
+	cycle, posts, err := s.LoadQueue()
+	if err != nil {
+		return err
+	}
+	if err := s.SaveQueue(cycle, forgetQueued(posts, videoIds)); err != nil {
+		return err
+	}
+
+	run, err := s.LoadLastRun()
+	if err != nil || run == nil {
+		return err
+	}
+	return s.SaveLastRun(forgetRun(run, videoIds))
+}
+
+func (s *redisStore) Close() error {
+	return s.pool.Close()
+}
+
+func (s *redisStore) SaveClaims(bot string, claims *botClaims) error {
+	blob, err := json.Marshal(claims)
+	if err != nil {
+		return err
+	}
+	_, err = s.do("HSET", redisClaimsKey, bot, blob)
+	return err
+}
+
+func (s *redisStore) Claims() (map[string]*botClaims, error) {
+	values, err := redis.StringMap(s.do("HGETALL", redisClaimsKey))
+	if err != nil {
+		return nil, err
+	}
+	claims := make(map[string]*botClaims, len(values))
+	for bot, blob := range values {
+		c := new(botClaims)
+		if err := json.Unmarshal([]byte(blob), c); err != nil {
+			return nil, err
+		}
+		claims[bot] = c
+	}
+	return claims, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"github.com/odeke-em/youtube-popular-bot/youtube"
+)
+
+// maxIdsPerRequest is the most video ids that
+// the API accepts in a single videos.list call.
+const maxIdsPerRequest = 50
+
+// videosById fetches the videos with the given ids, batching
+// requests as needed. Videos that no longer exist are omitted.
+func videosById(ids []string) (map[string]*youtube.Video, error) {
+	videos := make(map[string]*youtube.Video, len(ids))
+	for start := 0; start < len(ids); start += maxIdsPerRequest {
+		end := start + maxIdsPerRequest
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		pages, err := youtubeClient.ById(ids[start:end]...)
+		if err != nil {
+			return videos, err
+		}
+		for page := range pages {
+			if page.Err != nil {
+				err = page.Err
+				continue
+			}
+			for _, video := range page.Items {
+				videos[video.Id] = video
+			}
+		}
+		if err != nil {
+			return videos, err
+		}
+	}
+	return videos, nil
+}
+
+// refreshTweets re-fetches the metadata and statistics of the tweets'
+// videos and updates the tweets in place. Videos that are no longer
+// returned by the API keep their previously fetched values.
+func refreshTweets(tweets []*tweet) error {
+	ids := make([]string, 0, len(tweets))
+	for _, tw := range tweets {
+		ids = append(ids, tw.YouTubeId)
+	}
+
+	videos, err := videosById(ids)
+	for _, tw := range tweets {
+		if video, ok := videos[tw.YouTubeId]; ok {
+			tw.setVideo(video)
+		}
+	}
+	return err
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ChimeraCoder/anaconda"
+)
+
+// defaultRegionTop is how many videos region accounts post by default.
+const defaultRegionTop = 10
+
+// regionAccount posts the trending videos of its region to an account
+// of its own, on a schedule of its own, alongside the bot's digests.
+// Accounts share the bot's consumer key and secret.
+type regionAccount struct {
+	Region       string `json:"region"`
+	AccessToken  string `json:"access_token"`
+	AccessSecret string `json:"access_secret"`
+
+	// Schedule is a cron expression of when to post or Every how often,
+	// e.g. "6h".
+	Schedule string `json:"schedule,omitempty"`
+	Every    string `json:"every,omitempty"`
+
+	// Top is how many videos to post, 10 by default, in batches of
+	// BatchSize spread evenly until the next digest if it is set.
+	Top       int `json:"top,omitempty"`
+	BatchSize int `json:"batch_size,omitempty"`
+
+	schedule *schedule
+	every    time.Duration
+	api      *anaconda.TwitterApi
+}
+
+var regionAccounts []*regionAccount
+
+func loadRegionAccounts(path string) ([]*regionAccount, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var accounts []*regionAccount
+	if err := json.Unmarshal(blob, &accounts); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	regions := map[string]bool{}
+	for i, ra := range accounts {
+		if err := ra.parse(); err != nil {
+			return nil, fmt.Errorf("%s: region account #%d: %v", path, i+1, err)
+		}
+		if regions[ra.Region] {
+			return nil, fmt.Errorf("%s: more than one account posts region %q", path, ra.Region)
+		}
+		regions[ra.Region] = true
+	}
+	return accounts, nil
+}
+
+func (ra *regionAccount) parse() error {
+	ra.Region = strings.ToUpper(ra.Region)
+	if _, ok := countryNames[ra.Region]; !ok {
+		return fmt.Errorf("unknown region %q", ra.Region)
+	}
+	if ra.AccessToken == "" || ra.AccessSecret == "" {
+		return fmt.Errorf("%s: the account's access token and secret are required", ra.Region)
+	}
+	if (ra.Schedule == "") == (ra.Every == "") {
+		return fmt.Errorf("%s: either a schedule or every is required", ra.Region)
+	}
+	var err error
+	if ra.Schedule != "" {
+		if ra.schedule, err = parseSchedule(ra.Schedule, cfg.ScheduleTimezone); err != nil {
+			return fmt.Errorf("%s: %v", ra.Region, err)
+		}
+	} else if ra.every, err = time.ParseDuration(ra.Every); err != nil || ra.every < time.Minute {
+		return fmt.Errorf("%s: every must be a duration of at least 1m, got %q", ra.Region, ra.Every)
+	}
+	if ra.Top == 0 {
+		ra.Top = defaultRegionTop
+	}
+	if ra.Top < 1 || ra.Top > maxAPIResultsPerPage {
+		return fmt.Errorf("%s: top must be between 1 and %d, got %d", ra.Region, maxAPIResultsPerPage, ra.Top)
+	}
+	if ra.BatchSize < 0 {
+		return fmt.Errorf("%s: batch size must not be negative, got %d", ra.Region, ra.BatchSize)
+	}
+	return nil
+}
+
+// connect creates the account's client, egressing like the bot's own.
+func (ra *regionAccount) connect() error {
+	ra.api = anaconda.NewTwitterApi(ra.AccessToken, ra.AccessSecret)
+	if cfg.TwitterProxy != "" || cfg.TwitterLocalAddr != "" {
+		client, err := newEgressClient(cfg.TwitterProxy, cfg.TwitterLocalAddr)
+		if err != nil {
+			return err
+		}
+		ra.api.HttpClient = client
+	}
+	return nil
+}
+
+// post posts the tweet to the account, as postTweet does to the bot's.
+func (ra *regionAccount) post(text string, params url.Values) (anaconda.Tweet, error) {
+	return postTweetTo(ra.api, "the account of "+ra.Region, text, params)
+}
+
+// postDigest posts the region's trending videos as a thread, screened
+// like the bot's own digests and composed with their templates. Like
+// them, it waits out the quiet hours, fetching the videos once they are
+// over, and is skipped while cycles are paused.
+func (ra *regionAccount) postDigest(since time.Time, period, throttle time.Duration) error {
+	holdOffQuietHours()
+	if paused() {
+		log.Printf("cycles are paused, skipping the digest of %s\n", ra.Region)
+		return nil
+	}
+	tweets, err := fetchRegionTop(ra.Region, ra.Top)
+	if err != nil {
+		return err
+	}
+	var texts []string
+	err = withReloadable(func() error {
+		var errs []error
+		tweets, errs = screenCandidates(tweets)
+		for _, err := range errs {
+			log.Printf("region %s: %v\n", ra.Region, err)
+		}
+		if len(tweets) == 0 {
+			return nil
+		}
+		intro, err := composeIntro(&introData{Count: len(tweets), Period: period, Since: since})
+		if err != nil {
+			return err
+		}
+		texts = []string{intro}
+		for i, tw := range tweets {
+			tw.Rank = uint64(i + 1)
+			text, err := composeTweet(tw)
+			if err != nil {
+				return fmt.Errorf("composing %q: %v", tw.YouTubeId, err)
+			}
+			texts = append(texts, text)
+		}
+		return nil
+	})
+	if err != nil || len(texts) == 0 {
+		return err
+	}
+
+	// The intro leads the first batch.
+	var batchDue []time.Time
+	if ra.BatchSize > 0 && len(tweets) > ra.BatchSize {
+		batchDue = batchDueTimes(len(tweets), ra.BatchSize, time.Now(), period)
+	}
+	return postThreadWith(ra.post, texts, nil, func(i int) {
+		if i > 1 && batchDue != nil && (i-1)%ra.BatchSize == 0 {
+			time.Sleep(time.Until(batchDue[i-1]))
+		} else {
+			time.Sleep(throttle)
+		}
+	})
+}
+
+// periodicRegionDigests posts the account's digests at the times of
+// its schedule, or every so often. Failures only affect the account.
+func periodicRegionDigests(ra *regionAccount) chan error {
+	var ticks <-chan time.Time
+	period := ra.every
+	if ra.schedule != nil {
+		ticks = ra.schedule.ticks()
+	} else {
+		ticks = time.Tick(ra.every)
+	}
+	throttle, _ := pacing()
+	last := time.Now()
+	return runOnTicks(ticks, func(at time.Time) error {
+		if ra.schedule != nil {
+			period = at.Sub(last).Round(time.Minute)
+		}
+		since := last
+		last = at
+		return ra.postDigest(since, period, throttle)
+	})
+}
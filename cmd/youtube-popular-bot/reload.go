@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// reloadRequests is signalled on SIGHUP or POST /reload and drained
+// by the posting loop, which applies the reload between cycles so that
+// a cycle never runs with a mix of old and new settings.
+var reloadRequests = make(chan bool, 1)
+
+// reloadableSettings are the fields of the configuration that the
+// posting loop reads afresh every cycle, which reloads can change.
+var reloadableSettings = []string{
+	"Period", "Throttle", "Schedule", "ScheduleTimezone", "Jitter", "QuietHours",
+	"MaxPages", "MaxResultsPerPage", "MaxPosts", "RegionCode", "CategoryShards", "DedupTTL",
+	"RichRanks", "TemplatesFile", "Locale", "PolicyFile", "ShadowPolicyFile",
+	"SafeModeCategories", "SafeModeChannels", "AllowedChannels", "BlockedChannels",
+	"BlockedKeywords", "BlockedPatterns",
+}
+
+// reloadMu guards the reloadable settings, the templates and the content
+// policies against reloads for the jobs and handlers running beside the
+// posting loop, which read them under its read lock. The loop applies
+// reloads itself, so it reads them freely.
+var reloadMu sync.RWMutex
+
+// withReloadable calls fn, which reads the reloadable settings, the
+// templates or the content policies, holding them still.
+func withReloadable(fn func() error) error {
+	reloadMu.RLock()
+	defer reloadMu.RUnlock()
+	return fn()
+}
+
+// pacing returns the throttle and the zone of the schedules for a job
+// running beside the posting loop, which keeps them from when it
+// starts: reloads of the configuration apply to the posting loop only.
+func pacing() (throttle time.Duration, loc *time.Location) {
+	reloadMu.RLock()
+	defer reloadMu.RUnlock()
+	return cfg.Throttle, scheduleLocation()
+}
+
+func notifyReloads() {
+	hups := make(chan os.Signal, 1)
+	signal.Notify(hups, syscall.SIGHUP)
+	go func() {
+		for range hups {
+			requestReload()
+		}
+	}()
+}
+
+func requestReload() {
+	select {
+	case reloadRequests <- true:
+	default:
+		// A reload is already pending.
+	}
+}
+
+// reloadConfig loads the configuration again, from the config file and
+// the environment, and if it is valid applies the settings that shape
+// cycles: their timing, what is fetched and posted, the templates and
+// the content policies, then records what changed. Credentials,
+// directories, the store and the long running jobs keep their settings
+// until the bot restarts, and the store keeps its state.
+func reloadConfig() error {
+	var fileValues map[string]string
+	if *configFile != "" {
+		var err error
+		if fileValues, err = parseConfigFile(*configFile); err != nil {
+			return err
+		}
+	}
+
+	next := cfg
+	problems := loadConfig(&next, envPrefix(), fileValues)
+	applyFlags(&next)
+	problems = append(problems, next.validate()...)
+	if len(problems) > 0 {
+		return fmt.Errorf("keeping the current configuration:\n%s", strings.Join(problems, "\n"))
+	}
+
+	nextTemplates := defaultTemplates
+	if next.TemplatesFile != "" {
+		var err error
+		if nextTemplates, err = loadTemplates(next.TemplatesFile); err != nil {
+			return err
+		}
+	}
+	var nextPolicy, nextShadowPolicy *contentPolicy
+	if next.PolicyFile != "" {
+		var err error
+		if nextPolicy, err = loadPolicy(next.PolicyFile); err != nil {
+			return err
+		}
+	}
+	if next.ShadowPolicyFile != "" {
+		var err error
+		if nextShadowPolicy, err = loadPolicy(next.ShadowPolicyFile); err != nil {
+			return err
+		}
+	}
+	nextQuiet, err := parseQuietHours(next.QuietHours, next.ScheduleTimezone)
+	if err != nil {
+		return err
+	}
+
+	changes := diffSettings(&cfg, &next, reloadableSettings)
+	old := cfg
+	reloadMu.Lock()
+	v, nextV := reflect.ValueOf(&cfg).Elem(), reflect.ValueOf(&next).Elem()
+	for _, name := range reloadableSettings {
+		v.FieldByName(name).Set(nextV.FieldByName(name))
+	}
+	cfg.schedule = next.schedule
+	cfg.blockedPatterns = next.blockedPatterns
+	templates = nextTemplates
+	policy, shadowPolicy = nextPolicy, nextShadowPolicy
+	quiet = nextQuiet
+	reloadMu.Unlock()
+
+	log.Printf("reloaded the configuration\n")
+	return recordConfigChanges(&old, changes)
+}
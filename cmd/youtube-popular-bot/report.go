@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// accountReport is a snapshot of how the bot's account performed
+// over the period that ended at Time.
+type accountReport struct {
+	Time      time.Time `json:"time"`
+	Followers int       `json:"followers"`
+	Tweets    int       `json:"tweets"`
+	Retweets  int       `json:"retweets"`
+	Favorites int       `json:"favorites"`
+}
+
+func reportsPath() string {
+	return filepath.Join(cfg.StateDir, "reports.json")
+}
+
+func loadReports() ([]*accountReport, error) {
+	if cfg.StateDir == "" {
+		return nil, nil
+	}
+	blob, err := ioutil.ReadFile(reportsPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var reports []*accountReport
+	err = json.Unmarshal(blob, &reports)
+	return reports, err
+}
+
+func saveReports(reports []*accountReport) error {
+	if cfg.StateDir == "" {
+		return nil
+	}
+	blob, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cfg.StateDir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(reportsPath(), blob, 0600)
+}
+
+// measureAccount tallies follower count and the engagement on the
+// tweets posted by the account since the given time. Twitter does not
+// expose impressions publicly so retweets and favorites stand in for reach.
+func measureAccount(since time.Time) (*accountReport, error) {
+	self, err := twitterAPI.GetSelf(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &accountReport{Time: time.Now(), Followers: self.FollowersCount}
+
+	params := url.Values{
+		"user_id":         {self.IdStr},
+		"count":           {"200"},
+		"include_rts":     {"false"},
+		"exclude_replies": {"true"},
+		"trim_user":       {"true"},
+	}
+	timeline, err := twitterAPI.GetUserTimeline(params)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tw := range timeline {
+		createdAt, err := tw.CreatedAtTime()
+		if err != nil || createdAt.Before(since) {
+			continue
+		}
+		report.Tweets += 1
+		report.Retweets += tw.RetweetCount
+		report.Favorites += tw.FavoriteCount
+	}
+
+	return report, nil
+}
+
+func formatReport(cur, prev *accountReport, period time.Duration) string {
+	growth := ""
+	if prev != nil {
+		growth = fmt.Sprintf(" (%+d)", cur.Followers-prev.Followers)
+	}
+	return fmt.Sprintf("Bot performance for the last %s: %s followers%s, %d tweets, %s retweets, %s favorites",
+		period, humanize.Comma(int64(cur.Followers)), growth, cur.Tweets,
+		humanize.Comma(int64(cur.Retweets)), humanize.Comma(int64(cur.Favorites)))
+}
+
+// periodicReports records the account's performance every period
+// and direct messages the report to the operator if one is configured.
+func periodicReports(period time.Duration) chan error {
+	tick := time.Tick(period)
+	errsChan := make(chan error)
+	go func() {
+		defer close(errsChan)
+
+		for {
+			<-tick
+
+			report, err := measureAccount(time.Now().Add(-1 * period))
+			if err != nil {
+				errsChan <- err
+				continue
+			}
+
+			reports, err := loadReports()
+			if err != nil {
+				errsChan <- err
+			}
+			var prev *accountReport
+			if n := len(reports); n > 0 {
+				prev = reports[n-1]
+			}
+			if err := saveReports(append(reports, report)); err != nil {
+				errsChan <- err
+			}
+
+			text := formatReport(report, prev, period)
+			log.Println(text)
+			if cfg.Operator == "" {
+				continue
+			}
+			if _, err := postDMToScreenName(text, cfg.Operator); err != nil {
+				errsChan <- err
+			}
+		}
+	}()
+
+	return errsChan
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"time"
+)
+
+// retry invokes fn up to attempts times, doubling the
+// delay between consecutive attempts, and returns the
+// last error if none of the attempts succeeded.
+func retry(attempts int, delay time.Duration, fn func() error) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			countCost(func(c *cycleCost) { c.Retries++ })
+			time.Sleep(delay)
+			delay *= 2
+		}
+		if err = fn(); err == nil {
+			return nil
+		}
+	}
+	return err
+}
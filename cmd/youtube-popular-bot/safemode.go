@@ -0,0 +1,51 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+// safeModeOn is 1 while safe mode is on. It starts out as
+// configured and the operator can switch it from the dashboard.
+var safeModeOn int32
+
+func safeMode() bool {
+	return atomic.LoadInt32(&safeModeOn) == 1
+}
+
+func setSafeMode(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	if atomic.SwapInt32(&safeModeOn, v) != v {
+		log.Printf("safe mode is now %s\n", onOff(on))
+	}
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// applySafeMode drops, while safe mode is on, videos of the sensitive
+// categories unless they come from one of the authoritative channels.
+func applySafeMode(tweets []*tweet) []*tweet {
+	if !safeMode() {
+		return tweets
+	}
+
+	kept := make([]*tweet, 0, len(tweets))
+	for _, tw := range tweets {
+		if tw.video != nil && anyEqualFold(cfg.SafeModeCategories, tw.video.CategoryId) &&
+			!anyEqualFold(cfg.SafeModeChannels, tw.video.ChannelId) {
+			log.Printf("safe mode: skipping %q of category %q from channel %q\n",
+				tw.YouTubeId, tw.video.CategoryId, tw.video.ChannelId)
+			continue
+		}
+		kept = append(kept, tw)
+	}
+	return kept
+}
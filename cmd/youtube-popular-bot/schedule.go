@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule is a parsed cron expression of five fields: minute, hour,
+// day of the month, month and day of the week, evaluated in loc.
+type schedule struct {
+	minutes, hours, days, months, weekdays map[int]bool
+
+	// anyDay and anyWeekday are set for "*" fields. As in cron, a
+	// day matches if either restricted field of the two matches.
+	anyDay, anyWeekday bool
+
+	loc *time.Location
+}
+
+// parseSchedule parses expr, each field of which is "*", a number, a
+// range "a-b", any of those followed by a step "/n", or a comma
+// separated list of them. Days of the week go from 0 (Sunday) to 7
+// (Sunday again).
+func parseSchedule(expr, timezone string) (*schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q must have 5 fields, got %d", expr, len(fields))
+	}
+	loc := time.Local
+	if timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(timezone); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &schedule{loc: loc}
+	var err error
+	if s.minutes, err = parseScheduleField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("schedule %q minute: %v", expr, err)
+	}
+	if s.hours, err = parseScheduleField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("schedule %q hour: %v", expr, err)
+	}
+	if s.days, err = parseScheduleField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("schedule %q day of the month: %v", expr, err)
+	}
+	if s.months, err = parseScheduleField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("schedule %q month: %v", expr, err)
+	}
+	if s.weekdays, err = parseScheduleField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("schedule %q day of the week: %v", expr, err)
+	}
+	if s.weekdays[7] {
+		s.weekdays[0] = true
+	}
+	s.anyDay = fields[2] == "*"
+	s.anyWeekday = fields[4] == "*"
+
+	// Catch expressions such as "0 0 30 2 *" that never match.
+	if s.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("schedule %q never matches", expr)
+	}
+	return s, nil
+}
+
+func parseScheduleField(field string, min, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			step, part = n, part[:i]
+		}
+
+		lo, hi := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid range %q", part)
+			}
+			if hi, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q", part)
+			}
+			lo, hi = n, n
+			if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("%q is outside of %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+func (s *schedule) matchesDay(t time.Time) bool {
+	day, weekday := s.days[t.Day()], s.weekdays[int(t.Weekday())]
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	}
+	return day || weekday
+}
+
+// next returns the first time after t that the schedule matches, or
+// the zero time if it doesn't match within the next five years.
+func (s *schedule) next(t time.Time) time.Time {
+	t = t.In(s.loc).Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		y, m, d := t.Date()
+		switch {
+		case !s.months[int(m)]:
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, s.loc)
+		case !s.matchesDay(t):
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, s.loc)
+		case !s.hours[t.Hour()]:
+			t = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, s.loc)
+		case !s.minutes[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// ticks sends the times at which the schedule matches, waiting for
+// the next one only once the previous one has been received so that
+// a cycle that overruns skips the times it missed, as time.Tick does.
+func (s *schedule) ticks() <-chan time.Time {
+	c := make(chan time.Time)
+	go func() {
+		for {
+			at := s.next(time.Now())
+			if at.IsZero() {
+				close(c)
+				return
+			}
+			time.Sleep(time.Until(at))
+			c <- at
+		}
+	}()
+	return c
+}
+
+// runOnSchedule calls fn at the times of the schedule, for as long as
+// it has times, sending on the returned channel what fn fails with.
+func runOnSchedule(s *schedule, fn func(at time.Time) error) chan error {
+	return runOnTicks(s.ticks(), fn)
+}
+
+// runOnTicks calls fn with every tick, sending on the
+// returned channel what fn fails with.
+func runOnTicks(ticks <-chan time.Time, fn func(at time.Time) error) chan error {
+	errsChan := make(chan error)
+	go func() {
+		defer close(errsChan)
+
+		for at := range ticks {
+			if err := fn(at); err != nil {
+				errsChan <- err
+			}
+		}
+	}()
+	return errsChan
+}
+
+// cycleTicks returns when cycles run: on the configured
+// schedule, or every period if there is none.
+func cycleTicks(period time.Duration) <-chan time.Time {
+	if cfg.schedule == nil {
+		return time.Tick(period)
+	}
+	return cfg.schedule.ticks()
+}
+
+// scheduleLocation is the zone of the schedules, in which the months
+// and years of leaderboards and recaps are also reckoned.
+func scheduleLocation() *time.Location {
+	if cfg.ScheduleTimezone != "" {
+		if loc, err := time.LoadLocation(cfg.ScheduleTimezone); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// resumedTicks sends first and then a time every period after it, for
+// cycles picking up where those of a restarted bot left off. Like
+// time.Tick, it skips the times missed by a cycle that overruns.
+func resumedTicks(first time.Time, period time.Duration) <-chan time.Time {
+	c := make(chan time.Time)
+	go func() {
+		for at := first; ; at = at.Add(period) {
+			time.Sleep(time.Until(at))
+			c <- at
+			for !at.Add(period).After(time.Now()) {
+				at = at.Add(period)
+			}
+		}
+	}()
+	return c
+}
+
+// nextCycleAt returns when the next cycle is due, the cycles
+// running every period since ticksFrom if there is no schedule.
+func nextCycleAt(ticksFrom time.Time, period time.Duration) time.Time {
+	now := time.Now()
+	if cfg.schedule != nil {
+		return cfg.schedule.next(now)
+	}
+	return ticksFrom.Add((now.Sub(ticksFrom)/period + 1) * period)
+}
+
+// jitterRand is only used by the posting loop's goroutine.
+var jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// jitter returns a random delay of up to the configured jitter for
+// the start of a cycle, so that instances sharing a schedule spread
+// their calls to the APIs rather than all making them at once.
+func jitter() time.Duration {
+	if cfg.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(jitterRand.Int63n(int64(cfg.Jitter)))
+}
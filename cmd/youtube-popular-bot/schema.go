@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/odeke-em/youtube-popular-bot/youtube"
+)
+
+const schemaStateFile = "schema.json"
+
+// schemaState records the version of the layout of the state
+// directory. State directories from before versioning have none
+// and are treated as version 0.
+type schemaState struct {
+	Version    int       `json:"version"`
+	MigratedAt time.Time `json:"migrated_at"`
+}
+
+// migration upgrades the state directory from
+// the version before it to its version.
+type migration struct {
+	version     int
+	description string
+	migrate     func(dir string) error
+}
+
+// migrations are applied in order, every new change to the layout
+// of a state file must append one rather than edit an earlier one.
+var migrations = []migration{
+	{1, "store snapshot videos in the youtube client's layout", migrateSnapshotVideos},
+}
+
+func schemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// migrateState brings the state directory up to the current schema
+// version, keeping a copy of every file a migration rewrites. State
+// written by a newer version of the bot is refused.
+func migrateState() error {
+	if cfg.StateDir == "" {
+		return nil
+	}
+
+	var state schemaState
+	if err := loadStateFile(schemaStateFile, &state); err != nil {
+		return err
+	}
+	if state.Version > schemaVersion() {
+		return fmt.Errorf("state in %q has schema version %d, newer than the supported %d",
+			cfg.StateDir, state.Version, schemaVersion())
+	}
+
+	for _, m := range migrations {
+		if m.version <= state.Version {
+			continue
+		}
+		log.Printf("migrating state to schema version %d: %s", m.version, m.description)
+		if err := m.migrate(cfg.StateDir); err != nil {
+			return fmt.Errorf("migrating state to schema version %d: %v", m.version, err)
+		}
+
+		state.Version = m.version
+		state.MigratedAt = time.Now()
+		if err := saveStateFile(schemaStateFile, &state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteStateFile replaces the named state file with blob, first
+// keeping a copy of the original as "<name>.v<version>".
+func rewriteStateFile(dir, name string, version int, original, blob []byte) error {
+	path := filepath.Join(dir, name)
+	backup := fmt.Sprintf("%s.v%d", path, version)
+	if err := writeFileAtomic(backup, original, 0600); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, blob, 0600)
+}
+
+// migrateSnapshotVideos converts the snapshot from the API's
+// video resources to the client's own video type.
+func migrateSnapshotVideos(dir string) error {
+	original, err := ioutil.ReadFile(filepath.Join(dir, "snapshot.json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var old []json.RawMessage
+	if err := json.Unmarshal(original, &old); err != nil {
+		return err
+	}
+	videos := make([]*youtube.Video, 0, len(old))
+	for _, blob := range old {
+		video, err := youtube.NewVideoFromJSON(blob)
+		if err != nil {
+			return err
+		}
+		videos = append(videos, video)
+	}
+
+	blob, err := json.Marshal(videos)
+	if err != nil {
+		return err
+	}
+	return rewriteStateFile(dir, "snapshot.json", 0, original, blob)
+}
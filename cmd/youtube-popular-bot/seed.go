@@ -0,0 +1,63 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/odeke-em/youtube-popular-bot/youtube"
+)
+
+const seedStateFile = "seed.json"
+
+// seedState records which videos were assumed to have
+// been posted when the bot first ran with state.
+type seedState struct {
+	SeededAt time.Time `json:"seeded_at"`
+	VideoIds []string  `json:"video_ids"`
+}
+
+// seedPosted marks the videos currently on the chart as posted the
+// first time the bot runs with a state directory, since followers of a
+// bot that ran without state have likely just seen them. A state
+// directory that has been seeded, or has posted videos, is left as is.
+func seedPosted() error {
+	if cfg.StateDir == "" || !cfg.SeedPosted {
+		return nil
+	}
+	if _, inMemory := store.(*memoryStore); inMemory {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(cfg.StateDir, seedStateFile)); err == nil {
+		return nil
+	}
+	posted, err := store.PostedSince(time.Time{})
+	if err != nil {
+		return err
+	}
+	state := &seedState{SeededAt: time.Now()}
+	if len(posted) > 0 {
+		return saveStateFile(seedStateFile, state)
+	}
+
+	param := &youtube.SearchParam{
+		MaxPage:           uint64(cfg.MaxPages),
+		MaxResultsPerPage: uint64(cfg.MaxResultsPerPage),
+		RegionCode:        cfg.RegionCode,
+	}
+	tweets, _, errs := fetchTweets(param)
+	if len(tweets) == 0 && len(errs) > 0 {
+		// Try again on the next start rather than seeding nothing.
+		return errs[0]
+	}
+
+	for _, tw := range tweets {
+		if err := store.MarkPosted(tw.YouTubeId, state.SeededAt); err != nil {
+			return err
+		}
+		state.VideoIds = append(state.VideoIds, tw.YouTubeId)
+	}
+	log.Printf("seeded the state with %d videos assumed to have been posted\n", len(state.VideoIds))
+	return saveStateFile(seedStateFile, state)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log"
+	"strings"
+)
+
+// shadowCompare logs how a shadow configuration's selection of tweets
+// differs from the live one: which videos it would have included or
+// excluded and which it would have ranked differently.
+func shadowCompare(name string, live, shadow []*tweet) {
+	livePos := make(map[string]int, len(live))
+	for i, tw := range live {
+		livePos[tw.YouTubeId] = i + 1
+	}
+	shadowPos := make(map[string]int, len(shadow))
+	for i, tw := range shadow {
+		shadowPos[tw.YouTubeId] = i + 1
+	}
+
+	differences := 0
+	for i, tw := range shadow {
+		pos, ok := livePos[tw.YouTubeId]
+		switch {
+		case !ok:
+			log.Printf("shadow %s: would include %q %q at #%d\n", name, tw.YouTubeId, tw.Title, i+1)
+		case pos != i+1:
+			log.Printf("shadow %s: would rank %q %q #%d instead of #%d\n", name, tw.YouTubeId, tw.Title, i+1, pos)
+		default:
+			continue
+		}
+		differences += 1
+	}
+	for i, tw := range live {
+		if _, ok := shadowPos[tw.YouTubeId]; !ok {
+			log.Printf("shadow %s: would exclude %q %q ranked #%d\n", name, tw.YouTubeId, tw.Title, i+1)
+			differences += 1
+		}
+	}
+
+	log.Printf("shadow %s: %d differences from the live selection of %d videos\n", name, differences, len(live))
+}
+
+// shadowApplyPolicy evaluates the shadow policy against the same
+// candidates that the live policy saw and compares the outcomes,
+// logging its decisions without acting on any of them.
+func shadowApplyPolicy(shadow *contentPolicy, candidates, live []*tweet) error {
+	var decisions []*policyDecision
+	var kept []*tweet
+	liveLabels := make(map[string][]string, len(live))
+	liveWarnings := make(map[string]string, len(live))
+	for _, tw := range live {
+		liveLabels[tw.YouTubeId] = tw.Labels
+		liveWarnings[tw.YouTubeId] = tw.ContentWarning
+	}
+
+	for _, tw := range candidates {
+		if tw.video == nil {
+			kept = append(kept, tw)
+			continue
+		}
+		decision := shadow.evaluate(tw.video)
+		decision.Shadow = true
+		decisions = append(decisions, decision)
+		if decision.Action == policyDeny {
+			continue
+		}
+		kept = append(kept, tw)
+
+		if labels, ok := liveLabels[tw.YouTubeId]; ok && strings.Join(labels, ",") != strings.Join(decision.Labels, ",") {
+			log.Printf("shadow policy: would label %q %v instead of %v\n", tw.YouTubeId, decision.Labels, labels)
+		}
+		if warning, ok := liveWarnings[tw.YouTubeId]; ok && warning != strings.Join(decision.Warnings, ", ") {
+			log.Printf("shadow policy: would warn %q %q instead of %q\n", tw.YouTubeId, strings.Join(decision.Warnings, ", "), warning)
+		}
+	}
+
+	shadowCompare("policy", live, kept)
+
+	if cfg.PolicyLog == "" {
+		return nil
+	}
+	return logPolicyDecisions(cfg.PolicyLog, decisions)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// startedAt is when the bot started, for the uptime of shutdown reports.
+var startedAt = time.Now()
+
+// shutdownReport sums up what the bot was doing when it was stopped,
+// so that deploys during a cycle can be audited afterwards.
+type shutdownReport struct {
+	Signal     string         `json:"signal"`
+	Uptime     string         `json:"uptime"`
+	Cycle      string         `json:"cycle,omitempty"`
+	Posted     int            `json:"posted"`
+	Remaining  int            `json:"remaining"`
+	QuotaUnits int64          `json:"quota_units"`
+	LastErrors []*statusError `json:"last_errors"`
+}
+
+func newShutdownReport(sig os.Signal) *shutdownReport {
+	report := &shutdownReport{Signal: sig.String(), Uptime: time.Since(startedAt).Round(time.Second).String()}
+
+	cycle, posts := queue.list()
+	report.Cycle = cycle
+	for _, qp := range posts {
+		switch qp.State {
+		case postPosted:
+			report.Posted++
+		case postQueued, postEdited, postSending:
+			report.Remaining++
+		}
+	}
+
+	costsMu.Lock()
+	report.QuotaUnits = costTotals.QuotaUnits + currentCost.QuotaUnits
+	costsMu.Unlock()
+
+	statusMu.Lock()
+	report.LastErrors = append([]*statusError{}, status.LastErrors...)
+	statusMu.Unlock()
+	return report
+}
+
+func (r *shutdownReport) String() string {
+	text := fmt.Sprintf("Shutting down on %s after %s", r.Signal, r.Uptime)
+	if r.Cycle != "" {
+		text += fmt.Sprintf(", with %d posts made and %d still queued of cycle %s", r.Posted, r.Remaining, r.Cycle)
+	}
+	text += fmt.Sprintf(", %d quota units spent", r.QuotaUnits)
+	if n := len(r.LastErrors); n > 0 {
+		text += fmt.Sprintf(", last error: %s", r.LastErrors[n-1].Error)
+	}
+	return text
+}
+
+// shutdownDMTimeout bounds how long the shutdown report to the
+// operator may hold up exiting, which deploys are waiting on.
+const shutdownDMTimeout = 5 * time.Second
+
+// dmOperatorWithin sends the text to the operator, giving up on
+// waiting for Twitter after timeout.
+func dmOperatorWithin(text string, timeout time.Duration) error {
+	errc := make(chan error, 1)
+	go func() {
+		_, err := postDMToScreenName(text, cfg.Operator)
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("gave up after %s", timeout)
+	}
+}
+
+// closeResources closes the store and the event broker's connection,
+// flushing what they still buffer, before the bot exits.
+func closeResources() {
+	if events != nil {
+		if err := events.Close(); err != nil {
+			log.Printf("closing the event broker: %v\n", err)
+		}
+	}
+	if store != nil {
+		if err := store.Close(); err != nil {
+			log.Printf("closing the store: %v\n", err)
+		}
+	}
+}
+
+// notifyShutdown reports on SIGINT or SIGTERM what the bot leaves
+// behind, to the logs as JSON and to the operator if one is configured,
+// then closes its resources and exits. A post that was being sent is
+// reported as remaining, as restarting the bot restores it as failed.
+func notifyShutdown() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		if err := sdNotify("STOPPING=1"); err != nil {
+			log.Printf("systemd: %v\n", err)
+		}
+		report := newShutdownReport(sig)
+		if blob, err := json.Marshal(report); err == nil {
+			log.Printf("shutdown report: %s\n", blob)
+		}
+		if cfg.Operator != "" {
+			if err := dmOperatorWithin(report.String(), shutdownDMTimeout); err != nil {
+				log.Printf("sending the shutdown report: %v\n", err)
+			}
+		}
+		closeResources()
+		os.Exit(0)
+	}()
+}
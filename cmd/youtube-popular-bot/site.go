@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// digestRecord is what a cycle posted, kept in the archive
+// directory so that its permalink page can be served.
+type digestRecord struct {
+	Cycle    string         `json:"cycle"`
+	PostedAt time.Time      `json:"posted_at"`
+	Since    time.Time      `json:"since"`
+	Period   time.Duration  `json:"period"`
+	Source   string         `json:"source,omitempty"`
+	Region   string         `json:"region,omitempty"`
+	Videos   []*digestVideo `json:"videos"`
+}
+
+type digestVideo struct {
+	Rank         uint64 `json:"rank"`
+	VideoId      string `json:"video_id"`
+	ChannelId    string `json:"channel_id,omitempty"`
+	ChannelTitle string `json:"channel_title,omitempty"`
+	CategoryId   string `json:"category_id,omitempty"`
+	TweetId      string `json:"tweet_id,omitempty"`
+	Title        string `json:"title"`
+	ViewCount    uint64 `json:"view_count"`
+	ViewsHidden  bool   `json:"views_hidden,omitempty"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+func newDigestRecord(cycle string, since time.Time, period time.Duration, source string, tweets []*tweet) *digestRecord {
+	dr := &digestRecord{
+		Cycle:    cycle,
+		PostedAt: time.Now(),
+		Since:    since,
+		Period:   period,
+		Source:   source,
+		Region:   cfg.RegionCode,
+	}
+	for _, tw := range tweets {
+		dv := &digestVideo{
+			Rank:        tw.Rank,
+			VideoId:     tw.YouTubeId,
+			TweetId:     tw.postId,
+			Title:       tw.Title,
+			ViewCount:   tw.ViewCount,
+			ViewsHidden: tw.ViewsHidden,
+			URL:         tw.URL,
+		}
+		if tw.video != nil {
+			dv.ChannelId, dv.ChannelTitle = tw.video.ChannelId, tw.video.ChannelTitle
+			dv.CategoryId = tw.video.CategoryId
+		}
+		if tw.Thumbnail != nil {
+			dv.ThumbnailURL = tw.Thumbnail.URL
+		}
+		dr.Videos = append(dr.Videos, dv)
+	}
+	return dr
+}
+
+func digestArchivePath(dir, cycle string) string {
+	return filepath.Join(dir, "digests", cycle+".json")
+}
+
+func saveDigestRecord(dir string, dr *digestRecord) error {
+	blob, err := json.MarshalIndent(dr, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := digestArchivePath(dir, dr.Cycle)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, blob, 0644)
+}
+
+func loadDigestRecord(dir, cycle string) (*digestRecord, error) {
+	blob, err := ioutil.ReadFile(digestArchivePath(dir, cycle))
+	if err != nil {
+		return nil, err
+	}
+	dr := new(digestRecord)
+	if err := json.Unmarshal(blob, dr); err != nil {
+		return nil, err
+	}
+	return dr, nil
+}
+
+// digestPermalink returns the URL of the cycle's page, or "" if
+// the site's URL isn't known.
+func digestPermalink(cycle string) string {
+	if cfg.SiteURL == "" {
+		return ""
+	}
+	return strings.TrimSuffix(cfg.SiteURL, "/") + "/digests/" + cycle
+}
+
+const digestPageTmplStr = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<meta name="description" content="{{.Summary}}">
+<meta property="og:type" content="article">
+<meta property="og:title" content="{{.Title}}">
+<meta property="og:description" content="{{.Summary}}">
+<meta name="twitter:title" content="{{.Title}}">
+<meta name="twitter:description" content="{{.Summary}}">
+{{if .Permalink}}<meta property="og:url" content="{{.Permalink}}">
+<link rel="canonical" href="{{.Permalink}}">
+<meta property="og:image" content="{{.Permalink}}.jpg">
+<meta property="og:image:width" content="{{.ImageWidth}}">
+<meta property="og:image:height" content="{{.ImageHeight}}">
+<meta name="twitter:card" content="summary_large_image">
+<meta name="twitter:image" content="{{.Permalink}}.jpg">
+{{else}}<meta name="twitter:card" content="summary">
+{{end}}</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{if .Prev}}<a href="/digests/{{.Prev}}">&larr; Previous</a>{{end}} <a href="/days/{{cycleDay .Cycle}}">{{cycleDay .Cycle}}</a> {{if .Next}}<a href="/digests/{{.Next}}">Next &rarr;</a>{{end}}</p>
+<p>For the last {{.Period}} since {{.Since.Format "Jan 2, 2006 15:04 MST"}}{{if .Source}}, via {{.Source}}{{end}}.</p>
+<ol>
+{{range .Videos}}
+<li>{{if .ThumbnailURL}}<img src="{{.ThumbnailURL}}" alt="" width="160"> {{end}}<a href="{{.URL}}">{{.Title}}</a>, {{if .ViewsHidden}}views hidden{{else}}{{commafy .ViewCount}} views{{end}}</li>
+{{end}}
+</ol>
+</body>
+</html>`
+
+var digestPageTemplate = template.Must(template.New("digest").Funcs(template.FuncMap{
+	"commafy":  tmplFuncs["commafy"],
+	"cycleDay": cycleDay,
+}).Parse(digestPageTmplStr))
+
+// digestPage is a digest as rendered on its permalink page. Previews
+// need absolute URLs so the collage is only linked to if the site's
+// URL is known.
+type digestPage struct {
+	*digestRecord
+	Title     string
+	Summary   string
+	Permalink string
+
+	ImageWidth, ImageHeight int
+
+	// Prev and Next are the cycles posted before and after this one.
+	Prev, Next string
+}
+
+// summaryLength is how many characters of titles a page's summary keeps.
+const summaryLength = 40
+
+func newDigestPage(dr *digestRecord) *digestPage {
+	page := &digestPage{
+		digestRecord: dr,
+		Title:        "Most popular YouTube videos of " + dr.PostedAt.Format("Jan 2, 2006"),
+		Permalink:    digestPermalink(dr.Cycle),
+		ImageWidth:   collageWidth,
+		ImageHeight:  collageHeight,
+	}
+
+	var titles []string
+	for i, dv := range dr.Videos {
+		if i == 3 {
+			break
+		}
+		titles = append(titles, fmt.Sprintf("%d. %s", dv.Rank, truncate(dv.Title, summaryLength)))
+	}
+	page.Summary = fmt.Sprintf("The %d most popular videos: %s", len(dr.Videos), strings.Join(titles, " "))
+	return page
+}
+
+// cyclePattern matches the keys that cycleKey produces.
+var cyclePattern = regexp.MustCompile(`^\d{8}T\d{6}Z$`)
+
+func siteMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/digests/", func(w http.ResponseWriter, req *http.Request) {
+		cycle := strings.TrimPrefix(req.URL.Path, "/digests/")
+		collage := strings.HasSuffix(cycle, ".jpg")
+		cycle = strings.TrimSuffix(cycle, ".jpg")
+		if !cyclePattern.MatchString(cycle) {
+			http.NotFound(w, req)
+			return
+		}
+		dr, err := loadDigestRecord(cfg.ArchiveDir, cycle)
+		if os.IsNotExist(err) {
+			http.NotFound(w, req)
+			return
+		}
+		if err != nil {
+			log.Printf("loading digest %q: %v\n", cycle, err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		if collage {
+			blob, err := digestCollage(cfg.ArchiveDir, dr)
+			if err != nil {
+				log.Printf("rendering collage of %q: %v\n", cycle, err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write(blob)
+			return
+		}
+
+		page := newDigestPage(dr)
+		if index, err := loadSiteIndex(cfg.ArchiveDir); err == nil {
+			page.Prev, page.Next = index.neighbours(cycle)
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := digestPageTemplate.Execute(w, page); err != nil {
+			log.Printf("rendering digest %q: %v\n", cycle, err)
+		}
+	})
+	mux.HandleFunc("/", withSiteIndex(serveSiteIndex))
+	mux.HandleFunc("/days/", withSiteIndex(serveSiteDay))
+	mux.HandleFunc("/regions/", withSiteIndex(serveSiteRegion))
+	mux.HandleFunc("/sitemap.xml", withSiteIndex(serveSitemap))
+	mux.HandleFunc("/links", withSiteIndex(serveLinkInBio))
+	return mux
+}
+
+// serveSite publicly serves the digests' permalink pages on addr.
+func serveSite(addr string) error {
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      siteMux(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	log.Printf("serving the site on %s\n", addr)
+	return server.ListenAndServe()
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/xml"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// worldwideRegion names, in the site's paths, digests
+// that weren't restricted to a region.
+const worldwideRegion = "worldwide"
+
+// siteIndex is what the site's navigation is built from,
+// rebuilt whenever the digests in the archive change.
+type siteIndex struct {
+	modTime time.Time
+
+	// cycles are oldest first.
+	cycles   []string
+	byDay    map[string][]string
+	byRegion map[string][]string
+	days     []string
+	regions  []string
+}
+
+var (
+	siteIndexMu sync.Mutex
+	lastIndex   *siteIndex
+)
+
+// loadSiteIndex returns the index of the archived digests.
+func loadSiteIndex(dir string) (*siteIndex, error) {
+	digestsDir := filepath.Join(dir, "digests")
+	info, err := os.Stat(digestsDir)
+	if os.IsNotExist(err) {
+		return &siteIndex{byDay: map[string][]string{}, byRegion: map[string][]string{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	siteIndexMu.Lock()
+	defer siteIndexMu.Unlock()
+	if lastIndex != nil && lastIndex.modTime.Equal(info.ModTime()) {
+		return lastIndex, nil
+	}
+
+	infos, err := ioutil.ReadDir(digestsDir)
+	if err != nil {
+		return nil, err
+	}
+	index := &siteIndex{
+		modTime:  info.ModTime(),
+		byDay:    map[string][]string{},
+		byRegion: map[string][]string{},
+	}
+	for _, fi := range infos {
+		cycle := strings.TrimSuffix(fi.Name(), ".json")
+		if cycle == fi.Name() || !cyclePattern.MatchString(cycle) {
+			continue
+		}
+		dr, err := loadDigestRecord(dir, cycle)
+		if err != nil {
+			log.Printf("indexing digest %q: %v\n", cycle, err)
+			continue
+		}
+
+		index.cycles = append(index.cycles, cycle)
+		day := cycleDay(cycle)
+		if len(index.byDay[day]) == 0 {
+			index.days = append(index.days, day)
+		}
+		index.byDay[day] = append(index.byDay[day], cycle)
+
+		region := digestRegion(dr)
+		if len(index.byRegion[region]) == 0 {
+			index.regions = append(index.regions, region)
+		}
+		index.byRegion[region] = append(index.byRegion[region], cycle)
+	}
+	sort.Strings(index.regions)
+
+	lastIndex = index
+	return index, nil
+}
+
+// neighbours returns the cycles posted before and after cycle, if any.
+func (index *siteIndex) neighbours(cycle string) (prev, next string) {
+	i := sort.SearchStrings(index.cycles, cycle)
+	if i > 0 {
+		prev = index.cycles[i-1]
+	}
+	if i+1 < len(index.cycles) && index.cycles[i] == cycle {
+		next = index.cycles[i+1]
+	}
+	return prev, next
+}
+
+func digestRegion(dr *digestRecord) string {
+	if dr.Region == "" {
+		return worldwideRegion
+	}
+	return dr.Region
+}
+
+// cycleDay returns the UTC day, e.g "2006-01-02", of the cycle's key.
+func cycleDay(cycle string) string {
+	return cycle[0:4] + "-" + cycle[4:6] + "-" + cycle[6:8]
+}
+
+// cycleTime parses the cycle's key back into when the cycle started.
+func cycleTime(cycle string) time.Time {
+	t, _ := time.Parse("20060102T150405Z", cycle)
+	return t
+}
+
+const listPageTmplStr = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{if .Prev}}<a href="{{.Prev}}">&larr; {{.PrevLabel}}</a>{{end}} <a href="/">All days</a> {{if .Next}}<a href="{{.Next}}">{{.NextLabel}} &rarr;</a>{{end}}</p>
+<ul>
+{{range .Links}}<li><a href="{{.URL}}">{{.Label}}</a></li>
+{{end}}</ul>
+{{if .Regions}}<h2>Regions</h2>
+<ul>
+{{range .Regions}}<li><a href="{{.URL}}">{{.Label}}</a></li>
+{{end}}</ul>{{end}}
+</body>
+</html>`
+
+var listPageTemplate = template.Must(template.New("list").Parse(listPageTmplStr))
+
+type siteLink struct {
+	URL   string
+	Label string
+}
+
+type listPage struct {
+	Title string
+	Links []siteLink
+
+	Regions []siteLink
+
+	Prev, PrevLabel string
+	Next, NextLabel string
+}
+
+func renderListPage(w http.ResponseWriter, page *listPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := listPageTemplate.Execute(w, page); err != nil {
+		log.Printf("rendering %q: %v\n", page.Title, err)
+	}
+}
+
+func cycleLinks(cycles []string) []siteLink {
+	links := make([]siteLink, 0, len(cycles))
+	for i := len(cycles) - 1; i >= 0; i-- {
+		links = append(links, siteLink{
+			URL:   "/digests/" + cycles[i],
+			Label: cycleTime(cycles[i]).Format("Jan 2, 2006 15:04 MST"),
+		})
+	}
+	return links
+}
+
+func regionLabel(region string) string {
+	if name, ok := countryNames[region]; ok {
+		return name
+	}
+	return "Worldwide"
+}
+
+// dayPattern matches the days that cycleDay produces.
+var dayPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+func serveSiteIndex(w http.ResponseWriter, req *http.Request, index *siteIndex) {
+	if req.URL.Path != "/" {
+		http.NotFound(w, req)
+		return
+	}
+	page := &listPage{Title: "Most popular YouTube videos, by day"}
+	for i := len(index.days) - 1; i >= 0; i-- {
+		page.Links = append(page.Links, siteLink{URL: "/days/" + index.days[i], Label: index.days[i]})
+	}
+	for _, region := range index.regions {
+		page.Regions = append(page.Regions, siteLink{URL: "/regions/" + region, Label: regionLabel(region)})
+	}
+	renderListPage(w, page)
+}
+
+func serveSiteDay(w http.ResponseWriter, req *http.Request, index *siteIndex) {
+	day := strings.TrimPrefix(req.URL.Path, "/days/")
+	cycles, ok := index.byDay[day]
+	if !dayPattern.MatchString(day) || !ok {
+		http.NotFound(w, req)
+		return
+	}
+
+	page := &listPage{
+		Title: "Most popular YouTube videos of " + day,
+		Links: cycleLinks(cycles),
+	}
+	i := sort.SearchStrings(index.days, day)
+	if i > 0 {
+		page.Prev, page.PrevLabel = "/days/"+index.days[i-1], index.days[i-1]
+	}
+	if i+1 < len(index.days) {
+		page.Next, page.NextLabel = "/days/"+index.days[i+1], index.days[i+1]
+	}
+	renderListPage(w, page)
+}
+
+func serveSiteRegion(w http.ResponseWriter, req *http.Request, index *siteIndex) {
+	region := strings.TrimPrefix(req.URL.Path, "/regions/")
+	cycles, ok := index.byRegion[region]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	renderListPage(w, &listPage{
+		Title: "Most popular YouTube videos in " + regionLabel(region),
+		Links: cycleLinks(cycles),
+	})
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// serveSitemap lists every page of the site, which needs
+// absolute URLs and so is only served if SiteURL is set.
+func serveSitemap(w http.ResponseWriter, req *http.Request, index *siteIndex) {
+	if cfg.SiteURL == "" {
+		http.NotFound(w, req)
+		return
+	}
+	base := strings.TrimSuffix(cfg.SiteURL, "/")
+
+	set := &sitemapURLSet{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	add := func(path, lastMod string) {
+		set.URLs = append(set.URLs, sitemapURL{Loc: base + path, LastMod: lastMod})
+	}
+
+	add("/", "")
+	for _, day := range index.days {
+		add("/days/"+day, day)
+	}
+	for _, region := range index.regions {
+		add("/regions/"+region, "")
+	}
+	for _, cycle := range index.cycles {
+		add("/digests/"+cycle, cycleDay(cycle))
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(set); err != nil {
+		log.Printf("rendering sitemap: %v\n", err)
+	}
+}
+
+// withSiteIndex passes the index of the archive to fn.
+func withSiteIndex(fn func(http.ResponseWriter, *http.Request, *siteIndex)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		index, err := loadSiteIndex(cfg.ArchiveDir)
+		if err != nil {
+			log.Printf("indexing the archive: %v\n", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		fn(w, req, index)
+	}
+}
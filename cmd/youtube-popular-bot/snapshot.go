@@ -0,0 +1,32 @@
+package main
+
+import (
+	"github.com/odeke-em/youtube-popular-bot/youtube"
+)
+
+// saveSnapshot stores the videos of the tweets as
+// the last successfully fetched snapshot.
+func saveSnapshot(tweets []*tweet) error {
+	videos := make([]*youtube.Video, 0, len(tweets))
+	for _, tw := range tweets {
+		if tw.video != nil {
+			videos = append(videos, tw.video)
+		}
+	}
+	return store.SaveSnapshot(videos)
+}
+
+// fetchSnapshot rebuilds tweets from the last successfully
+// fetched snapshot, for when every live source has failed.
+func fetchSnapshot(param *youtube.SearchParam) ([]*tweet, []error) {
+	videos, err := store.LoadSnapshot()
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	tweetList := []*tweet{}
+	for _, video := range videos {
+		tweetList = append(tweetList, newTweet(video))
+	}
+	return tweetList, nil
+}
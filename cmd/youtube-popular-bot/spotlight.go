@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/odeke-em/youtube-popular-bot/youtube"
+)
+
+// spotlightCandidates is of how many of the fastest gaining
+// videos beyond those posted the spotlight picks one.
+const spotlightCandidates = 3
+
+var spotlightRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// chooseSpotlight picks a hidden gem out of the tweets beyond the
+// first posted ones: one of the fastest gaining, at random so that
+// the spotlight varies from cycle to cycle. It returns nil if no
+// video beyond them is known to be gaining views.
+func chooseSpotlight(tweets []*tweet, posted int, previous []*youtube.Video, previousAt, now time.Time) *tweet {
+	var deeper []*tweet
+	for i, tw := range tweets[posted:] {
+		if tw.video != nil {
+			tw.Rank = uint64(posted + i + 1)
+			deeper = append(deeper, tw)
+		}
+	}
+	velocity, known := setVelocities(deeper, previous, previousAt, now)
+
+	var gaining []*tweet
+	for _, tw := range deeper {
+		if known[tw] && velocity[tw] > 0 {
+			gaining = append(gaining, tw)
+		}
+	}
+	if len(gaining) == 0 {
+		return nil
+	}
+	sort.SliceStable(gaining, func(i, j int) bool { return velocity[gaining[i]] > velocity[gaining[j]] })
+	if len(gaining) > spotlightCandidates {
+		gaining = gaining[:spotlightCandidates]
+	}
+	return gaining[spotlightRand.Intn(len(gaining))]
+}
+
+// postSpotlight posts the hidden gem, marking it posted.
+func postSpotlight(tw *tweet) error {
+	buf := new(bytes.Buffer)
+	if err := templates.ExecuteTemplate(buf, "spotlight", tw); err != nil {
+		return err
+	}
+	if _, err := postTweet(buf.String(), nil); err != nil {
+		return err
+	}
+	if cfg.DryRun {
+		return nil
+	}
+	return store.MarkPosted(tw.YouTubeId, time.Now())
+}
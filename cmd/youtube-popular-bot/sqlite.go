@@ -0,0 +1,14 @@
+//go:build sqlite
+// +build sqlite
+
+package main
+
+// Building with -tags sqlite registers the driver of the history
+// database and of the SQLite store.
+import _ "github.com/mattn/go-sqlite3"
+
+func init() {
+	storeBackends[storeSQLite] = func(dsn string) (Store, error) {
+		return openSQLStore("sqlite3", dsn, false)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/odeke-em/youtube-popular-bot/youtube"
+)
+
+// sqlStore keeps state in a SQL database, SQLite on a single node or
+// Postgres to share it between nodes. Posted videos have a table of
+// their own, and the rest of the state is kept as JSON by name. Bots
+// that share the database keep their state apart by their names.
+type sqlStore struct {
+	db  *sql.DB
+	bot string
+
+	// dollarParams is set for databases whose placeholders are
+	// numbered, as $1, rather than question marks.
+	dollarParams bool
+
+	mu sync.Mutex
+}
+
+var sqlStoreSchema = []string{
+	`CREATE TABLE IF NOT EXISTS bot_state (
+		name  TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS posted_videos (
+		bot       TEXT NOT NULL,
+		video_id  TEXT NOT NULL,
+		posted_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (bot, video_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS bot_claims (
+		bot    TEXT PRIMARY KEY,
+		claims TEXT NOT NULL
+	)`,
+}
+
+// Names of the state that the SQL store keeps as JSON.
+const (
+	snapshotStateName = "snapshot"
+	queueStateName    = "queue"
+	costsStateName    = "costs"
+	lastRunStateName  = "last_run"
+)
+
+// openSQLStore opens the database of the driver named by dsn,
+// creating the store's tables on first use.
+func openSQLStore(driver, dsn string, dollarParams bool) (*sqlStore, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	s := &sqlStore{db: db, bot: cfg.BotName, dollarParams: dollarParams}
+	for _, stmt := range sqlStoreSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("creating the store's tables: %v", err)
+		}
+	}
+	return s, nil
+}
+
+// query rewrites the question mark placeholders of query
+// for the database if it numbers its placeholders.
+func (s *sqlStore) query(query string) string {
+	if !s.dollarParams {
+		return query
+	}
+	var b bytes.Buffer
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// stateName is the name that the bot's named state is kept under.
+func (s *sqlStore) stateName(name string) string {
+	if s.bot == "" {
+		return name
+	}
+	return s.bot + "/" + name
+}
+
+// load decodes the named state into v, leaving v untouched if there is none.
+func (s *sqlStore) load(name string, v interface{}) error {
+	var value string
+	err := s.db.QueryRow(s.query(`SELECT value FROM bot_state WHERE name = ?`), s.stateName(name)).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(value), v)
+}
+
+func (s *sqlStore) save(name string, v interface{}) error {
+	blob, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(s.query(`INSERT INTO bot_state (name, value) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET value = excluded.value`), s.stateName(name), string(blob))
+	return err
+}
+
+func (s *sqlStore) LoadSnapshot() ([]*youtube.Video, error) {
+	var videos []*youtube.Video
+	err := s.load(snapshotStateName, &videos)
+	return videos, err
+}
+
+func (s *sqlStore) SaveSnapshot(videos []*youtube.Video) error {
+	return s.save(snapshotStateName, videos)
+}
+
+func (s *sqlStore) MarkPosted(videoId string, at time.Time) error {
+	_, err := s.db.Exec(s.query(`INSERT INTO posted_videos (bot, video_id, posted_at) VALUES (?, ?, ?)
+		ON CONFLICT (bot, video_id) DO UPDATE SET posted_at = excluded.posted_at`), s.bot, videoId, at.UTC())
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(s.query(`DELETE FROM posted_videos WHERE bot = ? AND posted_at < ?`), s.bot, at.Add(-maxPostedAge).UTC())
+	return err
+}
+
+func (s *sqlStore) PostedSince(t time.Time) (map[string]time.Time, error) {
+	rows, err := s.db.Query(s.query(`SELECT video_id, posted_at FROM posted_videos WHERE bot = ? AND posted_at >= ?`), s.bot, t.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posted := make(map[string]time.Time)
+	for rows.Next() {
+		var id string
+		var at time.Time
+		if err := rows.Scan(&id, &at); err != nil {
+			return nil, err
+		}
+		posted[id] = at
+	}
+	return posted, rows.Err()
+}
+
+func (s *sqlStore) LoadQueue() (string, []queuedPost, error) {
+	var state queueState
+	err := s.load(queueStateName, &state)
+	return state.Cycle, state.Posts, err
+}
+
+func (s *sqlStore) SaveQueue(cycle string, posts []queuedPost) error {
+	return s.save(queueStateName, &queueState{Cycle: cycle, Posts: posts})
+}
+
+func (s *sqlStore) AppendCost(cost *cycleCost) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var costs []*cycleCost
+	if err := s.load(costsStateName, &costs); err != nil {
+		return err
+	}
+	return s.save(costsStateName, trimCosts(append(costs, cost)))
+}
+
+func (s *sqlStore) Costs() ([]*cycleCost, error) {
+	var costs []*cycleCost
+	err := s.load(costsStateName, &costs)
+	return costs, err
+}
+
+func (s *sqlStore) LoadLastRun() (*lastRun, error) {
+	var run *lastRun
+	err := s.load(lastRunStateName, &run)
+	return run, err
+}
+
+func (s *sqlStore) SaveLastRun(run *lastRun) error {
+	return s.save(lastRunStateName, run)
+}
+
+func (s *sqlStore) Forget(videoIds map[string]bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	videos, err := s.LoadSnapshot()
+	if err != nil {
+		return err
+	}
+	if err := s.SaveSnapshot(forgetVideos(videos, videoIds)); err != nil {
+		return err
+	}
+
+	for id := range videoIds {
+		if _, err := s.db.Exec(s.query(`DELETE FROM posted_videos WHERE bot = ? AND video_id = ?`), s.bot, id); err != nil {
+			return err
+		}
+	}
+
+	cycle, posts, err := s.LoadQueue()
+	if err != nil {
+		return err
+	}
+	if err := s.SaveQueue(cycle, forgetQueued(posts, videoIds)); err != nil {
+		return err
+	}
+
+	run, err := s.LoadLastRun()
+	if err != nil || run == nil {
+		return err
+	}
+	return s.SaveLastRun(forgetRun(run, videoIds))
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqlStore) SaveClaims(bot string, claims *botClaims) error {
+	blob, err := json.Marshal(claims)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(s.query(`INSERT INTO bot_claims (bot, claims) VALUES (?, ?)
+		ON CONFLICT (bot) DO UPDATE SET claims = excluded.claims`), bot, string(blob))
+	return err
+}
+
+func (s *sqlStore) Claims() (map[string]*botClaims, error) {
+	rows, err := s.db.Query(`SELECT bot, claims FROM bot_claims`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	claims := make(map[string]*botClaims)
+	for rows.Next() {
+		var bot, blob string
+		if err := rows.Scan(&bot, &blob); err != nil {
+			return nil, err
+		}
+		c := new(botClaims)
+		if err := json.Unmarshal([]byte(blob), c); err != nil {
+			return nil, fmt.Errorf("claims of the bot %q: %v", bot, err)
+		}
+		claims[bot] = c
+	}
+	return claims, rows.Err()
+}
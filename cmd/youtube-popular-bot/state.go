@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// loadStateFile decodes the named JSON file from the state directory
+// into v, leaving v untouched if there is no state directory or file.
+func loadStateFile(name string, v interface{}) error {
+	if cfg.StateDir == "" {
+		return nil
+	}
+	blob, err := ioutil.ReadFile(filepath.Join(cfg.StateDir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(blob, v)
+}
+
+// saveStateFile encodes v as the named JSON file in the state
+// directory, doing nothing if there is no state directory.
+func saveStateFile(name string, v interface{}) error {
+	if cfg.StateDir == "" {
+		return nil
+	}
+	blob, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cfg.StateDir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(cfg.StateDir, name), blob, 0600)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// parseSince parses when a report starts from, either as a date,
+// 2006-01-02, or as how long ago, e.g. "7d" or "12h".
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid since %q, expecting a date as 2006-01-02 or how long ago, e.g. 7d or 12h", s)
+}
+
+// statsCommand prints tables of the history database for answering
+// questions about what the bot posted without writing SQL:
+//
+//	stats top [-since 7d] [-n 10]      the most posted videos
+//	stats channel <id> [-since 30d]    the channel's posted videos
+//	stats video <id>                   every post of the video
+func statsCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: stats top|channel <id>|video <id>")
+	}
+	if cfg.HistoryDB == "" {
+		return fmt.Errorf("there are no stats without a history database")
+	}
+
+	fs := flag.NewFlagSet("stats "+args[0], flag.ContinueOnError)
+	since := fs.String("since", "30d", "the date, as 2006-01-02, or how long ago, e.g. 7d, from which to count posts")
+	top := fs.Int("n", 10, "how many videos to list")
+
+	cmd, args := args[0], args[1:]
+	// The id may come before or after the flags.
+	var id string
+	if cmd != "top" && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		id, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if id == "" {
+		id = fs.Arg(0)
+	}
+	from, err := parseSince(*since, time.Now())
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	switch cmd {
+	case "top":
+		err = printTopStats(w, from, *top)
+	case "channel":
+		if id == "" {
+			return fmt.Errorf("usage: stats channel <id>")
+		}
+		err = printChannelStats(w, id, from)
+	case "video":
+		if id == "" {
+			return fmt.Errorf("usage: stats video <id>")
+		}
+		err = printVideoStats(w, id)
+	default:
+		return fmt.Errorf("unknown stats %q, expecting top, channel or video", cmd)
+	}
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// videoStats is how a video fared in the history.
+type videoStats struct {
+	VideoId, ChannelId, Title string
+	Posts                     int
+	BestRank                  uint64
+	PeakViews                 uint64
+	First, Last               time.Time
+}
+
+// historyVideoStats returns how the videos posted since from fared,
+// the most posted first, only those of the channel if it is set.
+func historyVideoStats(from time.Time, channelId string, limit int) ([]*videoStats, error) {
+	db, err := openHistory()
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT video_id, MAX(channel_id), MAX(title), COUNT(*), MIN(rank),
+		MAX(CASE WHEN views_hidden THEN 0 ELSE views END), MIN(posted_at), MAX(posted_at)
+		FROM posted_tweets WHERE posted_at >= ?`
+	params := []interface{}{from.UTC()}
+	if channelId != "" {
+		query += ` AND channel_id = ?`
+		params = append(params, channelId)
+	}
+	query += ` GROUP BY video_id ORDER BY COUNT(*) DESC, MIN(rank), video_id`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		params = append(params, limit)
+	}
+	rows, err := db.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*videoStats
+	for rows.Next() {
+		vs := new(videoStats)
+		var rank, views int64
+		var first, last string
+		if err := rows.Scan(&vs.VideoId, &vs.ChannelId, &vs.Title, &vs.Posts, &rank, &views, &first, &last); err != nil {
+			return nil, err
+		}
+		vs.BestRank, vs.PeakViews = uint64(rank), uint64(views)
+		// Aggregates of timestamps lose their type in SQLite.
+		vs.First, _ = parseHistoryTime(first)
+		vs.Last, _ = parseHistoryTime(last)
+		stats = append(stats, vs)
+	}
+	return stats, rows.Err()
+}
+
+// historyTimeLayouts are those in which the SQLite driver stores times.
+var historyTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	time.RFC3339Nano,
+}
+
+func parseHistoryTime(s string) (time.Time, error) {
+	for _, layout := range historyTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown time %q", s)
+}
+
+func formatStatsTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func printTopStats(w *tabwriter.Writer, from time.Time, limit int) error {
+	stats, err := historyVideoStats(from, "", limit)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "#\tVIDEO\tPOSTS\tBEST\tPEAK VIEWS\tCHANNEL\tTITLE\n")
+	for i, vs := range stats {
+		fmt.Fprintf(w, "%d\t%s\t%d\t#%d\t%s\t%s\t%s\n", i+1, vs.VideoId, vs.Posts, vs.BestRank,
+			humanize.Comma(int64(vs.PeakViews)), vs.ChannelId, truncate(vs.Title, 50))
+	}
+	return nil
+}
+
+func printChannelStats(w *tabwriter.Writer, channelId string, from time.Time) error {
+	stats, err := historyVideoStats(from, channelId, 0)
+	if err != nil {
+		return err
+	}
+	posts := 0
+	for _, vs := range stats {
+		posts += vs.Posts
+	}
+	fmt.Fprintf(w, "%s: %d videos posted %d times since %s\n\n", channelId, len(stats), posts, from.Local().Format("2006-01-02"))
+	fmt.Fprintf(w, "VIDEO\tPOSTS\tBEST\tPEAK VIEWS\tFIRST\tLAST\tTITLE\n")
+	for _, vs := range stats {
+		fmt.Fprintf(w, "%s\t%d\t#%d\t%s\t%s\t%s\t%s\n", vs.VideoId, vs.Posts, vs.BestRank,
+			humanize.Comma(int64(vs.PeakViews)), formatStatsTime(vs.First),
+			formatStatsTime(vs.Last), truncate(vs.Title, 50))
+	}
+	return nil
+}
+
+func printVideoStats(w *tabwriter.Writer, videoId string) error {
+	db, err := openHistory()
+	if err != nil {
+		return err
+	}
+	rows, err := db.Query(`SELECT tweet_id, rank, views, views_hidden, cycle, posted_at, channel_id, title
+		FROM posted_tweets WHERE video_id = ? ORDER BY posted_at`, videoId)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	fmt.Fprintf(w, "POSTED\tCYCLE\tRANK\tVIEWS\tTWEET\n")
+	var channelId, title string
+	posts := 0
+	for rows.Next() {
+		pt := &postedTweet{VideoId: videoId}
+		var rank, views int64
+		if err := rows.Scan(&pt.TweetId, &rank, &views, &pt.ViewsHidden, &pt.Cycle, &pt.PostedAt, &pt.ChannelId, &pt.Title); err != nil {
+			return err
+		}
+		viewsText := "hidden"
+		if !pt.ViewsHidden {
+			viewsText = humanize.Comma(views)
+		}
+		fmt.Fprintf(w, "%s\t%s\t#%d\t%s\thttps://twitter.com/i/web/status/%s\n",
+			formatStatsTime(pt.PostedAt), pt.Cycle, rank, viewsText, pt.TweetId)
+		if pt.ChannelId != "" {
+			channelId = pt.ChannelId
+		}
+		if pt.Title != "" {
+			title = pt.Title
+		}
+		posts++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if posts == 0 {
+		return fmt.Errorf("video %s was never posted", videoId)
+	}
+	fmt.Fprintf(w, "\n%s %q of channel %s, posted %d times\n", videoId, title, channelId, posts)
+	return nil
+}
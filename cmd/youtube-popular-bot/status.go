@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxStatusErrors is how many of the latest errors the status keeps.
+const maxStatusErrors = 10
+
+// botStatus is what GET /status reports of the posting loop.
+type botStatus struct {
+	Paused     bool           `json:"paused"`
+	Running    bool           `json:"running"`
+	LastRun    time.Time      `json:"last_run"`
+	LastRunEnd time.Time      `json:"last_run_end"`
+	NextRun    time.Time      `json:"next_run"`
+	LastErrors []*statusError `json:"last_errors"`
+}
+
+type statusError struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+}
+
+var (
+	statusMu sync.Mutex
+	status   = &botStatus{LastErrors: []*statusError{}}
+)
+
+// triggerRequests asks the posting loop to run a cycle
+// now, rather than waiting for the next one to be due.
+var triggerRequests = make(chan bool, 1)
+
+func triggerCycle() {
+	select {
+	case triggerRequests <- true:
+		log.Printf("a cycle was triggered\n")
+	default:
+		// A cycle is already triggered.
+	}
+}
+
+func paused() bool {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	return status.Paused
+}
+
+// setPaused pauses or resumes the cycles that come due, which while
+// paused are skipped. Triggered cycles run even while paused.
+func setPaused(p bool) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	switch {
+	case p && !status.Paused:
+		log.Printf("cycles are now paused\n")
+	case !p && status.Paused:
+		log.Printf("cycles are now resumed\n")
+	}
+	status.Paused = p
+}
+
+func updateStatus(fn func(s *botStatus)) {
+	statusMu.Lock()
+	fn(status)
+	statusMu.Unlock()
+}
+
+func recordStatusError(err error) {
+	updateStatus(func(s *botStatus) {
+		s.LastErrors = append(s.LastErrors, &statusError{Time: time.Now(), Error: err.Error()})
+		if len(s.LastErrors) > maxStatusErrors {
+			s.LastErrors = s.LastErrors[len(s.LastErrors)-maxStatusErrors:]
+		}
+	})
+}
+
+func serveStatus(w http.ResponseWriter, req *http.Request) {
+	statusMu.Lock()
+	blob, err := json.MarshalIndent(status, "", "  ")
+	statusMu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(blob)
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyControlSignals lets the bot be driven without the admin server:
+// SIGUSR1 runs a cycle now, as POST /trigger does, and SIGUSR2 pauses
+// the cycles, or resumes them if they are paused.
+func notifyControlSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range signals {
+			switch sig {
+			case syscall.SIGUSR1:
+				triggerCycle()
+			case syscall.SIGUSR2:
+				setPaused(!paused())
+			}
+		}
+	}()
+}
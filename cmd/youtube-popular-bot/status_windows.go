@@ -0,0 +1,8 @@
+//go:build windows
+// +build windows
+
+package main
+
+// notifyControlSignals does nothing on Windows, which has no SIGUSR1 or
+// SIGUSR2, where the bot is driven from the admin server alone.
+func notifyControlSignals() {}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/odeke-em/youtube-popular-bot/youtube"
+)
+
+// Store persists the state that the bot's features share: the last
+// snapshot of fetched videos, which videos were posted, the queue of
+// the current cycle, the cost of every cycle and the last run.
+type Store interface {
+	LoadSnapshot() ([]*youtube.Video, error)
+	SaveSnapshot(videos []*youtube.Video) error
+
+	// MarkPosted records that the video was posted at the time, and
+	// PostedSince returns when each video posted since t was posted.
+	MarkPosted(videoId string, at time.Time) error
+	PostedSince(t time.Time) (map[string]time.Time, error)
+
+	LoadQueue() (cycle string, posts []queuedPost, err error)
+	SaveQueue(cycle string, posts []queuedPost) error
+
+	// AppendCost records a cycle's cost, keeping
+	// those of the last maxCostHistory cycles.
+	AppendCost(cost *cycleCost) error
+	Costs() ([]*cycleCost, error)
+
+	// LoadLastRun returns nil if no cycle ran yet.
+	LoadLastRun() (*lastRun, error)
+	SaveLastRun(run *lastRun) error
+
+	// Forget removes the videos from the snapshot, the posted
+	// videos, the queue and the last run, for purging them.
+	Forget(videoIds map[string]bool) error
+
+	// Close releases the store's connections once the bot is done.
+	Close() error
+}
+
+// claimsStore is a Store that several bots can share, which the
+// stores whose database serves several processes at once are.
+type claimsStore interface {
+	Store
+
+	// SaveClaims records the claims of the named bot, and Claims
+	// returns those of every bot that shares the store by name.
+	SaveClaims(bot string, claims *botClaims) error
+	Claims() (map[string]*botClaims, error)
+}
+
+// Kinds of stores.
+const (
+	storeMemory   = "memory"
+	storeFile     = "file"
+	storeSQLite   = "sqlite"
+	storePostgres = "postgres"
+	storeBolt     = "bolt"
+	storeRedis    = "redis"
+)
+
+// storeBuildTags are the build tags of the stores
+// whose databases' drivers are not built by default.
+var storeBuildTags = map[string]string{
+	storeSQLite:   "sqlite",
+	storePostgres: "postgres",
+	storeBolt:     "bolt",
+	storeRedis:    "redis",
+}
+
+// storeBackends open the stores of the kinds that the build
+// includes, given the store's DSN. Builds with their tags
+// register them.
+var storeBackends = map[string]func(dsn string) (Store, error){}
+
+// storeDSN is the DSN of the store, by default a file in the
+// state directory for the stores whose databases are files.
+func storeDSN(kind string) string {
+	if cfg.StoreDSN != "" || cfg.StateDir == "" {
+		return cfg.StoreDSN
+	}
+	switch kind {
+	case storeSQLite:
+		return filepath.Join(cfg.StateDir, "state.sqlite")
+	case storeBolt:
+		return filepath.Join(cfg.StateDir, "state.bolt")
+	}
+	return ""
+}
+
+// maxPostedAge is how long a posted video is remembered for.
+const maxPostedAge = 30 * 24 * time.Hour
+
+var store Store
+
+// lastRun is the last cycle that posted its digest, which a restarted
+// bot resumes after rather than posting the same videos again.
+type lastRun struct {
+	At       time.Time `json:"at"`
+	VideoIds []string  `json:"video_ids"`
+}
+
+// newStore returns the store of the given kind, by default keeping
+// state in files if there is a state directory and in memory if not.
+func newStore(kind string) (Store, error) {
+	if kind == "" {
+		kind = storeMemory
+		if cfg.StateDir != "" {
+			kind = storeFile
+		}
+	}
+	switch kind {
+	case storeMemory:
+		return newMemoryStore(), nil
+	case storeFile:
+		if cfg.StateDir == "" {
+			return nil, fmt.Errorf("the %q store requires a state directory", kind)
+		}
+		return new(fileStore), nil
+	}
+	if tag, ok := storeBuildTags[kind]; ok {
+		open, ok := storeBackends[kind]
+		if !ok {
+			return nil, fmt.Errorf("the %q store needs a build with the %s tag, e.g. go build -tags %s", kind, tag, tag)
+		}
+		dsn := storeDSN(kind)
+		if dsn == "" {
+			return nil, fmt.Errorf("the %q store requires a DSN", kind)
+		}
+		return open(dsn)
+	}
+	return nil, fmt.Errorf("unknown store %q, expecting %q, %q, %q, %q, %q or %q",
+		kind, storeMemory, storeFile, storeSQLite, storePostgres, storeBolt, storeRedis)
+}
+
+// memoryStore keeps state for as long as the process runs,
+// letting every stateful feature work without any setup.
+type memoryStore struct {
+	mu       sync.Mutex
+	snapshot []*youtube.Video
+	posted   map[string]time.Time
+	cycle    string
+	queue    []queuedPost
+	costs    []*cycleCost
+	lastRun  *lastRun
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{posted: map[string]time.Time{}}
+}
+
+func (s *memoryStore) LoadSnapshot() ([]*youtube.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot, nil
+}
+
+func (s *memoryStore) SaveSnapshot(videos []*youtube.Video) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot = videos
+	return nil
+}
+
+func (s *memoryStore) MarkPosted(videoId string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.posted[videoId] = at
+	prunePosted(s.posted, at)
+	return nil
+}
+
+func (s *memoryStore) PostedSince(t time.Time) (map[string]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return postedSince(s.posted, t), nil
+}
+
+func (s *memoryStore) LoadQueue() (string, []queuedPost, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cycle, s.queue, nil
+}
+
+func (s *memoryStore) SaveQueue(cycle string, posts []queuedPost) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cycle, s.queue = cycle, posts
+	return nil
+}
+
+func (s *memoryStore) AppendCost(cost *cycleCost) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.costs = trimCosts(append(s.costs, cost))
+	return nil
+}
+
+func (s *memoryStore) Costs() ([]*cycleCost, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.costs, nil
+}
+
+func (s *memoryStore) LoadLastRun() (*lastRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastRun, nil
+}
+
+func (s *memoryStore) SaveLastRun(run *lastRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRun = run
+	return nil
+}
+
+func (s *memoryStore) Forget(videoIds map[string]bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot = forgetVideos(s.snapshot, videoIds)
+	for id := range videoIds {
+		delete(s.posted, id)
+	}
+	s.queue = forgetQueued(s.queue, videoIds)
+	s.lastRun = forgetRun(s.lastRun, videoIds)
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+// State files of the file store.
+const (
+	snapshotStateFile = "snapshot.json"
+	postedStateFile   = "posted.json"
+	queueStateFile    = "queue.json"
+	lastRunStateFile  = "last_run.json"
+)
+
+// fileStore keeps state as JSON files in the state directory.
+type fileStore struct {
+	mu sync.Mutex
+}
+
+type queueState struct {
+	Cycle string       `json:"cycle"`
+	Posts []queuedPost `json:"posts"`
+}
+
+func (s *fileStore) LoadSnapshot() ([]*youtube.Video, error) {
+	var videos []*youtube.Video
+	err := loadStateFile(snapshotStateFile, &videos)
+	return videos, err
+}
+
+func (s *fileStore) SaveSnapshot(videos []*youtube.Video) error {
+	return saveStateFile(snapshotStateFile, videos)
+}
+
+func (s *fileStore) MarkPosted(videoId string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	posted := map[string]time.Time{}
+	if err := loadStateFile(postedStateFile, &posted); err != nil {
+		return err
+	}
+	posted[videoId] = at
+	prunePosted(posted, at)
+	return saveStateFile(postedStateFile, posted)
+}
+
+func (s *fileStore) PostedSince(t time.Time) (map[string]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	posted := map[string]time.Time{}
+	if err := loadStateFile(postedStateFile, &posted); err != nil {
+		return nil, err
+	}
+	return postedSince(posted, t), nil
+}
+
+func (s *fileStore) LoadQueue() (string, []queuedPost, error) {
+	var state queueState
+	err := loadStateFile(queueStateFile, &state)
+	return state.Cycle, state.Posts, err
+}
+
+func (s *fileStore) SaveQueue(cycle string, posts []queuedPost) error {
+	return saveStateFile(queueStateFile, &queueState{Cycle: cycle, Posts: posts})
+}
+
+func (s *fileStore) AppendCost(cost *cycleCost) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var costs []*cycleCost
+	if err := loadStateFile(costsStateFile, &costs); err != nil {
+		return err
+	}
+	return saveStateFile(costsStateFile, trimCosts(append(costs, cost)))
+}
+
+func (s *fileStore) Costs() ([]*cycleCost, error) {
+	var costs []*cycleCost
+	err := loadStateFile(costsStateFile, &costs)
+	return costs, err
+}
+
+func (s *fileStore) LoadLastRun() (*lastRun, error) {
+	var run *lastRun
+	err := loadStateFile(lastRunStateFile, &run)
+	return run, err
+}
+
+func (s *fileStore) SaveLastRun(run *lastRun) error {
+	return saveStateFile(lastRunStateFile, run)
+}
+
+func (s *fileStore) Forget(videoIds map[string]bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	videos, err := s.LoadSnapshot()
+	if err != nil {
+		return err
+	}
+	if err := s.SaveSnapshot(forgetVideos(videos, videoIds)); err != nil {
+		return err
+	}
+
+	posted := map[string]time.Time{}
+	if err := loadStateFile(postedStateFile, &posted); err != nil {
+		return err
+	}
+	for id := range videoIds {
+		delete(posted, id)
+	}
+	if err := saveStateFile(postedStateFile, posted); err != nil {
+		return err
+	}
+
+	cycle, posts, err := s.LoadQueue()
+	if err != nil {
+		return err
+	}
+	if err := s.SaveQueue(cycle, forgetQueued(posts, videoIds)); err != nil {
+		return err
+	}
+
+	run, err := s.LoadLastRun()
+	if err != nil || run == nil {
+		return err
+	}
+	return s.SaveLastRun(forgetRun(run, videoIds))
+}
+
+func (s *fileStore) Close() error {
+	return nil
+}
+
+func forgetVideos(videos []*youtube.Video, videoIds map[string]bool) []*youtube.Video {
+	var kept []*youtube.Video
+	for _, video := range videos {
+		if !videoIds[video.Id] {
+			kept = append(kept, video)
+		}
+	}
+	return kept
+}
+
+func forgetQueued(posts []queuedPost, videoIds map[string]bool) []queuedPost {
+	var kept []queuedPost
+	for _, qp := range posts {
+		if !videoIds[qp.VideoId] {
+			kept = append(kept, qp)
+		}
+	}
+	return kept
+}
+
+func forgetRun(run *lastRun, videoIds map[string]bool) *lastRun {
+	if run == nil {
+		return nil
+	}
+	kept := &lastRun{At: run.At}
+	for _, id := range run.VideoIds {
+		if !videoIds[id] {
+			kept.VideoIds = append(kept.VideoIds, id)
+		}
+	}
+	return kept
+}
+
+func prunePosted(posted map[string]time.Time, now time.Time) {
+	for id, at := range posted {
+		if now.Sub(at) > maxPostedAge {
+			delete(posted, id)
+		}
+	}
+}
+
+func postedSince(posted map[string]time.Time, t time.Time) map[string]time.Time {
+	since := make(map[string]time.Time)
+	for id, at := range posted {
+		if !at.Before(t) {
+			since[id] = at
+		}
+	}
+	return since
+}
+
+func trimCosts(costs []*cycleCost) []*cycleCost {
+	if len(costs) > maxCostHistory {
+		costs = costs[len(costs)-maxCostHistory:]
+	}
+	return costs
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChimeraCoder/anaconda"
+)
+
+const subscribersStateFile = "subscribers.json"
+
+// maxDMLength is the most characters a direct message may hold.
+const maxDMLength = 10000
+
+type subscriber struct {
+	UserId       int64     `json:"user_id"`
+	ScreenName   string    `json:"screen_name"`
+	SubscribedAt time.Time `json:"subscribed_at"`
+}
+
+var (
+	subscribersMu sync.Mutex
+	subscribers   map[int64]*subscriber
+)
+
+// withSubscribers runs fn with the subscriber list loaded,
+// saving the list afterwards if fn reports that it changed it.
+func withSubscribers(fn func(map[int64]*subscriber) bool) error {
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+
+	if subscribers == nil {
+		subscribers = make(map[int64]*subscriber)
+		if err := loadStateFile(subscribersStateFile, &subscribers); err != nil {
+			return err
+		}
+	}
+	if !fn(subscribers) {
+		return nil
+	}
+	return saveStateFile(subscribersStateFile, subscribers)
+}
+
+func handleSubscribe(mention anaconda.Tweet, args []string) error {
+	err := withSubscribers(func(subs map[int64]*subscriber) bool {
+		if _, ok := subs[mention.User.Id]; ok {
+			return false
+		}
+		subs[mention.User.Id] = &subscriber{
+			UserId:       mention.User.Id,
+			ScreenName:   mention.User.ScreenName,
+			SubscribedAt: time.Now(),
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return replyTo(mention, "You're subscribed, every digest will be sent to you by direct message. Reply \"unsubscribe\" to stop.")
+}
+
+func handleUnsubscribe(mention anaconda.Tweet, args []string) error {
+	err := withSubscribers(func(subs map[int64]*subscriber) bool {
+		if _, ok := subs[mention.User.Id]; !ok {
+			return false
+		}
+		delete(subs, mention.User.Id)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return replyTo(mention, "You're unsubscribed and won't receive digests anymore.")
+}
+
+// digestDM joins the digest's lines into a single
+// direct message, dropping the lines that don't fit.
+func digestDM(lines []string) string {
+	var kept []string
+	length := 0
+	for _, line := range lines {
+		if length+len(line)+1 > maxDMLength {
+			break
+		}
+		kept = append(kept, line)
+		length += len(line) + 1
+	}
+	return strings.Join(kept, "\n")
+}
+
+// sendDigestToSubscribers direct messages the digest to every subscriber,
+// one every interval so as to stay under the direct message rate limit,
+// waiting for the limit to reset whenever it is hit regardless.
+func sendDigestToSubscribers(lines []string, interval time.Duration) []error {
+	var subs []*subscriber
+	err := withSubscribers(func(all map[int64]*subscriber) bool {
+		for _, sub := range all {
+			subs = append(subs, sub)
+		}
+		return false
+	})
+	if err != nil {
+		return []error{err}
+	}
+
+	text := digestDM(lines)
+	if text == "" || len(subs) == 0 {
+		return nil
+	}
+
+	var errs []error
+	for i := 0; i < len(subs); i++ {
+		sub := subs[i]
+		_, err := postDMToUserId(text, sub.UserId)
+		if aerr, ok := err.(*anaconda.ApiError); ok {
+			if limited, nextWindow := aerr.RateLimitCheck(); limited {
+				log.Printf("direct message rate limit hit, resuming at %s\n", nextWindow)
+				time.Sleep(nextWindow.Sub(time.Now()))
+				i--
+				continue
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sending digest to @%s: %v", sub.ScreenName, err))
+		}
+		time.Sleep(interval)
+	}
+	return errs
+}
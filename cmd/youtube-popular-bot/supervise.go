@@ -0,0 +1,100 @@
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// heartbeatInterval is how often the posting loop beats while it
+// waits for the next cycle.
+const heartbeatInterval = time.Minute
+
+var (
+	heartbeatMu  sync.Mutex
+	heartbeatDue time.Time
+)
+
+// heartbeat records that the posting loop is making progress and
+// will beat again within d, beyond which, and cfg.WatchdogStall more
+// for the work in between, it is taken to have stalled.
+func heartbeat(d time.Duration) {
+	heartbeatMu.Lock()
+	heartbeatDue = time.Now().Add(d + cfg.WatchdogStall)
+	heartbeatMu.Unlock()
+}
+
+// stalledSince returns when the posting loop was due to beat
+// last, if it didn't.
+func stalledSince() (time.Time, bool) {
+	heartbeatMu.Lock()
+	defer heartbeatMu.Unlock()
+	return heartbeatDue, !heartbeatDue.IsZero() && time.Now().After(heartbeatDue)
+}
+
+// sdNotify sends the state, e.g. "READY=1", to systemd if it
+// started the bot as a notify service, and does nothing otherwise.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval returns how often systemd expects to be told
+// that the bot is alive, which is zero without a watchdog.
+func watchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// superviseWithSystemd tells systemd that the bot is ready and, if the
+// service has a watchdog, keeps it fed for as long as the posting loop
+// beats, so that systemd restarts a bot whose loop stopped making
+// progress rather than only one that exited.
+func superviseWithSystemd() chan error {
+	errsChan := make(chan error)
+	go func() {
+		defer close(errsChan)
+
+		heartbeat(0)
+		if err := sdNotify("READY=1"); err != nil {
+			errsChan <- err
+		}
+		interval := watchdogInterval()
+		if interval <= 0 {
+			return
+		}
+		stalled := false
+		for range time.Tick(interval / 2) {
+			if since, ok := stalledSince(); ok {
+				if !stalled {
+					log.Printf("the posting loop stalled at %s, no longer feeding the watchdog\n", since.Format(time.RFC3339))
+				}
+				stalled = true
+				continue
+			}
+			stalled = false
+			if err := sdNotify("WATCHDOG=1"); err != nil {
+				errsChan <- err
+			}
+		}
+	}()
+	return errsChan
+}
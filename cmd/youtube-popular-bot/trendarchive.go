@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// trendingSnapshot is a fetched chart, kept with when it was fetched
+// whether or not any of it was posted, so that the snapshots add up
+// to a dataset of what trended over time.
+type trendingSnapshot struct {
+	FetchedAt time.Time        `json:"fetched_at"`
+	Region    string           `json:"region,omitempty"`
+	Source    string           `json:"source"`
+	Videos    []*snapshotVideo `json:"videos"`
+}
+
+type snapshotVideo struct {
+	Rank         uint64 `json:"rank"`
+	VideoId      string `json:"video_id"`
+	Title        string `json:"title"`
+	ChannelId    string `json:"channel_id"`
+	ChannelTitle string `json:"channel_title"`
+	CategoryId   string `json:"category_id"`
+	PublishedAt  string `json:"published_at"`
+	ViewCount    uint64 `json:"view_count"`
+	LikeCount    uint64 `json:"like_count"`
+	CommentCount uint64 `json:"comment_count"`
+	ViewsHidden  bool   `json:"views_hidden,omitempty"`
+	LikesHidden  bool   `json:"likes_hidden,omitempty"`
+}
+
+// trendingSnapshotPath files the snapshots by the day they were fetched.
+func trendingSnapshotPath(dir string, fetchedAt time.Time) string {
+	return filepath.Join(dir, fetchedAt.UTC().Format("2006-01-02"), cycleKey(fetchedAt)+".json")
+}
+
+// archiveTrendingSnapshot saves the fetched tweets' videos, ranked as
+// fetched, as the snapshot of the chart at fetchedAt.
+func archiveTrendingSnapshot(dir, source string, fetchedAt time.Time, tweets []*tweet) error {
+	ts := &trendingSnapshot{FetchedAt: fetchedAt, Region: cfg.RegionCode, Source: source}
+	for i, tw := range tweets {
+		if tw.video == nil {
+			continue
+		}
+		v := tw.video
+		ts.Videos = append(ts.Videos, &snapshotVideo{
+			Rank:         uint64(i + 1),
+			VideoId:      v.Id,
+			Title:        v.Title,
+			ChannelId:    v.ChannelId,
+			ChannelTitle: v.ChannelTitle,
+			CategoryId:   v.CategoryId,
+			PublishedAt:  v.PublishedAt,
+			ViewCount:    v.ViewCount,
+			LikeCount:    v.LikeCount,
+			CommentCount: v.CommentCount,
+			ViewsHidden:  v.ViewsHidden,
+			LikesHidden:  v.LikesHidden,
+		})
+	}
+	return saveTrendingSnapshot(trendingSnapshotPath(dir, fetchedAt), ts)
+}
+
+func saveTrendingSnapshot(path string, ts *trendingSnapshot) error {
+	blob, err := json.MarshalIndent(ts, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, blob, 0644)
+}
+
+// forEachTrendingSnapshot calls fn with every snapshot in dir, oldest first.
+func forEachTrendingSnapshot(dir string, fn func(path string, ts *trendingSnapshot) error) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*", "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		blob, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		ts := new(trendingSnapshot)
+		if err := json.Unmarshal(blob, ts); err != nil {
+			return err
+		}
+		if err := fn(path, ts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeTrendingSnapshots rewrites the snapshots without the videos.
+func purgeTrendingSnapshots(dir string, videoIds map[string]bool) error {
+	return forEachTrendingSnapshot(dir, func(path string, ts *trendingSnapshot) error {
+		var kept []*snapshotVideo
+		for _, sv := range ts.Videos {
+			if !videoIds[sv.VideoId] {
+				kept = append(kept, sv)
+			}
+		}
+		if len(kept) == len(ts.Videos) {
+			return nil
+		}
+		ts.Videos = kept
+		return saveTrendingSnapshot(path, ts)
+	})
+}
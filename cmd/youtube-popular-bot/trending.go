@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ChimeraCoder/anaconda"
+	"github.com/odeke-em/youtube-popular-bot/youtube"
+)
+
+// trendingQuestion matches mentions like "what's trending in Japan?".
+var trendingQuestion = regexp.MustCompile(`(?i)\btrending\s+in\s+([\p{L} .'-]+?)\s*[?!.]*$`)
+
+// regionTopCount is how many videos answers list.
+const regionTopCount = 3
+
+type regionTop struct {
+	tweets    []*tweet
+	fetchedAt time.Time
+}
+
+var (
+	regionTopMu    sync.Mutex
+	regionTopCache = map[string]*regionTop{}
+)
+
+// topForRegion returns the region's most popular videos, caching
+// them for RegionCacheTTL so that popular questions don't each
+// cost API quota.
+func topForRegion(code string) ([]*tweet, error) {
+	regionTopMu.Lock()
+	defer regionTopMu.Unlock()
+
+	if cached, ok := regionTopCache[code]; ok && time.Since(cached.fetchedAt) < cfg.RegionCacheTTL {
+		return cached.tweets, nil
+	}
+
+	tweets, err := fetchRegionTop(code, regionTopCount)
+	if err != nil {
+		return nil, err
+	}
+	regionTopCache[code] = &regionTop{tweets: tweets, fetchedAt: time.Now()}
+	return tweets, nil
+}
+
+// fetchRegionTop fetches the region's n most popular videos from
+// its chart, or by view count if the region has no chart.
+func fetchRegionTop(code string, n int) ([]*tweet, error) {
+	param := &youtube.SearchParam{
+		MaxPage:           1,
+		MaxResultsPerPage: uint64(n),
+		RegionCode:        code,
+	}
+	tweets, _, errs := fallbackFetch(param,
+		fetchStrategy{source: sourceChart, fetch: func(param *youtube.SearchParam) ([]*tweet, []error) {
+			if err := youtubeClient.ProbeMostPopular(param.RegionCode); err != nil {
+				return nil, []error{err}
+			}
+			return fetchChart(param)
+		}},
+		fetchStrategy{source: sourceViewCount, fetch: fetchByViewCount},
+	)
+	if len(tweets) == 0 {
+		if len(errs) > 0 {
+			return nil, errs[0]
+		}
+		return nil, fmt.Errorf("no videos are trending in %q", code)
+	}
+	if len(tweets) > n {
+		tweets = tweets[:n]
+	}
+	return tweets, nil
+}
+
+// truncate shortens s to at most n runes, ending it with an ellipsis if cut.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:n-1])) + "…"
+}
+
+func handleTrendingQuestion(mention anaconda.Tweet, query string) error {
+	code, name, ok := lookupCountry(query)
+	if !ok {
+		return replyTo(mention, fmt.Sprintf("Sorry, I don't know of trending videos in %q.", truncate(query, 40)))
+	}
+
+	tweets, err := topForRegion(code)
+	if err != nil {
+		replyTo(mention, fmt.Sprintf("Sorry, I couldn't get what's trending in %s right now.", name))
+		return err
+	}
+
+	lines := []string{fmt.Sprintf("Trending in %s:", name)}
+	for i, tw := range tweets {
+		lines = append(lines, fmt.Sprintf("%d. %s %s", i+1, truncate(tw.Title, 50), tw.URL))
+	}
+	return replyTo(mention, strings.Join(lines, "\n"))
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/ChimeraCoder/anaconda"
+)
+
+// dryRunIds numbers the posts that dry runs pretend to make.
+var dryRunIds int64
+
+func dryRunId() string {
+	return fmt.Sprintf("dry-run-%d", atomic.AddInt64(&dryRunIds, 1))
+}
+
+// twitterDisabled reports, and logs, whether the operator disabled
+// Twitter as a publisher, in which case nothing is sent to Twitter but
+// the bot carries on as though it had been, for the other publishers.
+func twitterDisabled(what string) bool {
+	if publisherEnabled(twitterPublisher) {
+		return false
+	}
+	log.Printf("twitter is disabled, not sending %s\n", what)
+	return true
+}
+
+// postTweet posts the tweet, or only logs it in dry runs.
+func postTweet(text string, params url.Values) (anaconda.Tweet, error) {
+	return postTweetTo(twitterAPI, "", text, params)
+}
+
+// postTweetTo posts the tweet with api, the client of the bot's account
+// or of the one described by account, e.g. "the account of FR", or only
+// logs it in dry runs. Every tweet the bot posts goes through it, so it
+// holds off during the quiet hours for all of them. Only the bot's own
+// tweets count against its rate limit, but all of them are costs of the
+// cycle.
+func postTweetTo(api *anaconda.TwitterApi, account, text string, params url.Values) (anaconda.Tweet, error) {
+	to := ""
+	if account != "" {
+		to = " to " + account
+	}
+	if twitterDisabled(fmt.Sprintf("tweet %q%s", text, to)) {
+		return anaconda.Tweet{Text: text}, nil
+	}
+	countCost(func(c *cycleCost) { c.Tweets++ })
+	if cfg.DryRun {
+		log.Printf("dry run: would tweet %q %v%s\n", text, params, to)
+		return anaconda.Tweet{IdStr: dryRunId(), Text: text}, nil
+	}
+	holdOffQuietHours()
+	tw, err := api.PostTweet(text, params)
+	if err == nil && api == twitterAPI {
+		tweetWindow.add(time.Now())
+	}
+	return tw, err
+}
+
+// postDMToScreenName sends the direct message, or only logs it in dry runs.
+func postDMToScreenName(text, screenName string) (anaconda.DirectMessage, error) {
+	if twitterDisabled("a direct message to @" + screenName) {
+		return anaconda.DirectMessage{Text: text}, nil
+	}
+	countCost(func(c *cycleCost) { c.DMs++ })
+	if cfg.DryRun {
+		log.Printf("dry run: would direct message @%s %q\n", screenName, text)
+		return anaconda.DirectMessage{IdStr: dryRunId(), Text: text}, nil
+	}
+	return twitterAPI.PostDMToScreenName(text, screenName)
+}
+
+// postDMToUserId sends the direct message, or only logs it in dry runs.
+func postDMToUserId(text string, userId int64) (anaconda.DirectMessage, error) {
+	if twitterDisabled(fmt.Sprintf("a direct message to user %d", userId)) {
+		return anaconda.DirectMessage{Text: text}, nil
+	}
+	countCost(func(c *cycleCost) { c.DMs++ })
+	if cfg.DryRun {
+		log.Printf("dry run: would direct message user %d %q\n", userId, text)
+		return anaconda.DirectMessage{IdStr: dryRunId(), Text: text}, nil
+	}
+	return twitterAPI.PostDMToUserId(text, userId)
+}
+
+// uploadMedia uploads the base64 encoded media, or only logs it in dry runs.
+func uploadMedia(base64String string) (anaconda.Media, error) {
+	if twitterDisabled("media") {
+		return anaconda.Media{}, nil
+	}
+	countCost(func(c *cycleCost) { c.MediaUploads++ })
+	if cfg.DryRun {
+		log.Printf("dry run: would upload %d bytes of media\n", len(base64String)*3/4)
+		return anaconda.Media{MediaIDString: dryRunId()}, nil
+	}
+	return twitterAPI.UploadMedia(base64String)
+}
+
+// deleteTweet deletes the tweet, or only logs it in dry runs.
+func deleteTweet(id int64) error {
+	if cfg.DryRun {
+		log.Printf("dry run: would delete tweet %d\n", id)
+		return nil
+	}
+	_, err := twitterAPI.DeleteTweet(id, true)
+	return err
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/odeke-em/youtube-popular-bot/youtube"
+)
+
+// viewsPerHour is how fast the video gained views: since the previous
+// snapshot, taken at previousAt, if it was on it, or else since it was
+// published. ok is false if neither is known.
+func viewsPerHour(video *youtube.Video, was map[string]*youtube.Video, previousAt, now time.Time) (float64, bool) {
+	if video.ViewsHidden {
+		return 0, false
+	}
+	if prev, ok := was[video.Id]; ok && !prev.ViewsHidden && !previousAt.IsZero() && now.After(previousAt) {
+		if video.ViewCount < prev.ViewCount {
+			return 0, true
+		}
+		return float64(video.ViewCount-prev.ViewCount) / now.Sub(previousAt).Hours(), true
+	}
+	publishedAt, err := time.Parse(time.RFC3339, video.PublishedAt)
+	if err != nil || !now.After(publishedAt) {
+		return 0, false
+	}
+	return float64(video.ViewCount) / now.Sub(publishedAt).Hours(), true
+}
+
+// setVelocities sets how fast every tweet's video gained views,
+// returning the velocities and whether each one is known.
+func setVelocities(tweets []*tweet, previous []*youtube.Video, previousAt, now time.Time) (map[*tweet]float64, map[*tweet]bool) {
+	was := make(map[string]*youtube.Video, len(previous))
+	for _, video := range previous {
+		was[video.Id] = video
+	}
+
+	velocity := make(map[*tweet]float64, len(tweets))
+	known := make(map[*tweet]bool, len(tweets))
+	for _, tw := range tweets {
+		if tw.video == nil {
+			continue
+		}
+		velocity[tw], known[tw] = viewsPerHour(tw.video, was, previousAt, now)
+		tw.ViewsPerHour = uint64(velocity[tw])
+	}
+	return velocity, known
+}
+
+// rankByVelocity sets how fast every video gained views, and orders
+// the tweets by it, fastest first, so that fast risers lead rather
+// than videos that have long been gathering views. Videos whose
+// velocity isn't known, such as those with hidden views, go last.
+func rankByVelocity(tweets []*tweet, previous []*youtube.Video, previousAt, now time.Time) {
+	velocity, known := setVelocities(tweets, previous, previousAt, now)
+	sort.SliceStable(tweets, func(i, j int) bool {
+		a, b := tweets[i], tweets[j]
+		if known[a] != known[b] {
+			return known[a]
+		}
+		return velocity[a] > velocity[b]
+	})
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/odeke-em/youtube-popular-bot/youtube"
+)
+
+// webhookSignatureHeader carries the hex HMAC-SHA256, keyed with the
+// webhook secret, of the request's timestamp, id and body joined by
+// periods, as "sha256=<hex>". The timestamp is in Unix seconds.
+const (
+	webhookSignatureHeader = "X-Signature-256"
+	webhookTimestampHeader = "X-Webhook-Timestamp"
+	webhookIdHeader        = "X-Webhook-Id"
+)
+
+// webhookTolerance is how far from now the timestamps of requests
+// may be, beyond which they are taken for replays.
+const webhookTolerance = 5 * time.Minute
+
+// maxWebhookBody is the largest webhook request body that is read.
+const maxWebhookBody = 64 << 10
+
+// Actions that external systems can ask of the bot.
+const (
+	webhookCycle  = "cycle"
+	webhookRegion = "region"
+	webhookSearch = "search"
+)
+
+// webhookRequest is the JSON body of a webhook: run a cycle now,
+// post a digest of what trends in a region, or of the most viewed
+// videos matching a search, optionally within a region.
+type webhookRequest struct {
+	Action string `json:"action"`
+	Region string `json:"region"`
+	Query  string `json:"query"`
+}
+
+// seenWebhooks are when the requests accepted within the tolerance
+// were, by id, so that none of them is acted on twice.
+var (
+	seenWebhooksMu sync.Mutex
+	seenWebhooks   = map[string]time.Time{}
+)
+
+// webhookSigned reports whether the signature is that
+// of the request's timestamp, id and body.
+func webhookSigned(timestamp, id string, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(cfg.WebhookSecret))
+	mac.Write([]byte(timestamp + "." + id + "."))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// freshWebhook reports whether the request of the id, sent at the Unix
+// timestamp, is within the tolerance and wasn't received before,
+// recording it if so.
+func freshWebhook(timestamp, id string) bool {
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || id == "" {
+		return false
+	}
+	at := time.Unix(secs, 0)
+	if d := time.Since(at); d > webhookTolerance || d < -webhookTolerance {
+		return false
+	}
+
+	seenWebhooksMu.Lock()
+	defer seenWebhooksMu.Unlock()
+	for seen, seenAt := range seenWebhooks {
+		if time.Since(seenAt) > webhookTolerance {
+			delete(seenWebhooks, seen)
+		}
+	}
+	if _, ok := seenWebhooks[id]; ok {
+		return false
+	}
+	// Requests sent ahead of the clock are kept until they are stale.
+	if at.Before(time.Now()) {
+		at = time.Now()
+	}
+	seenWebhooks[id] = at
+	return true
+}
+
+// serveWebhook lets editorial tools and other external systems drive
+// the bot. Digests are posted in the background once the request has
+// been accepted, so callers learn of failures from the bot's log, and
+// are held to the same filters, pauses, quiet hours and approval as
+// those of the posting loop.
+func serveWebhook(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	timestamp, id := req.Header.Get(webhookTimestampHeader), req.Header.Get(webhookIdHeader)
+	if !webhookSigned(timestamp, id, body, req.Header.Get(webhookSignatureHeader)) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !freshWebhook(timestamp, id) {
+		http.Error(w, "the request is stale or was already received", http.StatusConflict)
+		return
+	}
+
+	var hook webhookRequest
+	if err := json.Unmarshal(body, &hook); err != nil {
+		http.Error(w, fmt.Sprintf("parsing the request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var code, name string
+	if hook.Region != "" {
+		var ok bool
+		if code, name, ok = lookupCountry(hook.Region); !ok {
+			http.Error(w, fmt.Sprintf("unknown region %q", hook.Region), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if hook.Action != webhookCycle && paused() {
+		http.Error(w, "cycles are paused", http.StatusConflict)
+		return
+	}
+
+	// Digests awaiting approval are referred to by the request.
+	sum := sha256.Sum256([]byte(id))
+	approvalCode := "hook-" + hex.EncodeToString(sum[:4])
+
+	switch hook.Action {
+	case webhookCycle:
+		triggerCycle()
+	case webhookRegion:
+		if code == "" {
+			http.Error(w, "a region digest needs a region", http.StatusBadRequest)
+			return
+		}
+		throttle, _ := pacing()
+		go func() {
+			if err := postRegionDigest(code, name, cfg.WebhookTop, approvalCode, throttle); err != nil {
+				log.Printf("webhook: digest of %s: %v\n", code, err)
+			}
+		}()
+	case webhookSearch:
+		query := strings.TrimSpace(hook.Query)
+		if query == "" {
+			http.Error(w, "a search digest needs a query", http.StatusBadRequest)
+			return
+		}
+		throttle, _ := pacing()
+		go func() {
+			if err := postSearchDigest(query, code, name, cfg.WebhookTop, approvalCode, throttle); err != nil {
+				log.Printf("webhook: digest of %q: %v\n", query, err)
+			}
+		}()
+	default:
+		http.Error(w, fmt.Sprintf("unknown action %q, expecting %q, %q or %q",
+			hook.Action, webhookCycle, webhookRegion, webhookSearch), http.StatusBadRequest)
+		return
+	}
+	log.Printf("webhook: accepted %s\n", body)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// composeDigestThread returns the tweets of a thread headed by
+// heading that lists the videos in order, one tweet per video.
+func composeDigestThread(heading string, tweets []*tweet) []string {
+	texts := []string{heading}
+	for i, tw := range tweets {
+		texts = append(texts, fmt.Sprintf("#%d %s %s", i+1, truncate(tw.Title, compareTitleLength), tw.URL))
+	}
+	return texts
+}
+
+// screenDigest screens the videos of a webhook's digest as the
+// posting loop screens its own, failing if none are left.
+func screenDigest(tweets []*tweet) ([]*tweet, error) {
+	var errs []error
+	withReloadable(func() error {
+		tweets, errs = screenCandidates(tweets)
+		return nil
+	})
+	for _, err := range errs {
+		log.Printf("webhook: %v\n", err)
+	}
+	if len(tweets) == 0 {
+		return nil, fmt.Errorf("none of the videos may be posted")
+	}
+	return tweets, nil
+}
+
+// postDigestThread posts the thread of a webhook's digest once the
+// operator approves it, if approval is required, and the quiet hours
+// are over, unless cycles were paused in the meantime.
+func postDigestThread(texts []string, approvalCode string, throttle time.Duration) error {
+	if cfg.RequireApproval {
+		preview := fmt.Sprintf("Webhook digest %s of %d posts awaits approval. Reply \"approve %s\" or \"reject %s\".\n\n%s",
+			approvalCode, len(texts), approvalCode, approvalCode, strings.Join(texts, "\n\n"))
+		approved, err := awaitDecision("webhook digest", approvalCode, preview)
+		if !approved {
+			log.Printf("webhook digest %s was not approved, skipping it\n", approvalCode)
+			return err
+		}
+	}
+	holdOffQuietHours()
+	if paused() {
+		log.Printf("cycles are paused, skipping webhook digest %s\n", approvalCode)
+		return nil
+	}
+	return postThread(texts, throttle)
+}
+
+func postRegionDigest(code, name string, top int, approvalCode string, throttle time.Duration) error {
+	tweets, err := fetchRegionTop(code, top)
+	if err != nil {
+		return err
+	}
+	if tweets, err = screenDigest(tweets); err != nil {
+		return err
+	}
+	heading := fmt.Sprintf("Trending on YouTube in %s right now, top %d", name, len(tweets))
+	return postDigestThread(composeDigestThread(heading, tweets), approvalCode, throttle)
+}
+
+// postSearchDigest posts the most viewed videos matching the
+// query, in the region if code is set, as a thread.
+func postSearchDigest(query, code, name string, top int, approvalCode string, throttle time.Duration) error {
+	param := &youtube.SearchParam{
+		Query:             query,
+		MaxPage:           1,
+		MaxResultsPerPage: uint64(top),
+		RegionCode:        code,
+	}
+	tweets, errs := fetchByViewCount(param)
+	if len(tweets) == 0 {
+		if len(errs) > 0 {
+			return errs[0]
+		}
+		return fmt.Errorf("no videos match")
+	}
+	tweets, err := screenDigest(tweets)
+	if err != nil {
+		return err
+	}
+	if len(tweets) > top {
+		tweets = tweets[:top]
+	}
+
+	heading := fmt.Sprintf("Most viewed YouTube videos for %q", truncate(query, 60))
+	if name != "" {
+		heading += " in " + name
+	}
+	return postDigestThread(composeDigestThread(heading, tweets), approvalCode, throttle)
+}
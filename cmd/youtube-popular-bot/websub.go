@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// websubHub is the hub that YouTube publishes its channels' feeds to.
+const websubHub = "https://pubsubhubbub.appspot.com/subscribe"
+
+// websubLease is how long subscriptions are asked for,
+// each being renewed half way through its lease.
+const websubLease = 5 * 24 * time.Hour
+
+// maxUploadAge is how long after its publishing an upload is still
+// posted, as hubs also notify of later edits to a video's metadata.
+const maxUploadAge = 6 * time.Hour
+
+// maxWebSubBody is the largest notification that is read.
+const maxWebSubBody = 1 << 20
+
+// channelTopic is the feed of a channel's uploads that hubs push.
+func channelTopic(channelId string) string {
+	return "https://www.youtube.com/xml/feeds/videos.xml?channel_id=" + url.QueryEscape(channelId)
+}
+
+// uploadFeed is the part of a pushed Atom feed that the bot uses.
+type uploadFeed struct {
+	Entries []struct {
+		VideoId   string    `xml:"http://www.youtube.com/xml/schemas/2015 videoId"`
+		ChannelId string    `xml:"http://www.youtube.com/xml/schemas/2015 channelId"`
+		Title     string    `xml:"title"`
+		Author    string    `xml:"author>name"`
+		Published time.Time `xml:"published"`
+	} `xml:"entry"`
+}
+
+// uploadData is what the "upload" template is rendered from.
+type uploadData struct {
+	YouTubeId    string
+	Title        string
+	ChannelTitle string
+}
+
+var (
+	// websubSecret signs the notifications of this process's
+	// subscriptions, which are renewed with it on every start.
+	websubSecret string
+
+	// announcedUploads are when the uploads posted since starting
+	// were published, as hubs may well notify of them more than once.
+	announcedMu      sync.Mutex
+	announcedUploads = map[string]time.Time{}
+
+	// requestedTopics are the topics subscribed to whose verification
+	// by the hub is awaited, which no other verification passes.
+	requestedMu     sync.Mutex
+	requestedTopics = map[string]bool{}
+)
+
+func newWebSubSecret() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// subscribeChannels subscribes to the uploads of every watched channel
+// and keeps renewing the subscriptions until the bot exits.
+func subscribeChannels(channelIds []string) chan error {
+	errsChan := make(chan error)
+	go func() {
+		defer close(errsChan)
+		for {
+			for _, channelId := range channelIds {
+				// Hubs may verify before responding to the request.
+				requestedMu.Lock()
+				requestedTopics[channelTopic(channelId)] = true
+				requestedMu.Unlock()
+				if err := websubRequest("subscribe", channelTopic(channelId)); err != nil {
+					errsChan <- fmt.Errorf("subscribing to %s: %v", channelId, err)
+				}
+			}
+			time.Sleep(websubLease / 2)
+		}
+	}()
+	return errsChan
+}
+
+func websubRequest(mode, topic string) error {
+	form := url.Values{
+		"hub.mode":          {mode},
+		"hub.topic":         {topic},
+		"hub.callback":      {cfg.WebSubURL},
+		"hub.secret":        {websubSecret},
+		"hub.lease_seconds": {fmt.Sprint(int(websubLease.Seconds()))},
+	}
+	res, err := hookClient.PostForm(websubHub, form)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("the hub responded %s: %s", res.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// watchedTopic reports whether the topic is of a watched channel.
+func watchedTopic(topic string) bool {
+	for _, channelId := range cfg.WatchChannels {
+		if channelTopic(channelId) == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// verifiedTopic reports whether a subscription to the topic was
+// requested and is awaiting verification, which only it passes.
+func verifiedTopic(topic string) bool {
+	requestedMu.Lock()
+	defer requestedMu.Unlock()
+	requested := requestedTopics[topic]
+	delete(requestedTopics, topic)
+	return requested
+}
+
+// serveWebSub confirms the hub's verifications of the subscriptions the
+// bot requested and posts the uploads it is notified of.
+func serveWebSub(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		query := req.URL.Query()
+		if query.Get("hub.mode") != "subscribe" || !verifiedTopic(query.Get("hub.topic")) {
+			http.NotFound(w, req)
+			return
+		}
+		log.Printf("websub: verified %s of %s\n", query.Get("hub.mode"), query.Get("hub.topic"))
+		w.Write([]byte(query.Get("hub.challenge")))
+	case http.MethodPost:
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxWebSubBody))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Hubs are told that a notification was received even if it
+		// is ignored, so that they don't keep retrying forgeries.
+		w.WriteHeader(http.StatusNoContent)
+		if !websubSigned(body, req.Header.Get("X-Hub-Signature")) {
+			log.Printf("websub: ignoring a notification without a valid signature\n")
+			return
+		}
+		go func() {
+			for _, err := range postUploads(body) {
+				log.Printf("websub: %v\n", err)
+			}
+		}()
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// websubSigned reports whether the signature, "sha1=<hex>", is
+// the HMAC-SHA1 of the body keyed with the subscriptions' secret.
+func websubSigned(body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, "sha1=") {
+		return false
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha1="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, []byte(websubSecret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// announce records that the upload, published at the time, is being
+// posted, reporting false if it already was. Uploads too old to be
+// posted any more are forgotten.
+func announce(videoId string, published time.Time) bool {
+	announcedMu.Lock()
+	defer announcedMu.Unlock()
+	for id, at := range announcedUploads {
+		if time.Since(at) > maxUploadAge {
+			delete(announcedUploads, id)
+		}
+	}
+	if _, ok := announcedUploads[videoId]; ok {
+		return false
+	}
+	announcedUploads[videoId] = published
+	return true
+}
+
+// postUploads posts every new upload of a watched channel in the feed,
+// screened by the content policies, safe mode and the blocklists, and
+// records them as posted. Uploads whose metadata can't be fetched can't
+// be screened, and are skipped, as are those that the store knows were
+// posted, e.g. before a restart. Like digests, uploads await approval
+// if it is required and the end of the quiet hours, and are skipped
+// while cycles are paused.
+func postUploads(body []byte) []error {
+	var feed uploadFeed
+	if err := xml.Unmarshal(body, &feed); err != nil {
+		return []error{fmt.Errorf("parsing the notification: %v", err)}
+	}
+	postedAt, err := store.PostedSince(time.Now().Add(-maxUploadAge))
+	if err != nil {
+		return []error{fmt.Errorf("loading the posted videos: %v", err)}
+	}
+
+	var ids []string
+	for _, entry := range feed.Entries {
+		if entry.VideoId == "" || !watchedTopic(channelTopic(entry.ChannelId)) {
+			continue
+		}
+		if _, ok := postedAt[entry.VideoId]; ok {
+			continue
+		}
+		if time.Since(entry.Published) > maxUploadAge || !announce(entry.VideoId, entry.Published) {
+			continue
+		}
+		ids = append(ids, entry.VideoId)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var errs []error
+	videos, err := videosById(ids)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("fetching the uploads: %v", err))
+	}
+	var tweets []*tweet
+	for _, id := range ids {
+		if video, ok := videos[id]; ok {
+			tweets = append(tweets, newTweet(video))
+		} else {
+			errs = append(errs, fmt.Errorf("skipping the upload %q, whose metadata couldn't be fetched", id))
+		}
+	}
+
+	texts := map[*tweet]string{}
+	withReloadable(func() error {
+		var screenErrs []error
+		tweets, screenErrs = screenBlocked(tweets)
+		errs = append(errs, screenErrs...)
+		for _, tw := range tweets {
+			buf := new(bytes.Buffer)
+			data := &uploadData{YouTubeId: tw.YouTubeId, Title: tw.video.Title, ChannelTitle: tw.video.ChannelTitle}
+			if err := templates.ExecuteTemplate(buf, "upload", data); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			texts[tw] = buf.String()
+		}
+		return nil
+	})
+
+	for _, tw := range tweets {
+		text, ok := texts[tw]
+		if !ok {
+			continue
+		}
+		if cfg.RequireApproval {
+			code := "upload-" + tw.YouTubeId
+			preview := fmt.Sprintf("Upload %s of %s awaits approval. Reply \"approve %s\" or \"reject %s\".\n\n%s",
+				tw.YouTubeId, tw.video.ChannelTitle, code, code, text)
+			approved, err := awaitDecision("upload", code, preview)
+			if !approved {
+				log.Printf("websub: the upload %q was not approved, skipping it\n", tw.YouTubeId)
+				if err != nil {
+					errs = append(errs, err)
+				}
+				continue
+			}
+		}
+		holdOffQuietHours()
+		if paused() {
+			log.Printf("websub: cycles are paused, skipping the upload %q\n", tw.YouTubeId)
+			continue
+		}
+		log.Printf("websub: posting the upload %q of %s\n", tw.YouTubeId, tw.video.ChannelId)
+		posted, err := postTweet(text, nil)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := store.MarkPosted(tw.YouTubeId, time.Now()); err != nil {
+			errs = append(errs, err)
+		}
+		event := newPostEvent("upload", posted, text)
+		event.VideoId = tw.YouTubeId
+		event.Title = tw.Title
+		event.URL = tw.URL
+		errs = append(errs, runPostHooks(event)...)
+	}
+	return errs
+}
+
+// serveWebSubCallback serves the subscriptions' callback on addr.
+func serveWebSubCallback(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", serveWebSub)
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	log.Printf("serving the websub callback on %s\n", addr)
+	return server.ListenAndServe()
+}
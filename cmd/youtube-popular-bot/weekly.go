@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// weeklyVideo is a video's showings in a week's snapshots.
+type weeklyVideo struct {
+	id, title string
+
+	// appearances is in how many snapshots the video was, and
+	// peak the highest rank it reached in any of them.
+	appearances int
+	peak        uint64
+
+	// firstViews and lastViews are the views of the first
+	// and the last snapshots that counted them.
+	firstViews, lastViews uint64
+	counted               bool
+}
+
+func (wv *weeklyVideo) growth() uint64 {
+	if !wv.counted || wv.lastViews < wv.firstViews {
+		return 0
+	}
+	return wv.lastViews - wv.firstViews
+}
+
+// weeklyDigest is what a week's snapshots add up to.
+type weeklyDigest struct {
+	Since, Until time.Time
+	Snapshots    int
+
+	MostAppearances, HighestPeak, BiggestGrowth *weeklyVideo
+}
+
+// buildWeeklyDigest mines the snapshots kept in dir that were fetched
+// in the week up to until for the week's top videos.
+func buildWeeklyDigest(dir string, until time.Time) (*weeklyDigest, error) {
+	wd := &weeklyDigest{Since: until.AddDate(0, 0, -7), Until: until}
+	var snapshots []*trendingSnapshot
+	err := forEachTrendingSnapshot(dir, func(_ string, ts *trendingSnapshot) error {
+		if !ts.FetchedAt.Before(wd.Since) && ts.FetchedAt.Before(until) {
+			snapshots = append(snapshots, ts)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].FetchedAt.Before(snapshots[j].FetchedAt) })
+	wd.Snapshots = len(snapshots)
+
+	videos := map[string]*weeklyVideo{}
+	for _, ts := range snapshots {
+		for _, sv := range ts.Videos {
+			wv, ok := videos[sv.VideoId]
+			if !ok {
+				wv = &weeklyVideo{id: sv.VideoId, peak: sv.Rank}
+				videos[sv.VideoId] = wv
+			}
+			// Titles are the latest, in case they changed.
+			wv.title = sv.Title
+			wv.appearances++
+			if sv.Rank < wv.peak {
+				wv.peak = sv.Rank
+			}
+			if !sv.ViewsHidden {
+				if !wv.counted {
+					wv.firstViews, wv.counted = sv.ViewCount, true
+				}
+				wv.lastViews = sv.ViewCount
+			}
+		}
+	}
+
+	// Going through the videos in order of their ids breaks ties
+	// the same way every time the digest is built.
+	ids := make([]string, 0, len(videos))
+	for id := range videos {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		wv := videos[id]
+		if best := wd.MostAppearances; best == nil || wv.appearances > best.appearances {
+			wd.MostAppearances = wv
+		}
+		if best := wd.HighestPeak; best == nil || wv.peak < best.peak ||
+			(wv.peak == best.peak && wv.appearances > best.appearances) {
+			wd.HighestPeak = wv
+		}
+		if best := wd.BiggestGrowth; wv.growth() > 0 && (best == nil || wv.growth() > best.growth()) {
+			wd.BiggestGrowth = wv
+		}
+	}
+	return wd, nil
+}
+
+// texts returns the posts of the weekly digest's thread, or
+// none if no snapshot was kept in the week, its days being those of loc.
+func (wd *weeklyDigest) texts(loc *time.Location) []string {
+	if wd.Snapshots == 0 {
+		return nil
+	}
+	texts := []string{fmt.Sprintf("The week's top YouTube videos, %s to %s, out of %s charts:",
+		wd.Since.In(loc).Format("Jan 2"), wd.Until.Add(-time.Second).In(loc).Format("Jan 2"),
+		humanize.Comma(int64(wd.Snapshots)))}
+	if wv := wd.MostAppearances; wv != nil {
+		texts = append(texts, fmt.Sprintf("Most time trending: %s, on %s of the charts %s",
+			truncate(wv.title, recapTitleLength), humanize.Comma(int64(wv.appearances)), youtubeURL(wv.id)))
+	}
+	if wv := wd.HighestPeak; wv != nil {
+		texts = append(texts, fmt.Sprintf("Highest peak: %s, reaching #%d %s",
+			truncate(wv.title, recapTitleLength), wv.peak, youtubeURL(wv.id)))
+	}
+	if wv := wd.BiggestGrowth; wv != nil {
+		texts = append(texts, fmt.Sprintf("Biggest view growth: %s, up %s views while trending %s",
+			truncate(wv.title, recapTitleLength), humanize.Comma(int64(wv.growth())), youtubeURL(wv.id)))
+	}
+	return texts
+}
+
+// periodicWeeklyDigests posts the thread of the week that just ended
+// at the times of the weekly digest schedule.
+func periodicWeeklyDigests(s *schedule) chan error {
+	throttle, loc := pacing()
+	return runOnSchedule(s, func(at time.Time) error {
+		wd, err := buildWeeklyDigest(cfg.SnapshotDir, at)
+		if err != nil {
+			return err
+		}
+		texts := wd.texts(loc)
+		if len(texts) == 0 {
+			return nil
+		}
+		return postThread(texts, throttle)
+	})
+}
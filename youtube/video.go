@@ -0,0 +1,199 @@
+package youtube
+
+import (
+	"encoding/json"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+// Video is a YouTube video. It is populated from
+// the API's resource so that consumers need not
+// depend on the layout of the generated types.
+type Video struct {
+	Id          string   `json:"id"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags,omitempty"`
+	CategoryId  string   `json:"category_id"`
+	PublishedAt string   `json:"published_at"`
+
+	ChannelId    string `json:"channel_id"`
+	ChannelTitle string `json:"channel_title"`
+
+	DefaultLanguage      string `json:"default_language,omitempty"`
+	DefaultAudioLanguage string `json:"default_audio_language,omitempty"`
+
+	// LiveBroadcastContent is "live" or "upcoming"
+	// for broadcasts and "none" for other videos.
+	LiveBroadcastContent string `json:"live_broadcast_content,omitempty"`
+
+	// Thumbnails are keyed by their quality, one of
+	// "maxres", "standard", "high", "medium" or "default".
+	Thumbnails map[string]*Thumbnail `json:"thumbnails,omitempty"`
+
+	ViewCount    uint64 `json:"view_count"`
+	LikeCount    uint64 `json:"like_count"`
+	CommentCount uint64 `json:"comment_count"`
+
+	// ViewsHidden and LikesHidden are set for counts that the owner
+	// hid, which the API leaves out, rather than reporting as zero.
+	ViewsHidden bool `json:"views_hidden,omitempty"`
+	LikesHidden bool `json:"likes_hidden,omitempty"`
+
+	// Duration is the ISO 8601 duration of the video e.g "PT4M13S".
+	Duration      string `json:"duration,omitempty"`
+	AgeRestricted bool   `json:"age_restricted,omitempty"`
+
+	PrivacyStatus string `json:"privacy_status,omitempty"`
+	UploadStatus  string `json:"upload_status,omitempty"`
+}
+
+type Thumbnail struct {
+	URL    string `json:"url"`
+	Width  int64  `json:"width,omitempty"`
+	Height int64  `json:"height,omitempty"`
+}
+
+// Channel is a YouTube channel.
+type Channel struct {
+	Id          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+
+	SubscriberCount uint64 `json:"subscriber_count"`
+	VideoCount      uint64 `json:"video_count"`
+	ViewCount       uint64 `json:"view_count"`
+}
+
+// SearchResult is a single item of search
+// results, only one of its ids being set.
+type SearchResult struct {
+	VideoId    string `json:"video_id,omitempty"`
+	ChannelId  string `json:"channel_id,omitempty"`
+	PlaylistId string `json:"playlist_id,omitempty"`
+
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	ChannelTitle string `json:"channel_title"`
+}
+
+// hiddenCounts are the counts that a video's statistics leave out, as
+// they do those that the owner hid. The generated types decode left out
+// counts to zero all the same, so they are told from the API's JSON.
+type hiddenCounts struct {
+	views, likes bool
+}
+
+func statisticsHidden(stats map[string]json.RawMessage) hiddenCounts {
+	_, views := stats["viewCount"]
+	_, likes := stats["likeCount"]
+	return hiddenCounts{views: !views, likes: !likes}
+}
+
+// NewVideoFromJSON populates a Video from the API's resource
+// encoded as JSON, telling the counts that its statistics leave
+// out, because the owner hid them, apart from zero ones.
+func NewVideoFromJSON(blob []byte) (*Video, error) {
+	v := new(youtube.Video)
+	if err := json.Unmarshal(blob, v); err != nil {
+		return nil, err
+	}
+	var raw struct {
+		Statistics map[string]json.RawMessage `json:"statistics"`
+	}
+	if err := json.Unmarshal(blob, &raw); err != nil {
+		return nil, err
+	}
+	video := NewVideo(v)
+	if raw.Statistics != nil {
+		video.setHidden(statisticsHidden(raw.Statistics))
+	}
+	return video, nil
+}
+
+func (v *Video) setHidden(hidden hiddenCounts) {
+	v.ViewsHidden, v.LikesHidden = hidden.views, hidden.likes
+}
+
+// NewVideo populates a Video from the API's resource. The decoded
+// resource doesn't tell hidden counts apart from zero ones, which
+// NewVideoFromJSON and the videos that the Client lists do.
+func NewVideo(v *youtube.Video) *Video {
+	video := &Video{Id: v.Id}
+	if snippet := v.Snippet; snippet != nil {
+		video.Title = snippet.Title
+		video.Description = snippet.Description
+		video.Tags = snippet.Tags
+		video.CategoryId = snippet.CategoryId
+		video.PublishedAt = snippet.PublishedAt
+		video.ChannelId = snippet.ChannelId
+		video.ChannelTitle = snippet.ChannelTitle
+		video.DefaultLanguage = snippet.DefaultLanguage
+		video.DefaultAudioLanguage = snippet.DefaultAudioLanguage
+		video.LiveBroadcastContent = snippet.LiveBroadcastContent
+		video.Thumbnails = newThumbnails(snippet.Thumbnails)
+	}
+	if stats := v.Statistics; stats != nil {
+		video.ViewCount = stats.ViewCount
+		video.LikeCount = stats.LikeCount
+		video.CommentCount = stats.CommentCount
+	}
+	if details := v.ContentDetails; details != nil {
+		video.Duration = details.Duration
+		video.AgeRestricted = details.ContentRating != nil && details.ContentRating.YtRating == "ytAgeRestricted"
+	}
+	if status := v.Status; status != nil {
+		video.PrivacyStatus = status.PrivacyStatus
+		video.UploadStatus = status.UploadStatus
+	}
+	return video
+}
+
+func newThumbnails(details *youtube.ThumbnailDetails) map[string]*Thumbnail {
+	if details == nil {
+		return nil
+	}
+
+	thumbs := make(map[string]*Thumbnail)
+	for quality, thumb := range map[string]*youtube.Thumbnail{
+		"maxres":   details.Maxres,
+		"standard": details.Standard,
+		"high":     details.High,
+		"medium":   details.Medium,
+		"default":  details.Default,
+	} {
+		if thumb != nil && thumb.Url != "" {
+			thumbs[quality] = &Thumbnail{URL: thumb.Url, Width: thumb.Width, Height: thumb.Height}
+		}
+	}
+	return thumbs
+}
+
+func newChannel(c *youtube.Channel) *Channel {
+	channel := &Channel{Id: c.Id}
+	if snippet := c.Snippet; snippet != nil {
+		channel.Title = snippet.Title
+		channel.Description = snippet.Description
+	}
+	if stats := c.Statistics; stats != nil {
+		channel.SubscriberCount = stats.SubscriberCount
+		channel.VideoCount = stats.VideoCount
+		channel.ViewCount = stats.ViewCount
+	}
+	return channel
+}
+
+func newSearchResult(r *youtube.SearchResult) *SearchResult {
+	result := new(SearchResult)
+	if id := r.Id; id != nil {
+		result.VideoId = id.VideoId
+		result.ChannelId = id.ChannelId
+		result.PlaylistId = id.PlaylistId
+	}
+	if snippet := r.Snippet; snippet != nil {
+		result.Title = snippet.Title
+		result.Description = snippet.Description
+		result.ChannelTitle = snippet.ChannelTitle
+	}
+	return result
+}
@@ -0,0 +1,451 @@
+// Package youtube is the bot's fork of github.com/odeke-em/youtube, taken
+// at revision 03d652b2238a27f9c18f54435b79d8dcdd83d49b.
+package youtube
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+	googleapiTransport "google.golang.org/api/googleapi/transport"
+	"google.golang.org/api/youtube/v3"
+)
+
+var (
+	envAPIKeyKey   = "YOUTUBE_API_KEY"
+	envResolvedKey = strings.TrimSpace(os.Getenv(envAPIKeyKey))
+)
+
+type Client struct {
+	sync.RWMutex
+	apiKey  string
+	service *youtube.Service
+}
+
+var (
+	errEmptyEnvAPIKey = fmt.Errorf("empty API Key from environment. Expecting env %q", envAPIKeyKey)
+	errEmptyAPIKey    = fmt.Errorf("expecting a non-empty API key")
+)
+
+func clientWithKey(key string, transport http.RoundTripper) (*Client, error) {
+	httpClient := &http.Client{
+		Transport: &googleapiTransport.APIKey{Key: key, Transport: &hiddenCountsRecorder{base: transport}},
+	}
+
+	service, err := youtube.New(httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	client := new(Client)
+	client.apiKey = key
+	client.service = service
+
+	return client, nil
+}
+
+// New returns a client with an API Key derived
+// from the environment, set as YOUTUBE_API_KEY.
+func New() (*Client, error) {
+	apiKey := envResolvedKey
+	if apiKey == "" {
+		return nil, errEmptyEnvAPIKey
+	}
+	return clientWithKey(envResolvedKey, nil)
+}
+
+// NewWithKey creates a client
+// with the provided API Key.
+func NewWithKey(apiKey string) (*Client, error) {
+	if apiKey == "" {
+		return nil, errEmptyAPIKey
+	}
+	return clientWithKey(apiKey, nil)
+}
+
+// NewWithTransport creates a client with the provided
+// API Key whose requests are made through transport.
+func NewWithTransport(apiKey string, transport http.RoundTripper) (*Client, error) {
+	if apiKey == "" {
+		return nil, errEmptyAPIKey
+	}
+	return clientWithKey(apiKey, transport)
+}
+
+// hiddenCountsKey keys the contexts of the requests listing videos
+// with the map in which to record the counts each video leaves out.
+type hiddenCountsKey struct{}
+
+// hiddenCountsRecorder records, for the requests whose context
+// asks for it, which counts the statistics of the listed videos
+// leave out, which the generated types can't tell.
+type hiddenCountsRecorder struct {
+	base http.RoundTripper
+}
+
+func (t *hiddenCountsRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	res, err := base.RoundTrip(req)
+	hidden, ok := req.Context().Value(hiddenCountsKey{}).(map[string]hiddenCounts)
+	if err != nil || !ok || res.StatusCode != http.StatusOK {
+		return res, err
+	}
+
+	blob, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(blob))
+
+	var list struct {
+		Items []struct {
+			Id         string                     `json:"id"`
+			Statistics map[string]json.RawMessage `json:"statistics"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(blob, &list); err != nil {
+		// Left for the generated types to report.
+		return res, nil
+	}
+	for _, item := range list.Items {
+		if item.Statistics != nil {
+			hidden[item.Id] = statisticsHidden(item.Statistics)
+		}
+	}
+	return res, nil
+}
+
+type SearchParam struct {
+	PageToken string `json:"page_token"`
+
+	// Query is the content to search for.
+	Query string `json:"query"`
+
+	// MaxPage is the maximum number of
+	// pages of items that you want returned
+	MaxPage uint64 `json:"max_page"`
+
+	// MaxResultsPerPage is the maximum number of
+	// items to be returned per pagination/page fetch.
+	MaxResultsPerPage uint64 `json:"max_results_per_page"`
+
+	// MaxRequestedItems is the threshold for the number
+	// of items that you'd like to stop the search after.
+	MaxRequestedItems uint64 `json:"max_requested_items"`
+
+	// RelatedToVideoId is the id for whose
+	// related videos you'd like returned
+	RelatedToVideoId string `json:"related_to_video_id"`
+
+	// VideoCategoryId restricts the most popular
+	// chart to videos of only that category.
+	VideoCategoryId string `json:"video_category_id"`
+
+	// RegionCode is the ISO 3166-1 alpha-2 code of
+	// the country whose results you'd like returned.
+	RegionCode string `json:"region_code"`
+
+	// Order is the order in which search results
+	// are returned e.g "viewCount" or "date".
+	Order string `json:"order"`
+
+	// Type restricts search results to only
+	// "video", "channel" or "playlist" kinds.
+	Type string `json:"type"`
+
+	// Fields if set requests a partial response of only those
+	// fields e.g "items(id,statistics),nextPageToken" which
+	// reduces the size of responses that must be decoded.
+	Fields string `json:"fields"`
+}
+
+// ChartUnavailableError is returned when a chart is
+// not supported for the requested region.
+type ChartUnavailableError struct {
+	Chart      string
+	RegionCode string
+	Err        error
+}
+
+func (e *ChartUnavailableError) Error() string {
+	return fmt.Sprintf("chart %q is unavailable in region %q: %v", e.Chart, e.RegionCode, e.Err)
+}
+
+func isChartUnavailable(err error) bool {
+	gerr, ok := err.(*googleapi.Error)
+	if !ok {
+		return false
+	}
+	if gerr.Code != http.StatusBadRequest && gerr.Code != http.StatusNotFound {
+		return false
+	}
+	for _, item := range gerr.Errors {
+		if strings.Contains(item.Reason, "RegionCode") || strings.Contains(item.Reason, "Chart") {
+			return true
+		}
+	}
+	return strings.Contains(gerr.Message, "region")
+}
+
+type SearchPage struct {
+	Index uint64
+
+	Err   error
+	Items []*SearchResult
+}
+
+type ResultsPage struct {
+	Index uint64
+	Err   error
+	Items []*Video
+
+	// TotalResults is the API's estimate of how many
+	// results there are in total across all pages.
+	TotalResults int64
+}
+
+var videoListFields = "id,snippet,statistics,contentDetails"
+
+func (c *Client) ById(ids ...string) (chan *ResultsPage, error) {
+	idsCSV := strings.Join(ids, ",")
+	req := c.service.Videos.List(videoListFields).Id(idsCSV)
+	return c.doVideos(req, nil)
+}
+
+// StatusById only requests the id and status of the
+// videos which makes it cheap enough to use for checking
+// whether videos are still available. Deleted videos
+// are omitted from the results.
+func (c *Client) StatusById(ids ...string) (chan *ResultsPage, error) {
+	idsCSV := strings.Join(ids, ",")
+	req := c.service.Videos.List("id,status").Id(idsCSV)
+	return c.doVideos(req, nil)
+}
+
+// ChannelsById returns the channels with the given ids.
+// Channels that don't exist are omitted from the results.
+func (c *Client) ChannelsById(ids ...string) ([]*Channel, error) {
+	idsCSV := strings.Join(ids, ",")
+	res, err := c.service.Channels.List("id,snippet,statistics").Id(idsCSV).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	channels := make([]*Channel, 0, len(res.Items))
+	for _, item := range res.Items {
+		channels = append(channels, newChannel(item))
+	}
+	return channels, nil
+}
+
+// MostPopular returns the currently most popular videos.
+// Specifying MaxPage, MaxResultsPerPage help
+// control how many items should be retrieved.
+func (c *Client) MostPopular(param *SearchParam) (chan *ResultsPage, error) {
+	req := c.service.Videos.List(videoListFields).Chart("mostPopular")
+	if param != nil && param.VideoCategoryId != "" {
+		req = req.VideoCategoryId(param.VideoCategoryId)
+	}
+	if param != nil && param.RegionCode != "" {
+		req = req.RegionCode(param.RegionCode)
+	}
+	return c.doVideos(req, param)
+}
+
+// ProbeMostPopular checks whether the most popular chart is
+// available for the region, returning a *ChartUnavailableError
+// if it is not.
+func (c *Client) ProbeMostPopular(regionCode string) error {
+	req := c.service.Videos.List("id").Chart("mostPopular").MaxResults(1)
+	if regionCode != "" {
+		req = req.RegionCode(regionCode)
+	}
+	_, err := req.Do()
+	if err != nil && isChartUnavailable(err) {
+		return &ChartUnavailableError{Chart: "mostPopular", RegionCode: regionCode, Err: err}
+	}
+	return err
+}
+
+func (c *Client) doVideos(req *youtube.VideosListCall, param *SearchParam) (chan *ResultsPage, error) {
+	pagesChan := make(chan *ResultsPage)
+
+	if param == nil {
+		param = new(SearchParam)
+	}
+
+	go func() {
+		defer close(pagesChan)
+		ticker := time.NewTicker(1e8)
+		defer ticker.Stop()
+
+		maxPageIndex := param.MaxPage
+		maxResultsPerPage := param.MaxResultsPerPage
+		maxRequestedItems := param.MaxRequestedItems
+
+		pageIndex := uint64(0)
+		itemsCount := uint64(0)
+		pageToken := param.PageToken
+
+		for {
+			if maxRequestedItems > 0 && itemsCount >= maxRequestedItems {
+				break
+			}
+
+			if maxPageIndex > 0 && pageIndex >= maxPageIndex {
+				break
+			}
+
+			// If there are still more pages, let's keep searching
+			if pageToken != "" {
+				req = req.PageToken(pageToken)
+			}
+
+			if maxResultsPerPage > 0 {
+				req = req.MaxResults(int64(maxResultsPerPage))
+			}
+
+			if param.Fields != "" {
+				req = req.Fields(googleapi.Field(param.Fields))
+			}
+
+			hidden := make(map[string]hiddenCounts)
+			req = req.Context(context.WithValue(context.Background(), hiddenCountsKey{}, hidden))
+
+			res, err := req.Do()
+			if err != nil {
+				pagesChan <- &ResultsPage{Err: err, Index: pageIndex}
+				return
+			}
+
+			pageToken = res.NextPageToken
+
+			// Increment our stoppers and that pageIndex
+			itemsCount += uint64(len(res.Items))
+			pageIndex += 1
+
+			page := &ResultsPage{
+				Index: pageIndex,
+				Items: make([]*Video, 0, len(res.Items)),
+			}
+			for _, item := range res.Items {
+				video := NewVideo(item)
+				if h, ok := hidden[item.Id]; ok {
+					video.setHidden(h)
+				}
+				page.Items = append(page.Items, video)
+			}
+			if res.PageInfo != nil {
+				page.TotalResults = res.PageInfo.TotalResults
+			}
+
+			pagesChan <- page
+
+			if pageToken == "" {
+				break
+			}
+
+			<-ticker.C
+		}
+	}()
+
+	return pagesChan, nil
+}
+
+func (c *Client) Search(param *SearchParam) (chan *SearchPage, error) {
+	pagesChan := make(chan *SearchPage)
+
+	go func() {
+		defer close(pagesChan)
+		ticker := time.NewTicker(1e8)
+		defer ticker.Stop()
+
+		query := param.Query
+		maxPageIndex := param.MaxPage
+		maxResultsPerPage := param.MaxResultsPerPage
+		maxRequestedItems := param.MaxRequestedItems
+
+		req := c.service.Search.List("id,snippet").Q(query)
+		if maxResultsPerPage > 0 {
+			req = req.MaxResults(int64(maxResultsPerPage))
+		}
+
+		if param.RelatedToVideoId != "" {
+			// When RelatedToVideo is used, we must set Type to "video"
+			req = req.RelatedToVideoId(param.RelatedToVideoId).Type("video")
+		}
+
+		if param.Type != "" {
+			req = req.Type(param.Type)
+		}
+
+		if param.Order != "" {
+			req = req.Order(param.Order)
+		}
+
+		if param.RegionCode != "" {
+			req = req.RegionCode(param.RegionCode)
+		}
+
+		pageIndex := uint64(0)
+		itemsCount := uint64(0)
+		pageToken := param.PageToken
+
+		for {
+			if maxRequestedItems > 0 && itemsCount >= maxRequestedItems {
+				break
+			}
+
+			if maxPageIndex > 0 && pageIndex >= maxPageIndex {
+				break
+			}
+
+			// If there are still more pages, let's keep searching
+			if pageToken != "" {
+				req = req.PageToken(pageToken)
+			}
+
+			res, err := req.Do()
+			if err != nil {
+				pagesChan <- &SearchPage{Err: err, Index: pageIndex}
+				return
+			}
+
+			pageToken = res.NextPageToken
+
+			// Increment our stoppers and that pageIndex
+			itemsCount += uint64(len(res.Items))
+			pageIndex += 1
+
+			page := &SearchPage{
+				Index: pageIndex,
+				Items: make([]*SearchResult, 0, len(res.Items)),
+			}
+			for _, item := range res.Items {
+				page.Items = append(page.Items, newSearchResult(item))
+			}
+
+			pagesChan <- page
+
+			if pageToken == "" {
+				break
+			}
+
+			<-ticker.C
+		}
+	}()
+
+	return pagesChan, nil
+}